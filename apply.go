@@ -54,12 +54,12 @@ func (x V) applyN(ctx *Context, n int) V {
 	//}()
 	switch x.kind {
 	case valInt:
-		return applyI(n, x.I(), ctx.top())
+		return applyI(ctx, n, x.I(), ctx.top())
 	case valFloat:
 		if !isI(x.F()) {
 			return Panicf("i@y : non-integer i (%g)", x.F())
 		}
-		return applyI(n, int64(x.F()), ctx.top())
+		return applyI(ctx, n, int64(x.F()), ctx.top())
 	case valLambda:
 		return x.lambda().applyN(ctx, n)
 	case valVariadic:
@@ -84,6 +84,9 @@ func (x V) applyN(ctx *Context, n int) V {
 }
 
 func (v variadic) apply(ctx *Context) V {
+	if ctx.interrupted() {
+		return panicInterrupted()
+	}
 	args := ctx.peek()
 	x := args[0]
 	if x.kind == valNil {
@@ -94,6 +97,10 @@ func (v variadic) apply(ctx *Context) V {
 }
 
 func (v variadic) apply2(ctx *Context) V {
+	if ctx.interrupted() {
+		ctx.drop()
+		return panicInterrupted()
+	}
 	args := ctx.peekN(2)
 	if args[0].kind == valNil {
 		if args[1].kind != valNil {
@@ -116,6 +123,10 @@ func (v variadic) apply2(ctx *Context) V {
 }
 
 func (v variadic) applyN(ctx *Context, n int) V {
+	if ctx.interrupted() {
+		ctx.dropN(n - 1)
+		return panicInterrupted()
+	}
 	args := ctx.peekN(n)
 	if hasNil(args) {
 		args := cloneArgs(args)
@@ -128,12 +139,28 @@ func (v variadic) applyN(ctx *Context, n int) V {
 }
 
 func (id lambda) applyN(ctx *Context, n int) V {
-	if ctx.callDepth > maxCallDepth {
+	return id.call(ctx, nil, n)
+}
+
+func (cl *closure) applyN(ctx *Context, n int) V {
+	return cl.Fun.call(ctx, cl, n)
+}
+
+// call applies lambda id, with captured values from closure cl if not nil,
+// like applyN.
+func (id lambda) call(ctx *Context, cl *closure, n int) V {
+	if ctx.callDepth > ctx.callDepthMax {
 		if n > 1 {
 			ctx.dropN(n - 1)
 		}
 		return panics("lambda: exceeded maximum call depth")
 	}
+	if ctx.interrupted() {
+		if n > 1 {
+			ctx.dropN(n - 1)
+		}
+		return panicInterrupted()
+	}
 	lc := ctx.lambdas[int(id)]
 	if lc.Rank < n {
 		if n > 1 {
@@ -143,42 +170,82 @@ func (id lambda) applyN(ctx *Context, n int) V {
 	}
 	args := ctx.peekN(n)
 	if lc.Rank > n || hasNil(args) {
+		fun := newLambda(id)
+		if cl != nil {
+			fun = NewV(cl)
+		}
 		if n == 1 {
 			if args[0].kind == valNil {
-				return NewV(&projectionMonad{Fun: newLambda(id)})
+				return NewV(&projectionMonad{Fun: fun})
 			}
-			return NewV(&projectionFirst{Fun: newLambda(id), Arg: ctx.top()})
+			return NewV(&projectionFirst{Fun: fun, Arg: ctx.top()})
 		}
 		if n == 2 && args[1].kind != valNil && args[0].kind == valNil {
 			x := args[1]
 			ctx.drop() // drop nil
-			return NewV(&projectionFirst{Fun: newLambda(id), Arg: x})
+			return NewV(&projectionFirst{Fun: fun, Arg: x})
 		}
 		args := cloneArgs(args)
 		ctx.dropN(n - 1)
-		return NewV(&projection{Fun: newLambda(id), Args: args})
+		return NewV(&projection{Fun: fun, Args: args})
 	}
-	unusedFirst := false
-	for _, i := range lc.UnusedArgs {
-		if v := &args[i]; v.kind == valBoxed {
-			v.rcdecrRefCounter()
-			v.bv = nil
-			if i == 0 {
-				unusedFirst = true
+	olambda := ctx.lambda
+	oframeIdx := ctx.frameIdx
+	ctx.callDepth++
+	prof := ctx.prof
+	tails := 0 // number of frames replaced by tail calls
+	var (
+		ip          int
+		err         error
+		nVars       int
+		unusedFirst bool
+	)
+	for {
+		unusedFirst = false
+		for _, i := range lc.UnusedArgs {
+			if v := &args[i]; v.kind == valBoxed {
+				v.rcdecrRefCounter()
+				v.bv = nil
+				if i == 0 {
+					unusedFirst = true
+				}
 			}
 		}
+		nVars = lc.nVars
+		for i := 0; i < nVars; i++ {
+			ctx.stack = append(ctx.stack, V{})
+		}
+		ctx.frameIdx = int32(len(ctx.stack) - 1)
+		if cl != nil {
+			for i, x := range cl.Env {
+				x.IncrRC()
+				ctx.stack[ctx.frameIdx-lc.Captures[i]] = x
+			}
+		}
+		ctx.lambda = int(id)
+		if prof != nil {
+			ctx.pushProfFrame(lc)
+		}
+		ip, err = ctx.execute(lc.Body)
+		if prof != nil {
+			ctx.popProfFrame(prof)
+		}
+		if ctx.tail.n == 0 {
+			break
+		}
+		// Tail call: the arguments of the called lambda replace the
+		// current frame, whose arguments and variables have already
+		// been consumed by their last use.
+		tc := ctx.tail
+		ctx.tail = pendingCall{}
+		base := len(ctx.stack) - tc.n - nVars - n
+		copy(ctx.stack[base:], ctx.stack[len(ctx.stack)-tc.n:])
+		ctx.dropNnoRC(nVars + n)
+		id, cl, n = tc.id, tc.cl, tc.n
+		lc = ctx.lambdas[int(id)]
+		args = ctx.peekN(n)
+		tails++
 	}
-	nVars := lc.nVars
-	for i := 0; i < nVars; i++ {
-		ctx.stack = append(ctx.stack, V{})
-	}
-	oframeIdx := ctx.frameIdx
-	ctx.frameIdx = int32(len(ctx.stack) - 1)
-
-	olambda := ctx.lambda
-	ctx.lambda = int(id)
-	ctx.callDepth++
-	ip, err := ctx.execute(lc.Body)
 	ctx.callDepth--
 	ctx.lambda = olambda
 	ctx.frameIdx = oframeIdx
@@ -195,7 +262,7 @@ func (id lambda) applyN(ctx *Context, n int) V {
 	var r V
 	switch {
 	case err != nil:
-		ctx.updateErrPos(ip, lc)
+		ctx.updateErrPos(ip, lc, tails)
 		r = panics(err.Error())
 	default:
 		r = ctx.stack[len(ctx.stack)-1]
@@ -213,6 +280,49 @@ func (id lambda) applyN(ctx *Context, n int) V {
 	return r
 }
 
+// pendingCall represents a tail call to be done by the lambda call in
+// progress, replacing its frame.
+type pendingCall struct {
+	id lambda
+	cl *closure // captured values (if any)
+	n  int      // number of arguments (zero if no call)
+}
+
+// tailCall prepares a tail call of x with the top n arguments of the stack
+// (below x if onStack) and reports whether it did. It does not if x is not a
+// lambda or closure of rank n, if an argument is nil, or if the arguments are
+// not the only values above the current frame: x should then be applied
+// normally.
+func (ctx *Context) tailCall(x V, n int, onStack bool) bool {
+	var id lambda
+	var cl *closure
+	switch x.kind {
+	case valLambda:
+		id = x.lambda()
+	case valBoxed:
+		var ok bool
+		if cl, ok = x.bv.(*closure); !ok {
+			return false
+		}
+		id = cl.Fun
+	default:
+		return false
+	}
+	slen := len(ctx.stack)
+	if onStack {
+		slen--
+	}
+	if ctx.lambdas[int(id)].Rank != n || slen-n != int(ctx.frameIdx)+1 ||
+		hasNil(ctx.stack[slen-n:slen]) || ctx.interrupted() {
+		return false
+	}
+	if onStack {
+		ctx.pop()
+	}
+	ctx.tail = pendingCall{id: id, cl: cl, n: n}
+	return true
+}
+
 func (dv *derivedVerb) applyN(ctx *Context, n int) V {
 	ctx.push(dv.Arg)
 	args := ctx.peekN(n + 1)
@@ -550,10 +660,19 @@ func (r *rxReplacer) applyN(ctx *Context, n int) V {
 	return nr
 }
 
-func applyI(n int, i int64, y V) V {
+func applyI(ctx *Context, n int, i int64, y V) V {
 	if n > 1 {
 		return panicRank("i.y")
 	}
+	var l int
+	if yv, ok := y.bv.(*D); ok {
+		l = yv.keys.Len()
+	} else {
+		l = y.Len()
+	}
+	if err := ctx.allocTakeN(i, l); err != nil {
+		return Panicf("i@y : %v", err)
+	}
 	switch yv := y.bv.(type) {
 	case *D:
 		rk := takePadN(i, yv.keys)
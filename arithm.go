@@ -274,10 +274,13 @@ func absI(x int64) int64 {
 	return x
 }
 
-func moddivpad(x int64, y V) V {
+func moddivpad(ctx *Context, x int64, y V) V {
 	if x == 0 {
 		return y
 	}
+	if err := ctx.allocPad(x, y); err != nil {
+		return Panicf("i!s : %v", err)
+	}
 	if x < 0 {
 		return divpad(-x, y)
 	}
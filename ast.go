@@ -15,6 +15,7 @@ type exprs []expr
 type astToken struct {
 	Type astTokenType
 	Pos  int
+	End  int
 	Text string
 }
 
@@ -37,6 +38,7 @@ const (
 type astReturn struct {
 	Expr    expr
 	OnError bool
+	Pos     int
 }
 
 // astLog represents a debugging \expr statement.
@@ -55,10 +57,12 @@ type astAssign struct {
 
 // astListAssign represents an assignment (x0;...):y.
 type astListAssign struct {
-	Names  []string // (x0;...)
-	Global bool     // whether :: or not
-	Right  expr     // y
-	Pos    int
+	Names   []string // (x0;...)
+	Global  bool     // whether :: or not
+	Right   expr     // y
+	Pos     int
+	ListPos int // position of (
+	ListEnd int // position after )
 }
 
 // astAssignOp represents a variable assignment with a built-in operator, of
@@ -80,6 +84,7 @@ type astAssignAmendOp struct {
 	Indices expr   // y
 	Right   expr   // z
 	Pos     int
+	EndPos  int // position after ]
 }
 
 // astAssinDeepAmendOp represents an assign-amend call with a built-in operator, of
@@ -104,6 +109,7 @@ type astStrand struct {
 type astQq struct {
 	Tokens []astToken
 	Pos    int
+	EndPos int
 }
 
 // astDerivedVerb represents a derived verb.
@@ -113,8 +119,9 @@ type astDerivedVerb struct {
 }
 
 type astParen struct {
-	Expr   expr // parenthesized sub-expressions
-	EndPos int
+	Expr     expr // parenthesized sub-expressions
+	StartPos int
+	EndPos   int
 }
 
 type astApply2 struct {
@@ -136,13 +143,15 @@ type astApplyN struct {
 }
 
 type astList struct {
-	Args   []expr
-	EndPos int
+	Args     []expr
+	StartPos int
+	EndPos   int
 }
 
 type astSeq struct {
-	Body   []expr
-	EndPos int
+	Body     []expr
+	StartPos int
+	EndPos   int
 }
 
 type astLambda struct {
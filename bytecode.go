@@ -0,0 +1,760 @@
+package goal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+)
+
+// compiledMagic is the header of files produced by CompileTo.
+const compiledMagic = "\x00goalbc"
+
+// compiledVersion is the version of the compiled format. It has to be
+// increased each time the format or the semantics of opcodes change.
+const compiledVersion = 4
+
+// maxCompiledLen is a sanity limit for lengths in compiled files.
+const maxCompiledLen = 1 << 28
+
+// constant tags in compiled files
+const (
+	bcInt byte = iota
+	bcFloat
+	bcString
+	bcRegexp
+	bcAB
+	bcAI
+	bcAF
+	bcAS
+	bcAV
+)
+
+// CompileTo writes to w a binary representation of the code compiled by the
+// last call to Compile, so that it can be loaded later with LoadCompiled
+// without scanning, parsing and compiling again. It should be called before
+// Run. The written code includes all the lambdas and constants known by the
+// context, as well as the names of the globals and variadics it uses, but not
+// the values of globals. Package-private globals are recorded as such, so that
+// they do not become accessible by name once loaded.
+func (ctx *Context) CompileTo(w io.Writer) error {
+	e := &bcEncoder{w: bufio.NewWriter(w)}
+	e.string(compiledMagic)
+	e.uint(compiledVersion)
+
+	// name tables
+	e.strings(ctx.variadicsNames)
+	e.strings(ctx.gNames)
+	e.ints(ctx.privateGlobals())
+	e.uint(uint64(len(ctx.gAssignLists)))
+	for _, ids := range ctx.gAssignLists {
+		e.ints(ids)
+	}
+
+	// constants (the first one is always the empty generic array)
+	e.uint(uint64(len(ctx.constants) - 1))
+	for _, x := range ctx.constants[1:] {
+		e.constant(x)
+	}
+
+	// lambdas
+	e.uint(uint64(len(ctx.lambdas)))
+	for _, lc := range ctx.lambdas {
+		e.opcodes(lc.Body)
+		e.ints(lc.Pos)
+		e.strings(lc.Names)
+		e.uint(uint64(lc.Rank))
+		e.string(lc.Source)
+		e.string(lc.Filename)
+		e.uint(uint64(lc.StartPos))
+		e.int32s(lc.UnusedArgs)
+		e.int32s(lc.UsedArgs)
+		e.uint(uint64(len(lc.AssignLists)))
+		for _, ids := range lc.AssignLists {
+			e.int32s(ids)
+		}
+		e.uint(uint64(lc.nVars))
+		e.int32s(lc.Captures)
+	}
+
+	// global code
+	e.opcodes(ctx.gCode.Body)
+	e.ints(ctx.gCode.Pos)
+	e.uint(uint64(ctx.gCode.last))
+	e.string(ctx.fname)
+	e.string(ctx.sources[ctx.fname])
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// LoadCompiled reads code written by CompileTo, so that it can then be
+// executed with Run, as if it had been produced by Compile. Variadics are
+// resolved by name, so that functions registered by the embedder with
+// RegisterMonad, RegisterDyad or RegisterFunc are available, provided they
+// were registered with the same names as in the context that compiled the
+// code. It returns an error if the code was produced by an incompatible
+// version of the interpreter, or if it is invalid: operands and stack usage
+// are checked, so that corrupted code cannot crash the interpreter.
+func (ctx *Context) LoadCompiled(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("LoadCompiled: %v", err)
+	}
+	d := &bcDecoder{r: bytes.NewReader(data)}
+	if magic := d.string(); d.err == nil && magic != compiledMagic {
+		return errors.New("LoadCompiled: not a compiled goal file")
+	}
+	if version := d.uint(); d.err == nil && version != compiledVersion {
+		return fmt.Errorf("LoadCompiled: unsupported version %d (expected %d)",
+			version, compiledVersion)
+	}
+	lf := &loadedFile{
+		vNames:   d.strings(),
+		gNames:   d.strings(),
+		gPrivate: d.ints(),
+	}
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		lf.gAssignLists = append(lf.gAssignLists, d.ints())
+	}
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		lf.constants = append(lf.constants, d.constant())
+	}
+	n = d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		lc := &lambdaCode{}
+		lc.Body = d.opcodes()
+		lc.Pos = d.ints()
+		lc.Names = d.strings()
+		lc.Rank = d.len()
+		lc.Source = d.string()
+		lc.Filename = d.string()
+		lc.StartPos = d.len()
+		lc.UnusedArgs = d.int32s()
+		lc.UsedArgs = d.int32s()
+		na := d.count()
+		for j := 0; j < na && d.err == nil; j++ {
+			lc.AssignLists = append(lc.AssignLists, d.int32s())
+		}
+		lc.nVars = d.len()
+		lc.Captures = d.int32s()
+		lf.lambdas = append(lf.lambdas, lc)
+	}
+	lf.body = d.opcodes()
+	lf.pos = d.ints()
+	lf.last = d.len()
+	lf.fname = d.string()
+	lf.source = d.string()
+	if d.err != nil {
+		if d.err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("LoadCompiled: %v", d.err)
+	}
+	err = ctx.link(lf)
+	if err != nil {
+		return fmt.Errorf("LoadCompiled: %v", err)
+	}
+	return nil
+}
+
+// loadedFile represents compiled code read by LoadCompiled.
+type loadedFile struct {
+	vNames       []string
+	gNames       []string
+	gPrivate     []int // ids of package-private globals
+	gAssignLists [][]int
+	constants    []V
+	lambdas      []*lambdaCode
+	body         []opcode
+	pos          []int
+	last         int
+	fname        string
+	source       string
+}
+
+// link integrates the loaded code into the context, relocating constants,
+// lambdas, globals and variadics. The context is only modified once the
+// whole code has been validated.
+func (ctx *Context) link(lf *loadedFile) error {
+	if len(lf.pos) != len(lf.body) || len(lf.body) > 0 && lf.last >= len(lf.body) {
+		return errors.New("invalid global code")
+	}
+	for _, lc := range lf.lambdas {
+		if len(lc.Pos) != len(lc.Body) || lc.nVars+lc.Rank != len(lc.Names) {
+			return errors.New("invalid lambda code")
+		}
+		for _, id := range lc.Captures {
+			if id < 0 || int(id) >= lc.nVars {
+				return errors.New("invalid lambda code")
+			}
+		}
+		for _, args := range [][]int32{lc.UnusedArgs, lc.UsedArgs} {
+			for _, i := range args {
+				if i < 0 || int(i) >= lc.Rank {
+					return errors.New("invalid lambda code")
+				}
+			}
+		}
+		for _, ids := range lc.AssignLists {
+			for _, id := range ids {
+				if id < 0 || int(id) >= len(lc.Names) {
+					return errors.New("invalid local in assignment list")
+				}
+			}
+		}
+	}
+	vmap := make([]opcode, len(lf.vNames))
+	for i, name := range lf.vNames {
+		v, ok := ctx.vNames[name]
+		if !ok {
+			v = -1 // error if actually used
+		}
+		vmap[i] = opcode(v)
+	}
+	private := make([]bool, len(lf.gNames))
+	for _, id := range lf.gPrivate {
+		if id < 0 || id >= len(private) {
+			return errors.New("invalid private global")
+		}
+		private[id] = true
+	}
+	gmap := make([]opcode, len(lf.gNames))
+	newIDs := map[string]int{}
+	var newNames []string
+	var newPrivate []bool
+	for i, name := range lf.gNames {
+		if private[i] {
+			// private globals are never shared by name
+			gmap[i] = opcode(len(ctx.gNames) + len(newNames))
+			newNames = append(newNames, name)
+			newPrivate = append(newPrivate, true)
+			continue
+		}
+		id, ok := ctx.gIDs[name]
+		if !ok {
+			id, ok = newIDs[name]
+		}
+		if !ok {
+			id = len(ctx.gNames) + len(newNames)
+			newIDs[name] = id
+			newNames = append(newNames, name)
+			newPrivate = append(newPrivate, false)
+		}
+		gmap[i] = opcode(id)
+	}
+	abase := len(ctx.gAssignLists)
+	for _, ids := range lf.gAssignLists {
+		for j, id := range ids {
+			if id < 0 || id >= len(gmap) {
+				return errors.New("invalid global in assignment list")
+			}
+			ids[j] = int(gmap[id])
+		}
+	}
+	cbase := len(ctx.constants) - 1
+	lbase := len(ctx.lambdas)
+	// reloc relocates the operands of ops, the body of lambda lc, or the
+	// global code if lc is nil.
+	reloc := func(ops []opcode, lc *lambdaCode) error {
+		for ip := 0; ip < len(ops); ip++ {
+			op := ops[ip]
+			if op < opNop || op > opTry || ip+op.argc() >= len(ops) {
+				return fmt.Errorf("invalid opcode at %d", ip)
+			}
+			if op.argc() == 0 {
+				continue
+			}
+			arg := &ops[ip+1]
+			switch op {
+			case opConst:
+				if *arg < 0 || int(*arg) > len(lf.constants) {
+					return fmt.Errorf("invalid constant at %d", ip)
+				}
+				if *arg > 0 {
+					*arg += opcode(cbase)
+				}
+			case opLambda, opClosure:
+				if *arg < 0 || int(*arg) >= len(lf.lambdas) {
+					return fmt.Errorf("invalid lambda at %d", ip)
+				}
+				*arg += opcode(lbase)
+			case opGlobal, opGlobalLast, opAssignGlobal, opApplyGlobal, opApplyNGlobal,
+				opTailApplyGlobal, opTailApplyNGlobal:
+				if *arg < 0 || int(*arg) >= len(gmap) {
+					return fmt.Errorf("invalid global at %d", ip)
+				}
+				*arg = gmap[*arg]
+			case opListAssignGlobal:
+				if *arg < 0 || int(*arg) >= len(lf.gAssignLists) {
+					return fmt.Errorf("invalid assignment list at %d", ip)
+				}
+				*arg += opcode(abase)
+			case opLocal, opLocalLast, opAssignLocal:
+				if lc == nil || *arg < 0 || int(*arg) >= len(lc.Names) {
+					return fmt.Errorf("invalid local at %d", ip)
+				}
+			case opListAssignLocal:
+				if lc == nil || *arg < 0 || int(*arg) >= len(lc.AssignLists) {
+					return fmt.Errorf("invalid assignment list at %d", ip)
+				}
+			case opJump, opJumpFalse, opJumpTrue:
+				// jumps are forward, with an offset relative to the
+				// operand's index
+				if *arg < 1 || ip+1+int(*arg) > len(ops) {
+					return fmt.Errorf("invalid jump at %d", ip)
+				}
+			case opVariadic, opApplyV, opApply2V, opApplyNV, opDerive:
+				if *arg < 0 || int(*arg) >= len(vmap) {
+					return fmt.Errorf("invalid variadic at %d", ip)
+				}
+				if vmap[*arg] < 0 {
+					return fmt.Errorf("unknown variadic: %s", lf.vNames[*arg])
+				}
+				*arg = vmap[*arg]
+			}
+			ip += op.argc()
+		}
+		return nil
+	}
+	for _, lc := range lf.lambdas {
+		if err := reloc(lc.Body, lc); err != nil {
+			return err
+		}
+	}
+	if err := reloc(lf.body, nil); err != nil {
+		return err
+	}
+	captures := func(id opcode) int {
+		if int(id) < lbase {
+			return len(ctx.lambdas[id].Captures)
+		}
+		return len(lf.lambdas[int(id)-lbase].Captures)
+	}
+	for _, lc := range lf.lambdas {
+		if err := checkStack(lc.Body, true, captures); err != nil {
+			return err
+		}
+	}
+	if err := checkStack(lf.body, false, captures); err != nil {
+		return err
+	}
+	for _, x := range lf.constants {
+		x.MarkImmutable()
+	}
+	for i, name := range newNames {
+		if !newPrivate[i] {
+			ctx.gIDs[name] = len(ctx.gNames)
+		}
+		ctx.gNames = append(ctx.gNames, name)
+		ctx.globals = append(ctx.globals, V{})
+	}
+	ctx.gAssignLists = append(ctx.gAssignLists, lf.gAssignLists...)
+	ctx.constants = append(ctx.constants, lf.constants...)
+	ctx.lambdas = append(ctx.lambdas, lf.lambdas...)
+	ctx.gCode.Body = lf.body
+	ctx.gCode.Pos = lf.pos
+	ctx.gCode.last = lf.last
+	ctx.fname = lf.fname
+	if _, ok := ctx.sources[lf.fname]; !ok {
+		ctx.sources[lf.fname] = lf.source
+	}
+	if len(lf.body) > 0 {
+		ctx.checkAssign()
+	}
+	return nil
+}
+
+type bcEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *bcEncoder) uint(n uint64) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(e.buf[:binary.PutUvarint(e.buf[:], n)])
+}
+
+func (e *bcEncoder) int(n int64) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(e.buf[:binary.PutVarint(e.buf[:], n)])
+}
+
+func (e *bcEncoder) byte(b byte) {
+	if e.err != nil {
+		return
+	}
+	e.err = e.w.WriteByte(b)
+}
+
+func (e *bcEncoder) string(s string) {
+	e.uint(uint64(len(s)))
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.WriteString(s)
+}
+
+func (e *bcEncoder) strings(s []string) {
+	e.uint(uint64(len(s)))
+	for _, si := range s {
+		e.string(si)
+	}
+}
+
+func (e *bcEncoder) ints(x []int) {
+	e.uint(uint64(len(x)))
+	for _, xi := range x {
+		e.int(int64(xi))
+	}
+}
+
+func (e *bcEncoder) int32s(x []int32) {
+	e.uint(uint64(len(x)))
+	for _, xi := range x {
+		e.int(int64(xi))
+	}
+}
+
+func (e *bcEncoder) opcodes(x []opcode) {
+	e.uint(uint64(len(x)))
+	for _, xi := range x {
+		e.int(int64(xi))
+	}
+}
+
+func (e *bcEncoder) constant(x V) {
+	switch x.kind {
+	case valInt:
+		e.byte(bcInt)
+		e.int(x.I())
+		return
+	case valFloat:
+		e.byte(bcFloat)
+		e.uint(math.Float64bits(x.F()))
+		return
+	}
+	switch xv := x.bv.(type) {
+	case S:
+		e.byte(bcString)
+		e.string(string(xv))
+	case *rx:
+		e.byte(bcRegexp)
+		e.string(xv.Regexp.String())
+	case *AB:
+		e.byte(bcAB)
+		e.uint(uint64(xv.flags))
+		e.string(string(xv.elts))
+	case *AI:
+		e.byte(bcAI)
+		e.uint(uint64(xv.flags))
+		e.uint(uint64(len(xv.elts)))
+		for _, xi := range xv.elts {
+			e.int(xi)
+		}
+	case *AF:
+		e.byte(bcAF)
+		e.uint(uint64(xv.flags))
+		e.uint(uint64(len(xv.elts)))
+		for _, xi := range xv.elts {
+			e.uint(math.Float64bits(xi))
+		}
+	case *AS:
+		e.byte(bcAS)
+		e.uint(uint64(xv.flags))
+		e.strings(xv.elts)
+	case *AV:
+		e.byte(bcAV)
+		e.uint(uint64(xv.flags))
+		e.uint(uint64(len(xv.elts)))
+		for _, xi := range xv.elts {
+			e.constant(xi)
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("CompileTo: unsupported constant of type \"%s\"", x.Type())
+		}
+	}
+}
+
+type bcDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *bcDecoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var n uint64
+	n, d.err = binary.ReadUvarint(d.r)
+	return n
+}
+
+func (d *bcDecoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var n int64
+	n, d.err = binary.ReadVarint(d.r)
+	return n
+}
+
+func (d *bcDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+// len reads a non-negative integer, like a length, checking it against
+// maxCompiledLen.
+func (d *bcDecoder) len() int {
+	n := d.uint()
+	if n > maxCompiledLen {
+		if d.err == nil {
+			d.err = fmt.Errorf("length too big (%d)", n)
+		}
+		return 0
+	}
+	return int(n)
+}
+
+// count reads the number of elements of a sequence, checking that the
+// remaining input is big enough to hold them, as each element takes at least
+// one byte.
+func (d *bcDecoder) count() int {
+	n := d.len()
+	if n > d.r.Len() {
+		if d.err == nil {
+			d.err = fmt.Errorf("length too big (%d)", n)
+		}
+		return 0
+	}
+	return n
+}
+
+func (d *bcDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return string(b)
+}
+
+func (d *bcDecoder) strings() []string {
+	n := d.count()
+	var r []string
+	for i := 0; i < n && d.err == nil; i++ {
+		r = append(r, d.string())
+	}
+	return r
+}
+
+func (d *bcDecoder) ints() []int {
+	n := d.count()
+	var r []int
+	for i := 0; i < n && d.err == nil; i++ {
+		r = append(r, int(d.int()))
+	}
+	return r
+}
+
+func (d *bcDecoder) int32s() []int32 {
+	n := d.count()
+	var r []int32
+	for i := 0; i < n && d.err == nil; i++ {
+		r = append(r, int32(d.int()))
+	}
+	return r
+}
+
+func (d *bcDecoder) opcodes() []opcode {
+	n := d.count()
+	var r []opcode
+	for i := 0; i < n && d.err == nil; i++ {
+		r = append(r, opcode(d.int()))
+	}
+	return r
+}
+
+func (d *bcDecoder) constant() V {
+	tag := d.byte()
+	if d.err != nil {
+		return V{}
+	}
+	switch tag {
+	case bcInt:
+		return NewI(d.int())
+	case bcFloat:
+		return NewF(math.Float64frombits(d.uint()))
+	case bcString:
+		return NewS(d.string())
+	case bcRegexp:
+		s := d.string()
+		r, err := regexp.Compile(s)
+		if err != nil {
+			if d.err == nil {
+				d.err = err
+			}
+			return V{}
+		}
+		return NewV(&rx{Regexp: r})
+	case bcAB:
+		f := flags(d.uint())
+		return NewV(&AB{flags: f, elts: []byte(d.string())})
+	case bcAI:
+		f := flags(d.uint())
+		n := d.count()
+		var r []int64
+		for i := 0; i < n && d.err == nil; i++ {
+			r = append(r, d.int())
+		}
+		return NewV(&AI{flags: f, elts: r})
+	case bcAF:
+		f := flags(d.uint())
+		n := d.count()
+		var r []float64
+		for i := 0; i < n && d.err == nil; i++ {
+			r = append(r, math.Float64frombits(d.uint()))
+		}
+		return NewV(&AF{flags: f, elts: r})
+	case bcAS:
+		f := flags(d.uint())
+		return NewV(&AS{flags: f, elts: d.strings()})
+	case bcAV:
+		f := flags(d.uint())
+		n := d.count()
+		var r []V
+		for i := 0; i < n && d.err == nil; i++ {
+			xi := d.constant()
+			xi.MarkImmutable()
+			r = append(r, xi)
+		}
+		return NewV(&AV{flags: f, elts: r})
+	default:
+		d.err = fmt.Errorf("invalid constant tag (%d)", tag)
+		return V{}
+	}
+}
+
+// checkStack verifies that ops, the body of a lambda if lambda is true, uses
+// the stack consistently: each opcode finds the values it needs above the
+// current frame, the stack depth is the same for all paths reaching a given
+// opcode, jumps land on opcodes, and the code ends with a result on the
+// stack. The operands of ops should have already been validated. The captures function
+// returns the number of captured values of the lambda with the given id.
+func checkStack(ops []opcode, lambda bool, captures func(opcode) int) error {
+	starts := make([]bool, len(ops)+1) // opcode boundaries
+	for ip := 0; ip < len(ops); ip += 1 + ops[ip].argc() {
+		starts[ip] = true
+	}
+	starts[len(ops)] = true
+	depths := make([]int, len(ops)+1) // depth+1 at each opcode, or 0 if unknown
+	todo := []int{0}
+	depths[0] = 1
+	setDepth := func(ip, depth int) error {
+		if !starts[ip] {
+			return fmt.Errorf("invalid jump target %d", ip)
+		}
+		switch depths[ip] {
+		case 0:
+			depths[ip] = depth + 1
+			todo = append(todo, ip)
+		case depth + 1:
+		default:
+			return fmt.Errorf("inconsistent stack at %d", ip)
+		}
+		return nil
+	}
+	end := func(depth int) error {
+		if depth < 1 || lambda && depth != 1 {
+			return errors.New("invalid stack at return")
+		}
+		return nil
+	}
+	for len(todo) > 0 {
+		ip := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		depth := depths[ip] - 1
+		if ip == len(ops) {
+			if err := end(depth); err != nil {
+				return err
+			}
+			continue
+		}
+		op := ops[ip]
+		need, delta := 0, 0
+		switch op {
+		case opNil, opConst, opInt, opVariadic, opLambda, opGlobal, opGlobalLast, opLocal, opLocalLast:
+			delta = 1
+		case opClosure:
+			n := captures(ops[ip+1])
+			need, delta = n, 1-n
+		case opAssignLocal, opAssignGlobal, opListAssignLocal, opListAssignGlobal,
+			opApplyV, opApplyGlobal, opTailApplyGlobal, opDerive, opJumpFalse, opJumpTrue:
+			need = 1
+		case opApply, opTailApply, opApply2V:
+			need, delta = 2, -1
+		case opApply2, opTailApply2:
+			need, delta = 3, -2
+		case opApplyN, opTailApplyN:
+			n := int(ops[ip+1])
+			if n < 1 {
+				return fmt.Errorf("invalid argument count at %d", ip)
+			}
+			need, delta = n+1, -n
+		case opApplyNV, opApplyNGlobal, opTailApplyNGlobal:
+			n := int(ops[ip+2])
+			if n < 1 {
+				return fmt.Errorf("invalid argument count at %d", ip)
+			}
+			need, delta = n, 1-n
+		case opDrop:
+			need, delta = 1, -1
+		case opReturn:
+			if err := end(depth); err != nil {
+				return err
+			}
+			continue
+		case opTry:
+			if err := end(depth); err != nil {
+				return err
+			}
+		}
+		if depth < need {
+			return fmt.Errorf("invalid stack at %d", ip)
+		}
+		depth += delta
+		next := ip + 1 + op.argc()
+		switch op {
+		case opJump, opJumpFalse, opJumpTrue:
+			if err := setDepth(ip+1+int(ops[ip+1]), depth); err != nil {
+				return err
+			}
+			if op == opJump {
+				continue
+			}
+		}
+		if err := setDepth(next, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -96,6 +96,14 @@ func (p *projectionMonad) Clone() BV {
 	return p
 }
 
+func (cl *closure) Clone() BV {
+	ncl := &closure{Fun: cl.Fun, Env: make([]V, len(cl.Env))}
+	for i, x := range cl.Env {
+		ncl.Env[i] = x.Clone()
+	}
+	return ncl
+}
+
 func (r *derivedVerb) Clone() BV {
 	if r.Arg.HasRC() {
 		return &derivedVerb{Fun: r.Fun, Arg: r.Arg.Clone()}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+// awkOptions describes the options of the line-oriented awk mode.
+type awkOptions struct {
+	print bool   // print each result (-p)
+	sep   string // field separator (-F), blanks if empty
+	begin string // command run before reading input
+	end   string // command run after reading input
+}
+
+// runAwk runs the program source with location loc for each line of the
+// given input files, or standard input if none, and returns the exit status.
+// The current line, its fields and its number are assigned to the L, F and
+// NR globals.
+func runAwk(ctx *goal.Context, cfg Config, opts awkOptions, loc, source string, files []string) int {
+	out := bufio.NewWriter(gos.Stdout(ctx))
+	ostdout := ctx.Stdout
+	ctx.Stdout = out
+	defer func() {
+		out.Flush()
+		ctx.Stdout = ostdout
+	}()
+	fail := func(err error) int {
+		out.Flush()
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	nr := 0
+	ctx.AssignGlobal("NR", goal.NewI(0))
+	ctx.AssignGlobal("L", goal.NewS(""))
+	ctx.AssignGlobal("F", goal.NewAS(nil))
+	if opts.begin != "" {
+		if st := runAwkCommand(ctx, cfg, out, opts.begin); st != 0 {
+			return st
+		}
+	}
+	p, err := ctx.CompileProgram(loc, source)
+	if err != nil {
+		return fail(err)
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, fname := range files {
+		var err error
+		if fname == "-" {
+			err = awkInput(ctx, opts, p, out, gos.Stdin(ctx), &nr)
+		} else {
+			var f *os.File
+			f, err = os.Open(fname)
+			if err == nil {
+				err = awkInput(ctx, opts, p, out, f, &nr)
+				f.Close()
+			}
+		}
+		if err == errAwkValue {
+			return 1
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if opts.end != "" {
+		return runAwkCommand(ctx, cfg, out, opts.end)
+	}
+	return 0
+}
+
+// errAwkValue is returned by awkInput when the program returns an error
+// value, already reported.
+var errAwkValue = errors.New("error value")
+
+// awkInput runs program p for each line read from r, counting lines in nr.
+// Line endings, either "\n" or "\r\n", are not part of the line.
+func awkInput(ctx *goal.Context, opts awkOptions, p *goal.Program, out *bufio.Writer, r io.Reader, nr *int) error {
+	br := bufio.NewReader(r)
+	for {
+		if br.Buffered() == 0 {
+			// flush before possibly blocking
+			out.Flush()
+		}
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		*nr++
+		ctx.AssignGlobal("NR", goal.NewI(int64(*nr)))
+		ctx.AssignGlobal("L", goal.NewS(line))
+		ctx.AssignGlobal("F", goal.NewAS(splitFields(line, opts.sep)))
+		x, err := ctx.RunProgram(p)
+		if err != nil {
+			return err
+		}
+		if x.IsError() {
+			out.Flush()
+			warn(ctx, x)
+			return errAwkValue
+		}
+		if opts.print {
+			writeLine(ctx, out, x)
+		}
+	}
+}
+
+// runAwkCommand runs a begin or end command, and returns the exit status.
+func runAwkCommand(ctx *goal.Context, cfg Config, out *bufio.Writer, cmd string) int {
+	r, err := ctx.Eval(cmd)
+	if err == nil && !r.IsError() {
+		return 0
+	}
+	out.Flush()
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+	} else {
+		warn(ctx, r)
+	}
+	return 1
+}
+
+// unescapeSep interprets backslash escapes in a -F separator, like \t, with
+// the same syntax as in Go string literals.
+func unescapeSep(sep string) (string, error) {
+	var sb strings.Builder
+	for s := sep; s != ""; {
+		r, _, tail, err := strconv.UnquoteChar(s, 0)
+		if err != nil {
+			return "", fmt.Errorf("-F: invalid escape in separator: %s", sep)
+		}
+		sb.WriteRune(r)
+		s = tail
+	}
+	return sb.String(), nil
+}
+
+// splitFields splits a line into fields separated by sep, or by blanks if
+// sep is empty.
+func splitFields(line, sep string) []string {
+	if sep == "" {
+		return strings.Fields(line)
+	}
+	return strings.Split(line, sep)
+}
+
+// writeLine writes x followed by a newline, like say: strings are written
+// as is, and string arrays with elements separated by ctx.OFS.
+func writeLine(ctx *goal.Context, w *bufio.Writer, x goal.V) {
+	switch xv := x.BV().(type) {
+	case goal.S:
+		w.WriteString(string(xv))
+	case *goal.AS:
+		w.WriteString(strings.Join(xv.Slice(), ctx.OFS))
+	default:
+		w.Write(x.Append(ctx, nil))
+	}
+	w.WriteByte('\n')
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+func TestAwk(t *testing.T) {
+	tests := []struct {
+		Opts   awkOptions
+		Source string
+		Input  string
+		Output string
+	}{
+		{awkOptions{print: true}, `F`, "a b\n c  d \n", "a b\nc d\n"},
+		{awkOptions{print: true, sep: ","}, `|F`, "a,b\r\nc,d\r\n", "b a\nd c\n"},
+		{awkOptions{print: true}, `L`, "ab\r\nc", "ab\nc\n"},
+		{awkOptions{print: true, sep: "\t"}, `F 1`, "a b\tc\n", "c\n"},
+		{awkOptions{begin: `n:0`, end: `say n`}, `n+:NR`, "x\ny\nz\n", "6\n"},
+	}
+	for _, test := range tests {
+		ctx := goal.NewContext()
+		ctx.RegisterDyad("say", gos.VFSay)
+		var out bytes.Buffer
+		ctx.Stdin = strings.NewReader(test.Input)
+		ctx.Stdout = &out
+		if st := runAwk(ctx, Config{}, test.Opts, "", test.Source, nil); st != 0 {
+			t.Errorf("%s: exit status %d", test.Source, st)
+		}
+		if out.String() != test.Output {
+			t.Errorf("%s: got %q, expected %q", test.Source, out.String(), test.Output)
+		}
+	}
+}
+
+func TestUnescapeSep(t *testing.T) {
+	tests := []struct {
+		Sep  string
+		Want string
+		Err  bool
+	}{
+		{``, "", false},
+		{`,`, ",", false},
+		{`\t`, "\t", false},
+		{`a\tb`, "a\tb", false},
+		{`\\`, `\`, false},
+		{`\x1f`, "\x1f", false},
+		{`é\u00e9`, "éé", false},
+		{`\`, "", true},
+		{`\q`, "", true},
+	}
+	for _, test := range tests {
+		got, err := unescapeSep(test.Sep)
+		if test.Err {
+			if err == nil {
+				t.Errorf("%q: no error", test.Sep)
+			}
+			continue
+		}
+		if err != nil || got != test.Want {
+			t.Errorf("%q: got %q (%v), expected %q", test.Sep, got, err, test.Want)
+		}
+	}
+}
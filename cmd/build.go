@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+// runBuild runs the build subcommand with the given arguments, and returns
+// the exit status.
+func runBuild(ctx *goal.Context, cfg Config, args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	optO := fs.String("o", "", "write executable to `file` (default: script name without extension)")
+	fs.SetOutput(gos.Stderr(ctx))
+	fs.Usage = func() {
+		fmt.Fprintf(gos.Stderr(ctx), "Usage: %s build [-o file] script\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	script, rest := fs.Arg(0), fs.Args()
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+	// allow flags after the script too, as in build script.goal -o tool
+	if err := fs.Parse(rest); err != nil {
+		return 2
+	}
+	if script == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	out := *optO
+	if out == "" {
+		out = strings.TrimSuffix(filepath.Base(script), filepath.Ext(script))
+		if runtime.GOOS == "windows" {
+			out += ".exe"
+		}
+	}
+	files, err := bundleFiles(ctx, script)
+	if err == nil {
+		err = writeBundle(out, files)
+	}
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: build: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	return 0
+}
+
+// bundleFile represents a file to bundle.
+type bundleFile struct {
+	path   string // path within the archive
+	fpath  string // file path
+	source string
+}
+
+// bundleFiles returns the files to bundle with script: the script itself,
+// first, and the modules it imports transitively with constant names. An
+// imported module is searched relative to the importing file's directory,
+// then the current directory and GOALLIB. Its path within the archive is
+// relative to the importing module's one in the first case, so that the
+// import finds it in the same way at run time.
+func bundleFiles(ctx *goal.Context, script string) ([]bundleFile, error) {
+	source, err := readScript(script)
+	if err != nil {
+		return nil, err
+	}
+	files := []bundleFile{{path: filepath.Base(script), fpath: script, source: source}}
+	seen := map[string]string{files[0].path: script} // archive path: file path
+	for i := 0; i < len(files); i++ {
+		bf := files[i]
+		pf, err := ctx.Parse(bf.fpath, bf.source)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range collectImports(pf) {
+			fname := name
+			if filepath.Ext(fname) == "" {
+				fname += ".goal"
+			}
+			p, fpath, err := resolveImport(bf, fname)
+			if err != nil {
+				return nil, fmt.Errorf("%s: import %q: %v", bf.fpath, name, err)
+			}
+			if prev, ok := seen[p]; ok {
+				if !sameFile(prev, fpath) {
+					return nil, fmt.Errorf("%s: import %q: %s conflicts with %s", bf.fpath, name, fpath, prev)
+				}
+				continue
+			}
+			seen[p] = fpath
+			bs, err := os.ReadFile(fpath)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, bundleFile{path: p, fpath: fpath, source: string(bs)})
+		}
+	}
+	return files, nil
+}
+
+// resolveImport returns the archive path and file path of module fname
+// imported by bf.
+func resolveImport(bf bundleFile, fname string) (string, string, error) {
+	if filepath.IsAbs(fname) {
+		return "", "", fmt.Errorf("cannot bundle absolute path")
+	}
+	p := path.Join(path.Dir(bf.path), filepath.ToSlash(fname))
+	fpath := filepath.Join(filepath.Dir(bf.fpath), fname)
+	if !isRegular(fpath) {
+		p = path.Clean(filepath.ToSlash(fname))
+		fpath = ""
+		dirs := []string{"."}
+		if goalLIB, ok := os.LookupEnv("GOALLIB"); ok {
+			sep := ":"
+			if runtime.GOOS == "windows" {
+				sep = ";"
+			}
+			dirs = append(dirs, strings.Split(goalLIB, sep)...)
+		}
+		for _, dir := range dirs {
+			if fp := filepath.Join(dir, fname); isRegular(fp) {
+				fpath = fp
+				break
+			}
+		}
+		if fpath == "" {
+			return "", "", os.ErrNotExist
+		}
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", "", fmt.Errorf("cannot bundle path outside of script directory")
+	}
+	return p, fpath, nil
+}
+
+func isRegular(fpath string) bool {
+	fi, err := os.Stat(fpath)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func sameFile(f1, f2 string) bool {
+	fi1, err1 := os.Stat(f1)
+	fi2, err2 := os.Stat(f2)
+	return err1 == nil && err2 == nil && os.SameFile(fi1, fi2)
+}
+
+// collectImports returns the constant names of imported modules in a syntax
+// tree.
+func collectImports(f *goal.File) []string {
+	var names []string
+	goal.Inspect(f, func(n goal.Node) bool {
+		switch n := n.(type) {
+		case *goal.Exprs:
+			for i := 0; i+1 < len(n.List); i++ {
+				if isImportVerb(n.List[i]) {
+					names = append(names, constStrings(n.List[i+1])...)
+				}
+			}
+		case *goal.CallExpr:
+			if isImportVerb(n.Fun) && len(n.Args) > 0 {
+				names = append(names, constStrings(n.Args[len(n.Args)-1])...)
+			}
+		case *goal.BinaryExpr:
+			if isImportVerb(n.Verb) {
+				names = append(names, constStrings(n.Right)...)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+func isImportVerb(e goal.Expr) bool {
+	v, ok := e.(*goal.Verb)
+	return ok && v.Name == "import"
+}
+
+// constStrings returns the values of e, if it is a constant string, or a
+// strand or list of constant strings.
+func constStrings(e goal.Expr) []string {
+	switch e := e.(type) {
+	case *goal.Exprs:
+		if len(e.List) == 1 {
+			return constStrings(e.List[0])
+		}
+	case *goal.Lit:
+		if e.Kind != goal.STRING {
+			return nil
+		}
+		if strings.HasPrefix(e.Value, "rq") && len(e.Value) >= 4 {
+			return []string{e.Value[3 : len(e.Value)-1]}
+		}
+		if s, err := strconv.Unquote(e.Value); err == nil {
+			return []string{s}
+		}
+	case *goal.Strand:
+		var r []string
+		for _, item := range e.Items {
+			r = append(r, constStrings(item)...)
+		}
+		return r
+	case *goal.ListExpr:
+		var r []string
+		for _, item := range e.Items {
+			r = append(r, constStrings(item)...)
+		}
+		return r
+	}
+	return nil
+}
+
+// writeBundle writes to out a copy of the running executable, without any
+// bundle, followed by a bundle made of the given files, the first one being
+// the main script.
+func writeBundle(out string, files []bundleFile) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if sameFile(exe, out) {
+		return fmt.Errorf("cannot overwrite running executable %s", out)
+	}
+	ef, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer ef.Close()
+	offset, _, err := bundleOffset(ef)
+	if err != nil {
+		return err
+	}
+	of, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	err = copyBundle(of, ef, offset, files)
+	if cerr := of.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+	}
+	return err
+}
+
+// copyBundle writes the first offset bytes of exe to w, followed by the
+// bundle of the given files.
+func copyBundle(w io.Writer, exe io.Reader, offset int64, files []bundleFile) error {
+	bw := bufio.NewWriter(w)
+	if _, err := io.CopyN(bw, exe, offset); err != nil {
+		return err
+	}
+	cw := &countWriter{w: bw}
+	zw := zip.NewWriter(cw)
+	for _, bf := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: bf.path, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, bf.source); err != nil {
+			return err
+		}
+	}
+	if err := zw.SetComment(files[0].path); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	var trailer [bundleTrailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[:8], uint64(cw.n))
+	copy(trailer[8:], bundleMagic)
+	if _, err := bw.Write(trailer[:]); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+func newBuildContext() *goal.Context {
+	ctx := goal.NewContext()
+	ctx.RegisterDyad("import", gos.VFImport)
+	return ctx
+}
+
+func TestCollectImports(t *testing.T) {
+	ctx := newBuildContext()
+	src := `import "a"; "x" import "b"; import["c"]; import "d" "e"; ("f" "g")import "h"
+{import rq/i/}; import x; import "j","k"`
+	pf, err := ctx.Parse("t.goal", src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := fmt.Sprint(collectImports(pf))
+	if want := "[a b c d e h i]"; got != want {
+		t.Errorf("collectImports: got %s, expected %s", got, want)
+	}
+}
+
+func TestBundleFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.goal":        "import \"lib/a\"\na.f 1",
+		"lib/a.goal":       "import \"b\"\nf:{b.g x}",
+		"lib/b.goal":       "g:{2*x}",
+		"bad/up.goal":      "import \"../lib/b\"",
+		"bad/missing.goal": "import \"none\"",
+		"bad/parse.goal":   "(1",
+	}
+	for name, src := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := newBuildContext()
+	bfs, err := bundleFiles(ctx, filepath.Join(dir, "main.goal"))
+	if err != nil {
+		t.Fatalf("bundleFiles: %v", err)
+	}
+	var paths []string
+	for _, bf := range bfs {
+		paths = append(paths, bf.path)
+		if bf.source != files[bf.path] {
+			t.Errorf("%s: bad source %q", bf.path, bf.source)
+		}
+	}
+	if got, want := fmt.Sprint(paths), "[main.goal lib/a.goal lib/b.goal]"; got != want {
+		t.Errorf("bundleFiles: got %s, expected %s", got, want)
+	}
+	errs := map[string]string{
+		"bad/up.goal":      "outside of script directory",
+		"bad/missing.goal": `import "none"`,
+		"bad/parse.goal":   "parse.goal",
+	}
+	for name, msg := range errs {
+		_, err := bundleFiles(ctx, filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: bad error: %v", name, err)
+		}
+	}
+}
+
+func TestBundleOffset(t *testing.T) {
+	exe := "not really an executable"
+	var buf bytes.Buffer
+	bfs := []bundleFile{{path: "main.goal", source: "1+1"}, {path: "lib/a.goal", source: "f:{x}"}}
+	if err := copyBundle(&buf, strings.NewReader(exe), int64(len(exe)), bfs); err != nil {
+		t.Fatalf("copyBundle: %v", err)
+	}
+	bundled := buf.String()
+	trailer := func(n uint64) string {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], n)
+		return string(b[:]) + bundleMagic
+	}
+	tests := []struct {
+		Name    string
+		Content string
+		Offset  int64
+		Err     bool
+	}{
+		{"bundled", bundled, int64(len(exe)), false},
+		{"plain", exe, int64(len(exe)), false},
+		{"short", "abc", 3, false},
+		{"empty", "", 0, false},
+		{"truncated", bundled[:len(bundled)-1], int64(len(bundled) - 1), false},
+		{"only trailer", trailer(0), 0, true},
+		{"zero length", exe + trailer(0), 0, true},
+		{"too long", exe + trailer(uint64(len(exe)+1)), 0, true},
+		{"negative", exe + trailer(1<<63), 0, true},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		fpath := filepath.Join(dir, fmt.Sprintf("exe%d", i))
+		if err := os.WriteFile(fpath, []byte(test.Content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, n, err := bundleOffset(f)
+		f.Close()
+		if test.Err {
+			if err == nil {
+				t.Errorf("%s: no error", test.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.Name, err)
+			continue
+		}
+		if offset != test.Offset {
+			t.Errorf("%s: got offset %d, expected %d", test.Name, offset, test.Offset)
+		}
+		if test.Name != "bundled" {
+			if n != 0 {
+				t.Errorf("%s: got bundle size %d", test.Name, n)
+			}
+			continue
+		}
+		if want := int64(len(bundled) - len(exe) - bundleTrailerSize); n != want {
+			t.Errorf("%s: got bundle size %d, expected %d", test.Name, n, want)
+		}
+		zr, err := zip.NewReader(strings.NewReader(bundled[offset:offset+n]), n)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if zr.Comment != "main.goal" {
+			t.Errorf("%s: bad main script %q", test.Name, zr.Comment)
+		}
+		for _, bf := range bfs {
+			if s, err := readBundleFile(zr, bf.path); err != nil || s != bf.source {
+				t.Errorf("%s: %s: got %q (%v)", test.Name, bf.path, s, err)
+			}
+		}
+	}
+}
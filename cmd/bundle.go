@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+// A bundle is a zip archive appended to an executable, followed by a
+// trailer made of the archive's length, as a little-endian uint64, and
+// bundleMagic. The archive's comment is the path of the main script within
+// the archive.
+const bundleMagic = "goalbndl"
+
+const bundleTrailerSize = 8 + len(bundleMagic)
+
+// bundleOffset returns the size of f without any appended bundle, and the
+// size of the bundle's archive, which is zero if there is none.
+func bundleOffset(f *os.File) (int64, int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := fi.Size()
+	if size < int64(bundleTrailerSize) {
+		return size, 0, nil
+	}
+	var trailer [bundleTrailerSize]byte
+	if _, err := f.ReadAt(trailer[:], size-int64(bundleTrailerSize)); err != nil {
+		return 0, 0, err
+	}
+	if string(trailer[8:]) != bundleMagic {
+		return size, 0, nil
+	}
+	n := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	offset := size - int64(bundleTrailerSize) - n
+	if n <= 0 || offset < 0 {
+		return 0, 0, errors.New("invalid bundle trailer")
+	}
+	return offset, n, nil
+}
+
+// openBundle returns the archive bundled with the running executable, or nil
+// if there is none.
+func openBundle() (*zip.Reader, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, nil
+	}
+	offset, n, err := bundleOffset(f)
+	if err != nil || n == 0 {
+		f.Close()
+		return nil, err
+	}
+	// f stays open, as files are read lazily from the archive.
+	return zip.NewReader(io.NewSectionReader(f, offset, n), n)
+}
+
+// runBundle runs the main script of a bundle archive, with all the command
+// line arguments passed to the script, and returns the exit status. Modules
+// are imported from the archive first.
+func runBundle(ctx *goal.Context, cfg Config, zr *zip.Reader) int {
+	fname := zr.Comment
+	source, err := readBundleFile(zr, fname)
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: bundle: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	if _, vf := ctx.GetVariadic("import"); vf != nil {
+		ctx.Override("import", gos.ImportFSFirst(zr))
+	}
+	ctx.AssignGlobal("ARGS", goal.NewAS(os.Args))
+	if err := ctx.Compile(fname, stripShebang(source)); err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	r, err := ctx.Run()
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	if r.IsError() {
+		warn(ctx, r)
+		return 1
+	}
+	return 0
+}
+
+func readBundleFile(zr *zip.Reader, fname string) (string, error) {
+	f, err := zr.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var sb strings.Builder
+	_, err = io.Copy(&sb, f)
+	return sb.String(), err
+}
@@ -4,13 +4,17 @@ package cmd
 import (
 	"bufio"
 	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime/debug"
 	"runtime/pprof"
 	"strings"
+	"time"
 )
 
 // Config describes the possible configuration options when running a
@@ -19,95 +23,308 @@ type Config struct {
 	Help        func() map[string]string
 	ProgramName string
 	Man         string
+
+	// MetaCommands are additional repl meta-commands by name, which take
+	// precedence over builtin ones.
+	MetaCommands map[string]MetaCommand
 }
 
 // Cmd runs a goal interpreter with starting context ctx and the given help
 // strings when using the repl. Command line usage is then as follows:
 //
-//	program-name [-e command] [-d] [path]
+//	program-name [-e command] [-d] [-debug] [-goalprofile file] [-now time] [path]
+//
+// With -debug, the command or script is run in a step debugger, reading
+// debugger commands from standard input. With -goalprofile, a profile of the
+// goal code being run is written to file in pprof format, even if it fails.
+// Code run by a nested rt.prof is not sampled individually in that profile:
+// its time is attributed to the line calling rt.prof.
+//
+// With -now, time builtins use the given fixed RFC3339 time as current time,
+// so that scripts can be replayed deterministically.
+//
+// Standard input, output and error streams are taken from the context's
+// Stdin, Stdout and Stderr fields, if non-nil.
+//
+// When standard input and output are terminals, the repl provides line
+// editing with history saved in ~/.goal_history, reverse search with Ctrl-R,
+// and completion with Tab of globals, keywords and builtins, or help topics
+// after a double quote. Otherwise, lines are read as is.
+//
+// The repl also handles the following meta-commands, on a line of their own,
+// as well as additional ones provided in cfg:
+//
+//	\t[:n] expr  time evaluation of expr (average of n runs)
+//	\l file      load file
+//	\v [prefix]  list global variables with types and lengths
+//	\c expr      show compiled instructions of expr
+//	\w name      show which help topics document name
+//	\q           quit
+//	\?           list meta-commands
+//
+// Other lines starting with a backslash are evaluated as usual.
+//
+// With -n, the command or script is run for each line of the input files
+// following it, or standard input if none, which is read as a stream. The
+// current line is assigned to global L, its fields, as split by the -F
+// separator or blanks, to global F, as a string array, and its line number
+// to global NR. The -F separator may contain escapes like \t, as in Go string
+// literals. With -p, each result is also printed like with say, so that
+// string arrays have elements separated by the current output field
+// separator (see rt.ofs). The -begin and -end commands are run before and
+// after reading input.
+//
+// Source files can be reformatted in canonical style with the fmt subcommand:
+//
+//	program-name fmt [-check] [-l] [-w] [path ...]
+//
+// Without paths, it formats standard input. With -l, it lists files whose
+// formatting differs, and with -w, it writes the result back to the files
+// instead of standard output. With -check, it exits with non-zero status if
+// some file is not formatted.
+//
+// Source files can be checked for likely mistakes, as reported by
+// Context.Lint, with the vet subcommand:
+//
+//	program-name vet [path ...]
+//
+// Without paths, it checks standard input. It exits with non-zero status if
+// some problem was found.
+//
+// Test files with names ending in _test.goal, as described in package
+// goaltest, can be run with the test subcommand:
+//
+//	program-name test [-format format] [-run regexp] [-v] [path ...]
+//
+// Directories are searched recursively for test files, and the current
+// directory is used by default. Each file is run from its own directory, in
+// a fork of the context. With -run, only the test cases whose name, like
+// file_test.goal:12, or expression matches are run. With -v, passed test
+// cases are listed too. The format can be text (default), tap (Test Anything
+// Protocol) or junit (JUnit XML). It exits with non-zero status if some test
+// failed.
+//
+// A script can be bundled into a standalone executable with the build
+// subcommand:
+//
+//	program-name build [-o file] script
+//
+// The executable is a copy of the running one, including any builtins
+// registered by a derived interpreter, with the script and the modules it
+// imports transitively with constant names appended as an archive. When
+// run, it runs the script with all its command line arguments assigned to
+// ARGS, without interpreting any flags nor subcommands, and imports modules
+// from the archive first. Modules are searched at build time relative to the
+// importing file's directory, then the current directory and GOALLIB.
+//
+// A subcommand is only recognized as the first argument, and only if no file
+// with that name exists, so that existing scripts named like a subcommand
+// still run as before.
 func Cmd(ctx *goal.Context, cfg Config) {
+	zr, err := openBundle()
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: bundle: %v\n", cfg.ProgramName, err)
+		os.Exit(1)
+	}
+	if zr != nil {
+		os.Exit(runBundle(ctx, cfg, zr))
+	}
+	if len(os.Args) > 1 && !fileExists(os.Args[1]) {
+		switch os.Args[1] {
+		case "build":
+			os.Exit(runBuild(ctx, cfg, os.Args[2:]))
+		case "fmt":
+			os.Exit(runFmt(ctx, cfg, os.Args[2:]))
+		case "vet":
+			os.Exit(runVet(ctx, cfg, os.Args[2:]))
+		case "test":
+			os.Exit(runTest(ctx, cfg, os.Args[2:]))
+		}
+	}
+	if status := runMain(ctx, cfg); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// fileExists reports whether a file with the given name exists.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// runMain runs the interpreter with the options and arguments of the command
+// line, and returns the exit status. Deferred clean up, like writing
+// profiles, is done before returning, so that it happens on failure too.
+func runMain(ctx *goal.Context, cfg Config) int {
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
+	goalprofile := flag.String("goalprofile", "", "write goal profile to `file`")
 	optE := flag.String("e", "", "execute command")
 	optD := flag.Bool("d", false, "debug info (for scripts)")
 	optQ := flag.Bool("q", false, "quiet (no echo)")
+	optDebug := flag.Bool("debug", false, "run command or script in step debugger")
+	optNow := flag.String("now", "", "use fixed current `time` (RFC3339) for time builtins")
+	optN := flag.Bool("n", false, "run command or script for each input line")
+	optP := flag.Bool("p", false, "like -n, but print each result")
+	optF := flag.String("F", "", "field `separator` for -n and -p (default: blanks)")
+	optBegin := flag.String("begin", "", "with -n or -p, execute `command` before reading input")
+	optEnd := flag.String("end", "", "with -n or -p, execute `command` after reading input")
+	flag.CommandLine.SetOutput(gos.Stderr(ctx))
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-e command] [path]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "Usage: %s [-e command] [-debug] [-goalprofile file] [-now time] [path]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "       %s -n|-p [-F sep] [-begin command] [-end command] (-e command | script) [file ...]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "       %s fmt [-check] [-l] [-w] [path ...]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "       %s vet [path ...]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "       %s test [-format format] [-run regexp] [-v] [path ...]\n", os.Args[0])
+		fmt.Fprintf(gos.Stderr(ctx), "       %s build [-o file] script\n", os.Args[0])
 		flag.PrintDefaults()
 		if cfg.Man != "" {
-			fmt.Fprintf(os.Stderr, "See man page %s(1) for details (TODO).\n", cfg.Man)
+			fmt.Fprintf(gos.Stderr(ctx), "See man page %s(1) for details (TODO).\n", cfg.Man)
 		}
 	}
 	flag.Parse()
+	if *optDebug && *optE == "" && (len(flag.Args()) == 0 || flag.Arg(0) == "-") {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: -debug requires a command or script\n", cfg.ProgramName)
+		return 2
+	}
 	if *cpuprofile != "" {
 		// profiling
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.ProgramName, err)
-			os.Exit(1)
+			fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+			return 1
 		}
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
+	if *goalprofile != "" {
+		f, err := os.Create(*goalprofile)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+			return 1
+		}
+		ctx.StartProfile(0)
+		defer writeProfile(ctx, f, cfg.ProgramName)
+	}
+	if *optNow != "" {
+		t, err := time.Parse(time.RFC3339, *optNow)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: -now: %v\n", cfg.ProgramName, err)
+			return 1
+		}
+		ctx.Clock = goal.NewFakeClock(t)
+	}
 	args := flag.Args()
 	ctx.AssignGlobal("ARGS", goal.NewAS(args))
 	if *optD {
 		defer runDebug(ctx, cfg)
 	}
+	if *optDebug {
+		ctx.SetHook(newDebugger(gos.Stdin(ctx), gos.Stderr(ctx)))
+	}
+	if *optN || *optP {
+		sep, err := unescapeSep(*optF)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+			return 2
+		}
+		opts := awkOptions{print: *optP, sep: sep, begin: *optBegin, end: *optEnd}
+		loc, source, files := "", *optE, args
+		if *optE == "" {
+			if len(args) == 0 {
+				fmt.Fprintf(gos.Stderr(ctx), "%s: -n and -p require a command or script\n", cfg.ProgramName)
+				return 2
+			}
+			var err error
+			loc, files = args[0], args[1:]
+			source, err = readScript(loc)
+			if err != nil {
+				fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+				return 1
+			}
+		}
+		return runAwk(ctx, cfg, opts, loc, source, files)
+	}
 	if *optE != "" {
-		runCommand(ctx, *optE, cfg.ProgramName)
+		if status := runCommand(ctx, *optE, cfg.ProgramName); status != 0 {
+			return status
+		}
 	}
 	if *optE == "" && len(args) == 0 || len(args) == 1 && args[0] == "-" {
 		runStdin(ctx, cfg, *optQ)
-		return
+		return 0
 	}
 	if len(args) == 0 || *optE != "" {
-		return
+		return 0
 	}
 	fname := args[0]
-	bs, err := os.ReadFile(fname)
+	source, err := readScript(fname)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.ProgramName, err)
-		os.Exit(1)
-	}
-	source := string(bs)
-	if len(source) > 2 && source[:2] == "#!" {
-		// skip shellbang #! line
-		i := strings.IndexByte(source, '\n')
-		if i > 0 {
-			source = source[i+1:]
-		} else {
-			source = ""
-		}
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+		return 1
 	}
 	err = ctx.Compile(fname, source)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.ProgramName, err)
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
 		if *optD {
 			printProgram(ctx, cfg)
 		}
-		os.Exit(1)
+		return 1
 	}
 	if *optD {
 		printProgram(ctx, cfg)
-		os.Exit(0)
+		return 0
 	}
 	r, err := ctx.Run()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.ProgramName, err)
-		os.Exit(1)
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", cfg.ProgramName, err)
+		return 1
 	}
 	if r.IsError() {
 		warn(ctx, r)
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// readScript returns the source of script fname, skipping any #! line.
+func readScript(fname string) (string, error) {
+	bs, err := os.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+	return stripShebang(string(bs)), nil
+}
+
+// stripShebang removes any #! line from source, keeping its newline so that
+// line numbers are preserved.
+func stripShebang(source string) string {
+	if strings.HasPrefix(source, "#!") {
+		// skip shellbang #! line
+		i := strings.IndexByte(source, '\n')
+		if i < 0 {
+			i = len(source)
+		}
+		source = source[i:]
+	}
+	return source
+}
+
+func writeProfile(ctx *goal.Context, f *os.File, name string) {
+	err := ctx.StopProfile().WritePprof(f)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", name, err)
 	}
 }
 
 func warn(ctx *goal.Context, r goal.V) {
 	s, ok := r.Error().BV().(goal.S)
 	if ok {
-		fmt.Fprintln(os.Stderr, s)
+		fmt.Fprintln(gos.Stderr(ctx), s)
 	} else {
-		fmt.Fprintln(os.Stderr, r.Sprint(ctx))
+		fmt.Fprintln(gos.Stderr(ctx), r.Sprint(ctx))
 	}
 }
 
@@ -120,27 +337,49 @@ func runStdin(ctx *goal.Context, cfg Config, quiet bool) {
 			if !ok {
 				return goal.Panicf("help x : x not a string (%s)", args[0].Type())
 			}
-			fmt.Println(strings.TrimSpace(help[string(arg)]))
+			fmt.Fprintln(gos.Stdout(ctx), strings.TrimSpace(help[string(arg)]))
 		}
 		helpLast = true
 		return goal.NewI(1)
 	})
 	// We define an alias for help as a global to allow redefinition.
 	ctx.AssignGlobal("h", helpv)
-	lr := lineReader{r: bufio.NewReader(os.Stdin)}
+	lr := lineReader{r: bufio.NewReader(gos.Stdin(ctx))}
+	ed := newTermEditor(ctx, help)
+	if ed != nil {
+		lr.r = ed
+	}
 	if !quiet {
-		fmt.Printf("%s repl, type help\"\" for basic info.\n", cfg.ProgramName)
+		fmt.Fprintf(gos.Stdout(ctx), "%s repl, type help\"\" for basic info.\n", cfg.ProgramName)
 	}
+	metas := metaCommands(cfg, help)
 	sc := &scanner{}
 	for {
-		fmt.Print("  ")
+		if ed == nil {
+			fmt.Fprint(gos.Stdout(ctx), "  ")
+		}
 		s, err := lr.readLine(sc)
+		if errors.Is(err, errInterrupt) {
+			continue
+		}
 		if err != nil && s == "" {
 			return
 		}
+		if name, arg, ok := parseMetaCommand(s); ok {
+			if mc, ok := metas[name]; ok {
+				err := mc.Run(ctx, arg)
+				if err == errQuit {
+					return
+				}
+				if err != nil {
+					fmt.Fprintln(gos.Stdout(ctx), "'ERROR "+strings.TrimSuffix(err.Error(), "\n"))
+				}
+				continue
+			}
+		}
 		r, err := ctx.Eval(s)
 		if err != nil {
-			fmt.Println("'ERROR " + strings.TrimSuffix(err.Error(), "\n"))
+			fmt.Fprintln(gos.Stdout(ctx), "'ERROR "+strings.TrimSuffix(err.Error(), "\n"))
 			continue
 		}
 		assigned := ctx.AssignedLast()
@@ -151,8 +390,38 @@ func runStdin(ctx *goal.Context, cfg Config, quiet bool) {
 	}
 }
 
+// newTermEditor returns a line editor for the repl if standard input and
+// output are terminals, or nil otherwise. It completes globals, keywords and
+// builtin names, as well as help topics within strings.
+func newTermEditor(ctx *goal.Context, help map[string]string) *editor {
+	in, ok := gos.Stdin(ctx).(*os.File)
+	if !ok || !isTerminal(in.Fd()) || os.Getenv("TERM") == "dumb" {
+		return nil
+	}
+	out, ok := gos.Stdout(ctx).(*os.File)
+	if !ok || !isTerminal(out.Fd()) {
+		return nil
+	}
+	ed := newEditor(in, out, "  ", historyFile())
+	ed.complete = func(prefix string, quoted bool) []string {
+		var r []string
+		for k := range help {
+			if quoted || isWord(k) {
+				r = append(r, k)
+			}
+		}
+		if !quoted {
+			r = append(r, ctx.GlobalNames()...)
+			r = append(r, ctx.Keywords()...)
+		}
+		return r
+	}
+	return ed
+}
+
+// lineReader reads possibly multi-line input, until brackets are balanced.
 type lineReader struct {
-	r *bufio.Reader
+	r io.ByteScanner
 }
 
 type scanner struct {
@@ -288,7 +557,7 @@ func opening(r byte) byte {
 }
 
 func printProgram(ctx *goal.Context, cfg Config) {
-	fmt.Fprintf(os.Stderr, "%s: debug info below:\n%v", cfg.ProgramName, ctx.Show())
+	fmt.Fprintf(gos.Stderr(ctx), "%s: debug info below:\n%v", cfg.ProgramName, ctx.Show())
 }
 
 func runDebug(ctx *goal.Context, cfg Config) {
@@ -299,20 +568,21 @@ func runDebug(ctx *goal.Context, cfg Config) {
 	}
 }
 
-func runCommand(ctx *goal.Context, cmd string, name string) {
+func runCommand(ctx *goal.Context, cmd string, name string) int {
 	r, err := ctx.Eval(cmd)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
-		os.Exit(1)
+		fmt.Fprintf(gos.Stderr(ctx), "%s: %v\n", name, err)
+		return 1
 	}
 	if r.IsError() {
 		warn(ctx, r)
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
 func echo(ctx *goal.Context, x goal.V) {
 	if x != (goal.V{}) {
-		fmt.Printf("%s\n", x.Sprint(ctx))
+		fmt.Fprintf(gos.Stdout(ctx), "%s\n", x.Sprint(ctx))
 	}
 }
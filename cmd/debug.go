@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"codeberg.org/anaseto/goal"
+)
+
+// debugger implements a simple interactive step debugger as a goal.Hook.
+type debugger struct {
+	in          *bufio.Reader
+	out         io.Writer
+	breakpoints map[string]bool // file:line
+	mode        debugMode
+	depth       int    // call depth for next
+	file        string // last stop file
+	last        string // last command
+}
+
+type debugMode int
+
+const (
+	debugStep debugMode = iota
+	debugNext
+	debugContinue
+)
+
+const debugHelp = `Debugger commands:
+  s, step           execute next statement, entering lambdas
+  n, next           execute next statement, skipping lambdas
+  c, continue       continue until next breakpoint
+  b [file:]line     set breakpoint (current file by default)
+  d [file:]line     delete breakpoint
+  bl                list breakpoints
+  l, locals         print local variables
+  p name            print local or global variable
+  g, globals        list global variable names
+  stack             print execution stack
+  q, quit           stop execution
+  h, help           print this help
+An empty line repeats the last step, next or continue command.`
+
+var errDebugQuit = errors.New("debugger: quit")
+
+func newDebugger(r io.Reader, w io.Writer) *debugger {
+	return &debugger{
+		in:          bufio.NewReader(r),
+		out:         w,
+		breakpoints: map[string]bool{},
+		last:        "s",
+	}
+}
+
+// Statement implements goal.Hook.
+func (d *debugger) Statement(ctx *goal.Context, loc goal.Location) error {
+	switch d.mode {
+	case debugNext:
+		if loc.Depth > d.depth {
+			return nil
+		}
+	case debugContinue:
+		if !d.isBreakpoint(loc) {
+			return nil
+		}
+	}
+	d.file = loc.Filename
+	fmt.Fprintf(d.out, "%s:%d:%d\n", locName(loc.Filename), loc.Line, loc.Column)
+	if loc.Excerpt != "" {
+		fmt.Fprintf(d.out, "  %s\n", loc.Excerpt)
+	}
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		s, err := d.in.ReadString('\n')
+		if err != nil && s == "" {
+			fmt.Fprintln(d.out)
+			return errDebugQuit
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			fields = []string{d.last}
+		}
+		switch cmd := fields[0]; cmd {
+		case "s", "step":
+			d.mode = debugStep
+			d.last = cmd
+			return nil
+		case "n", "next":
+			d.mode = debugNext
+			d.depth = loc.Depth
+			d.last = cmd
+			return nil
+		case "c", "continue":
+			d.mode = debugContinue
+			d.last = cmd
+			return nil
+		case "b", "break", "d", "delete":
+			if len(fields) != 2 {
+				fmt.Fprintf(d.out, "usage: %s [file:]line\n", cmd)
+				continue
+			}
+			bp, err := d.parseBreakpoint(fields[1])
+			if err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			if cmd[0] == 'b' {
+				d.breakpoints[bp] = true
+			} else {
+				delete(d.breakpoints, bp)
+			}
+		case "bl":
+			bps := make([]string, 0, len(d.breakpoints))
+			for bp := range d.breakpoints {
+				bps = append(bps, bp)
+			}
+			sort.Strings(bps)
+			for _, bp := range bps {
+				fmt.Fprintln(d.out, bp)
+			}
+		case "l", "locals":
+			locals := ctx.Locals()
+			names := make([]string, 0, len(locals))
+			for name := range locals {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(d.out, "%s: %s\n", name, locals[name].Sprint(ctx))
+			}
+		case "p", "print":
+			if len(fields) != 2 {
+				fmt.Fprintln(d.out, "usage: p name")
+				continue
+			}
+			x, ok := ctx.Locals()[fields[1]]
+			if !ok {
+				x, ok = ctx.GetGlobal(fields[1])
+			}
+			if !ok || x.IsNil() {
+				fmt.Fprintf(d.out, "undefined: %s\n", fields[1])
+				continue
+			}
+			fmt.Fprintln(d.out, x.Sprint(ctx))
+		case "g", "globals":
+			fmt.Fprintln(d.out, strings.Join(ctx.GlobalNames(), " "))
+		case "stack":
+			stack := ctx.Stack()
+			for i := len(stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(d.out, "%d: %s\n", len(stack)-1-i, stack[i].Sprint(ctx))
+			}
+		case "q", "quit":
+			return errDebugQuit
+		case "h", "help":
+			fmt.Fprintln(d.out, debugHelp)
+		default:
+			fmt.Fprintf(d.out, "unknown command: %s (type h for help)\n", cmd)
+		}
+	}
+}
+
+// parseBreakpoint returns a normalized file:line breakpoint.
+func (d *debugger) parseBreakpoint(s string) (string, error) {
+	file := d.file
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		file = s[:i]
+		s = s[i+1:]
+	}
+	line, err := strconv.Atoi(s)
+	if err != nil || line <= 0 {
+		return "", fmt.Errorf("invalid line: %s", s)
+	}
+	return fmt.Sprintf("%s:%d", locName(file), line), nil
+}
+
+func (d *debugger) isBreakpoint(loc goal.Location) bool {
+	if len(d.breakpoints) == 0 {
+		return false
+	}
+	line := strconv.Itoa(loc.Line)
+	return d.breakpoints[locName(loc.Filename)+":"+line] ||
+		d.breakpoints[filepath.Base(loc.Filename)+":"+line]
+}
+
+func locName(fname string) string {
+	if fname == "" {
+		return "-"
+	}
+	return fname
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"codeberg.org/anaseto/goal"
+)
+
+func TestDebugger(t *testing.T) {
+	const src = "f:{a:x+1\n a*2}\ny:f 3\nz:y+1\nz\n"
+	const (
+		stop1  = "f.goal:1:3\n  f:{a:x+1\n"
+		stop2  = "f.goal:1:6\n  f:{a:x+1\n"
+		stop3  = "f.goal:2:2\n   a*2}\n"
+		stop4  = "f.goal:3:3\n  y:f 3\n"
+		stop5  = "f.goal:4:3\n  z:y+1\n"
+		stop6  = "f.goal:5:1\n  z\n"
+		prompt = "(debug) "
+	)
+	tests := []struct {
+		Name   string
+		Input  string
+		Output string
+		Quit   bool
+	}{
+		{"step", "s\ns\ns\ns\ns\ns\n",
+			stop1 + prompt + stop4 + prompt + stop2 + prompt + stop3 + prompt + stop5 + prompt + stop6 + prompt, false},
+		{"next", "n\n\n\n\n",
+			stop1 + prompt + stop4 + prompt + stop5 + prompt + stop6 + prompt, false},
+		{"continue", "c\n", stop1 + prompt, false},
+		{"break", "b 4\nc\np y\np z\nc\n",
+			stop1 + prompt + prompt + stop5 + prompt + "8\n" + prompt + "undefined: z\n" + prompt, false},
+		{"break in lambda", "b f.goal:2\nbl\nc\nl\np a\np nope\nd 2\nbl\nq\n",
+			stop1 + prompt + prompt + "f.goal:2\n" + prompt + stop3 + prompt + "a: 4\nx: 3\n" + prompt + "4\n" +
+				prompt + "undefined: nope\n" + prompt + prompt + prompt, true},
+		{"locals in global code", "l\np f\ng\nc\n",
+			stop1 + prompt + prompt + "undefined: f\n" + prompt + "\n" + prompt, false},
+		{"errors", "b x\nb\nfoo\nq\n",
+			stop1 + prompt + "invalid line: x\n" + prompt + "usage: b [file:]line\n" + prompt +
+				"unknown command: foo (type h for help)\n" + prompt, true},
+		{"eof", "", stop1 + prompt + "\n", true},
+	}
+	for _, test := range tests {
+		ctx := goal.NewContext()
+		var out bytes.Buffer
+		ctx.SetHook(newDebugger(strings.NewReader(test.Input), &out))
+		if err := ctx.Compile("f.goal", src); err != nil {
+			t.Fatalf("Compile: %v", err)
+		}
+		r, err := ctx.Run()
+		switch {
+		case test.Quit:
+			if err == nil || !strings.Contains(err.Error(), errDebugQuit.Error()) {
+				t.Errorf("%s: bad error: %v", test.Name, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.Name, err)
+		case !r.Matches(goal.NewI(9)):
+			t.Errorf("%s: bad result: %s", test.Name, r.Sprint(ctx))
+		}
+		if out.String() != test.Output {
+			t.Errorf("%s: bad output:\n%s\nexpected:\n%s", test.Name, out.String(), test.Output)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// editor implements a minimal line editor for the repl on a terminal, with
+// history, reverse search and completion. It provides the accepted lines as
+// a stream of bytes, so that multi-line input can be handled by lineReader.
+type editor struct {
+	in       *bufio.Reader
+	fd       uintptr // terminal file descriptor
+	out      io.Writer
+	prompt   string
+	buf      []byte // accepted line, not yet consumed
+	i        int    // index of next byte in buf
+	history  []string
+	hfile    string                                    // history file, if any
+	complete func(prefix string, quoted bool) []string // completion candidates
+}
+
+// errInterrupt is returned when the current input is interrupted with
+// Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+const historyMax = 1000
+
+// special keys
+const (
+	keyUnknown rune = -1 - iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyWordLeft
+	keyWordRight
+	keyWordDelete
+)
+
+// control keys
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	ctrlK     = 11
+	ctrlL     = 12
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	escape    = 27
+	backspace = 127
+)
+
+// newEditor returns an editor reading keys from terminal in, and loading
+// history from file hfile, if not empty.
+func newEditor(in *os.File, out io.Writer, prompt, hfile string) *editor {
+	e := &editor{in: bufio.NewReader(in), fd: in.Fd(), out: out, prompt: prompt, hfile: hfile}
+	e.loadHistory()
+	return e
+}
+
+// historyFile returns the default history file path, or an empty string if
+// the home directory is unknown.
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goal_history")
+}
+
+// loadHistory reads the history file, keeping the last historyMax entries,
+// and rewrites it if it has grown too long.
+func (e *editor) loadHistory() {
+	if e.hfile == "" {
+		return
+	}
+	bs, err := os.ReadFile(e.hfile)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > historyMax {
+		e.history = e.history[len(e.history)-historyMax:]
+	}
+	if len(lines) > 2*historyMax {
+		os.WriteFile(e.hfile, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+	}
+}
+
+// addHistory adds a line to the history, and appends it to the history
+// file.
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > historyMax {
+		e.history = e.history[1:]
+	}
+	if e.hfile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.hfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	f.WriteString(line + "\n")
+	f.Close()
+}
+
+// ReadByte returns the next byte of input, reading a new line from the
+// terminal if needed. It implements io.ByteScanner with UnreadByte.
+func (e *editor) ReadByte() (byte, error) {
+	if e.i >= len(e.buf) {
+		line, err := e.readLine()
+		if err != nil {
+			return 0, err
+		}
+		e.addHistory(line)
+		e.buf = append(append(e.buf[:0], line...), '\n')
+		e.i = 0
+	}
+	c := e.buf[e.i]
+	e.i++
+	return c, nil
+}
+
+// UnreadByte unreads the last byte returned by ReadByte.
+func (e *editor) UnreadByte() error {
+	if e.i == 0 {
+		return errors.New("editor: invalid UnreadByte")
+	}
+	e.i--
+	return nil
+}
+
+// readKey reads a key, decoding escape sequences for special keys.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != escape {
+		return r, err
+	}
+	c, err := e.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch c {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case backspace:
+		return keyWordDelete, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+	var params []byte
+	for {
+		c, err = e.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+		params = append(params, c)
+	}
+	switch c {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		if bytes.HasSuffix(params, []byte(";5")) {
+			return keyWordRight, nil
+		}
+		return keyRight, nil
+	case 'D':
+		if bytes.HasSuffix(params, []byte(";5")) {
+			return keyWordLeft, nil
+		}
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return keyUnknown, nil
+}
+
+// lineState represents the state of the line being edited.
+type lineState struct {
+	e     *editor
+	line  []rune
+	pos   int    // cursor position in line
+	hidx  int    // index in history
+	saved []rune // edited line before history navigation
+}
+
+// readLine reads a line from the terminal in raw mode, with line editing.
+func (e *editor) readLine() (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	st := &lineState{e: e, hidx: len(e.history)}
+	st.refresh(e.prompt, st.line, st.pos)
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if k == ctrlR {
+			k, err = st.search()
+			if err != nil {
+				return "", err
+			}
+		}
+		switch k {
+		case '\r', '\n':
+			st.refresh(e.prompt, st.line, len(st.line))
+			e.out.Write([]byte("\r\n"))
+			return string(st.line), nil
+		case ctrlC:
+			e.out.Write([]byte("^C\r\n"))
+			return "", errInterrupt
+		case ctrlD:
+			if len(st.line) == 0 {
+				e.out.Write([]byte("\r\n"))
+				return "", io.EOF
+			}
+			st.delete(st.pos, st.pos+1)
+		case ctrlA, keyHome:
+			st.pos = 0
+		case ctrlE, keyEnd:
+			st.pos = len(st.line)
+		case ctrlB, keyLeft:
+			if st.pos > 0 {
+				st.pos--
+			}
+		case ctrlF, keyRight:
+			if st.pos < len(st.line) {
+				st.pos++
+			}
+		case keyWordLeft:
+			st.pos = st.wordStart()
+		case keyWordRight:
+			st.pos = st.wordEnd()
+		case backspace, ctrlH:
+			if st.pos > 0 {
+				st.delete(st.pos-1, st.pos)
+			}
+		case keyDelete:
+			st.delete(st.pos, st.pos+1)
+		case ctrlK:
+			st.delete(st.pos, len(st.line))
+		case ctrlU:
+			st.delete(0, st.pos)
+		case ctrlW, keyWordDelete:
+			st.delete(st.wordStart(), st.pos)
+		case ctrlL:
+			e.out.Write([]byte("\x1b[H\x1b[2J"))
+		case ctrlP, keyUp:
+			st.historyMove(-1)
+		case ctrlN, keyDown:
+			st.historyMove(1)
+		case tab:
+			st.completeWord()
+		case 0, ctrlG, escape, keyUnknown:
+		default:
+			if k >= ' ' {
+				st.insert(k)
+			}
+		}
+		st.refresh(e.prompt, st.line, st.pos)
+	}
+}
+
+// refresh redraws the prompt and line, scrolling horizontally so that the
+// cursor at pos is visible.
+func (st *lineState) refresh(prompt string, line []rune, pos int) {
+	width := termWidth(st.e.fd)
+	plen := len([]rune(prompt))
+	avail := width - plen - 1
+	if avail < 1 {
+		avail = 1
+	}
+	start := 0
+	if pos > avail {
+		start = pos - avail
+	}
+	end := start + avail
+	if end > len(line) {
+		end = len(line)
+	}
+	var sb strings.Builder
+	sb.WriteString("\r")
+	sb.WriteString(prompt)
+	sb.WriteString(string(line[start:end]))
+	sb.WriteString("\x1b[K\r")
+	if col := plen + pos - start; col > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dC", col)
+	}
+	st.e.out.Write([]byte(sb.String()))
+}
+
+func (st *lineState) insert(r rune) {
+	st.line = append(st.line, 0)
+	copy(st.line[st.pos+1:], st.line[st.pos:])
+	st.line[st.pos] = r
+	st.pos++
+}
+
+// delete deletes runes from i to j (excluded), if in range.
+func (st *lineState) delete(i, j int) {
+	if j > len(st.line) {
+		j = len(st.line)
+	}
+	if i >= j {
+		return
+	}
+	st.line = append(st.line[:i], st.line[j:]...)
+	if st.pos > j {
+		st.pos -= j - i
+	} else if st.pos > i {
+		st.pos = i
+	}
+}
+
+// wordStart returns the position of the start of the word before the
+// cursor.
+func (st *lineState) wordStart() int {
+	i := st.pos
+	for i > 0 && st.line[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && st.line[i-1] != ' ' {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the position of the end of the word after the cursor.
+func (st *lineState) wordEnd() int {
+	i := st.pos
+	for i < len(st.line) && st.line[i] == ' ' {
+		i++
+	}
+	for i < len(st.line) && st.line[i] != ' ' {
+		i++
+	}
+	return i
+}
+
+// historyMove replaces the line with the previous (d < 0) or next (d > 0)
+// history entry.
+func (st *lineState) historyMove(d int) {
+	h := st.e.history
+	i := st.hidx + d
+	if i < 0 || i > len(h) {
+		return
+	}
+	if st.hidx == len(h) {
+		st.saved = append(st.saved[:0], st.line...)
+	}
+	st.hidx = i
+	if i == len(h) {
+		st.line = append([]rune{}, st.saved...)
+	} else {
+		st.line = []rune(h[i])
+	}
+	st.pos = len(st.line)
+}
+
+// search performs an incremental reverse search in history, started with
+// Ctrl-R. It returns the key that ended the search, if it should be
+// processed as usual.
+func (st *lineState) search() (rune, error) {
+	h := st.e.history
+	var query []rune
+	orig, origPos := st.line, st.pos
+	match, mpos := len(h), 0 // current match in history and position in it
+	failed := false
+	find := func(from int) {
+		q := string(query)
+		for i := from; i >= 0; i-- {
+			if j := strings.Index(h[i], q); j >= 0 {
+				match, mpos, failed = i, len([]rune(h[i][:j])), false
+				return
+			}
+		}
+		failed = true
+	}
+	for {
+		prompt := "(reverse-i-search)`" + string(query) + "': "
+		if failed {
+			prompt = "(failed " + prompt[1:]
+		}
+		var line []rune
+		if match < len(h) {
+			line = []rune(h[match])
+		}
+		st.refresh(prompt, line, mpos)
+		k, err := st.e.readKey()
+		if err != nil {
+			return 0, err
+		}
+		switch k {
+		case ctrlR:
+			if len(query) > 0 {
+				find(match - 1)
+			}
+		case backspace, ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(h) - 1)
+			}
+		case ctrlC, ctrlG:
+			st.line, st.pos = orig, origPos
+			return 0, nil
+		default:
+			if k >= ' ' {
+				query = append(query, k)
+				if match == len(h) {
+					find(len(h) - 1)
+				} else {
+					find(match)
+				}
+				continue
+			}
+			if match < len(h) {
+				st.line, st.pos = line, mpos
+				st.hidx = match
+			}
+			return k, nil
+		}
+	}
+}
+
+// completeWord completes the word before the cursor. If there are several
+// candidates, it inserts their common prefix, or lists them if there is
+// none.
+func (st *lineState) completeWord() {
+	if st.e.complete == nil {
+		return
+	}
+	start := st.pos
+	for start > 0 && isWordRune(st.line[start-1]) {
+		start--
+	}
+	prefix := string(st.line[start:st.pos])
+	quoted := start > 0 && st.line[start-1] == '"'
+	if prefix == "" && !quoted {
+		return
+	}
+	var cands []string
+	for _, s := range st.e.complete(prefix, quoted) {
+		if strings.HasPrefix(s, prefix) {
+			cands = append(cands, s)
+		}
+	}
+	sort.Strings(cands)
+	cands = uniq(cands)
+	if len(cands) == 0 {
+		st.e.out.Write([]byte("\a"))
+		return
+	}
+	common := cands[0]
+	for _, s := range cands[1:] {
+		for !strings.HasPrefix(s, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(common) > len(prefix) {
+		for _, r := range common[len(prefix):] {
+			st.insert(r)
+		}
+		return
+	}
+	if len(cands) > 1 {
+		st.e.out.Write([]byte("\r\n" + strings.Join(cands, "  ") + "\r\n"))
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.'
+}
+
+// isWord reports whether s is a non-empty identifier-like word.
+func isWord(s string) bool {
+	if s == "" || s[0] == '.' {
+		return false
+	}
+	for _, r := range s {
+		if !isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// uniq removes duplicates from sorted s.
+func uniq(s []string) []string {
+	if len(s) == 0 {
+		return s
+	}
+	r := s[:1]
+	for _, x := range s[1:] {
+		if x != r[len(r)-1] {
+			r = append(r, x)
+		}
+	}
+	return r
+}
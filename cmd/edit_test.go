@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineState(t *testing.T) {
+	st := &lineState{e: &editor{}}
+	for _, r := range "abc def" {
+		st.insert(r)
+	}
+	st.pos = 3
+	st.insert('X')
+	if s := string(st.line); s != "abcX def" || st.pos != 4 {
+		t.Fatalf("insert: got %q at %d", s, st.pos)
+	}
+	if i := st.wordStart(); i != 0 {
+		t.Errorf("wordStart: got %d", i)
+	}
+	st.pos = 2
+	if i := st.wordEnd(); i != 4 {
+		t.Errorf("wordEnd: got %d", i)
+	}
+	st.pos = 4
+	if i := st.wordEnd(); i != 8 {
+		t.Errorf("wordEnd after blank: got %d", i)
+	}
+	st.pos = 8
+	if i := st.wordStart(); i != 5 {
+		t.Errorf("wordStart: got %d", i)
+	}
+	tests := []struct {
+		I, J int
+		Pos  int
+		Line string
+		Want int
+	}{
+		{1, 3, 4, "aX def", 2}, // cursor after deleted range
+		{0, 2, 1, " def", 0},   // cursor within deleted range
+		{2, 10, 1, " d", 1},    // range clipped to line end
+		{1, 1, 1, " d", 1},     // empty range
+		{0, 2, 0, "", 0},       // cursor before deleted range
+		{0, 1, 0, "", 0},       // empty line
+	}
+	for _, test := range tests {
+		st.pos = test.Pos
+		st.delete(test.I, test.J)
+		if s := string(st.line); s != test.Line || st.pos != test.Want {
+			t.Errorf("delete(%d,%d): got %q at %d, expected %q at %d",
+				test.I, test.J, s, st.pos, test.Line, test.Want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	hfile := filepath.Join(t.TempDir(), "history")
+	e := &editor{hfile: hfile}
+	for _, line := range []string{"a:1", "a:1", " ", "b:2", "a:1"} {
+		e.addHistory(line)
+	}
+	want := "a:1\nb:2\na:1\n"
+	if bs, err := os.ReadFile(hfile); err != nil || string(bs) != want {
+		t.Fatalf("history file: got %q (%v), expected %q", bs, err, want)
+	}
+	e = &editor{hfile: hfile}
+	e.loadHistory()
+	if s := strings.Join(e.history, "\n") + "\n"; s != want {
+		t.Errorf("loadHistory: got %q, expected %q", s, want)
+	}
+
+	st := &lineState{e: e, line: []rune("edit"), pos: 4, hidx: len(e.history)}
+	moves := []struct {
+		D    int
+		Line string
+	}{
+		{-1, "a:1"}, {-1, "b:2"}, {-1, "a:1"}, {-1, "a:1"},
+		{1, "b:2"}, {1, "a:1"}, {1, "edit"}, {1, "edit"},
+	}
+	for i, m := range moves {
+		st.historyMove(m.D)
+		if s := string(st.line); s != m.Line || st.pos != len(st.line) {
+			t.Errorf("historyMove %d: got %q at %d, expected %q", i, s, st.pos, m.Line)
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i <= 2*historyMax; i++ {
+		fmt.Fprintf(&sb, "x:%d\n\n", i)
+	}
+	if err := os.WriteFile(hfile, []byte(sb.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e = &editor{hfile: hfile}
+	e.loadHistory()
+	if len(e.history) != historyMax || e.history[0] != fmt.Sprintf("x:%d", historyMax+1) {
+		t.Errorf("loadHistory: got %d entries, first %q", len(e.history), e.history[0])
+	}
+	bs, err := os.ReadFile(hfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bs), "\n"); n != historyMax {
+		t.Errorf("loadHistory: history file not truncated (%d lines)", n)
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	complete := func(prefix string, quoted bool) []string {
+		if quoted {
+			return []string{"help", "hello", "xé", "xè"}
+		}
+		return []string{"abc", "abd", "abc", "xyz", "p.f", "help"}
+	}
+	tests := []struct {
+		Line   string
+		Pos    int
+		Result string
+		Output string
+	}{
+		{"1+x", 3, "1+xyz", ""},
+		{"1+ab", 4, "1+ab", "\r\nabc  abd\r\n"},
+		{"a", 1, "ab", ""},
+		{"p. 2", 2, "p.f 2", ""},
+		{"1+q", 3, "1+q", "\a"},
+		{"1+", 2, "1+", ""},
+		{`"he`, 3, `"hel`, ""},
+		{`"`, 1, `"`, "\r\nhello  help  xè  xé\r\n"},
+		{`"x`, 2, `"x`, "\r\nxè  xé\r\n"}, // no partial rune inserted
+		{`"hel`, 4, `"hel`, "\r\nhello  help\r\n"},
+		{"he", 0, "he", ""},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		st := &lineState{e: &editor{out: &out, complete: complete}, line: []rune(test.Line), pos: test.Pos}
+		st.completeWord()
+		if s := string(st.line); s != test.Result {
+			t.Errorf("%q: got %q, expected %q", test.Line, s, test.Result)
+		}
+		if out.String() != test.Output {
+			t.Errorf("%q: bad output %q, expected %q", test.Line, out.String(), test.Output)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runFmt runs the fmt subcommand with the given arguments, and returns the
+// exit status.
+func runFmt(ctx *goal.Context, cfg Config, args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	optL := fs.Bool("l", false, "list files whose formatting differs")
+	optW := fs.Bool("w", false, "write result to source file instead of standard output")
+	optCheck := fs.Bool("check", false, "exit with non-zero status if some file is not formatted")
+	fs.SetOutput(gos.Stderr(ctx))
+	fs.Usage = func() {
+		fmt.Fprintf(gos.Stderr(ctx), "Usage: %s fmt [-check] [-l] [-w] [path ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		if *optW {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: cannot use -w with standard input\n", cfg.ProgramName)
+			return 2
+		}
+		bs, err := io.ReadAll(gos.Stdin(ctx))
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: %v\n", cfg.ProgramName, err)
+			return 1
+		}
+		return fmtSource(ctx, cfg, "<stdin>", string(bs), *optL, false, *optCheck)
+	}
+	status := 0
+	for _, fname := range fs.Args() {
+		bs, err := os.ReadFile(fname)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: %v\n", cfg.ProgramName, err)
+			status = 1
+			continue
+		}
+		if st := fmtSource(ctx, cfg, fname, string(bs), *optL, *optW, *optCheck); st > status {
+			status = st
+		}
+	}
+	return status
+}
+
+// fmtSource formats source from file fname as specified by the fmt options,
+// and returns the exit status.
+func fmtSource(ctx *goal.Context, cfg Config, fname, source string, list, write, check bool) int {
+	r, err := ctx.Format(fname, source)
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	changed := r != source
+	if list && changed {
+		fmt.Fprintln(gos.Stdout(ctx), fname)
+	}
+	if write && changed {
+		if err := os.WriteFile(fname, []byte(r), 0666); err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: %v\n", cfg.ProgramName, err)
+			return 1
+		}
+	}
+	if !list && !write && !check {
+		fmt.Fprint(gos.Stdout(ctx), r)
+	}
+	if check && changed {
+		if !list {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: fmt: %s is not formatted\n", cfg.ProgramName, fname)
+		}
+		return 1
+	}
+	return 0
+}
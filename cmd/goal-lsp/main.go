@@ -0,0 +1,44 @@
+// Command goal-lsp is a language server for goal source files, speaking the
+// Language Server Protocol over standard input and output.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"codeberg.org/anaseto/goal"
+	"codeberg.org/anaseto/goal/help"
+	"codeberg.org/anaseto/goal/lsp"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+func main() {
+	err := lsp.Serve(os.Stdin, os.Stdout, lsp.Config{Help: help.Map, NewContext: newContext})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goal-lsp: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newContext returns a context with the same keywords and globals as the goal
+// command.
+func newContext() *goal.Context {
+	ctx := goal.NewContext()
+	ctx.RegisterMonad("chdir", gos.VFChdir)
+	ctx.RegisterMonad("close", gos.VFClose)
+	ctx.RegisterMonad("flush", gos.VFFlush)
+	ctx.RegisterDyad("env", gos.VFEnv)
+	ctx.RegisterDyad("import", gos.VFImport)
+	ctx.RegisterDyad("open", gos.VFOpen)
+	ctx.RegisterDyad("print", gos.VFPrint)
+	ctx.RegisterDyad("read", gos.VFRead)
+	ctx.RegisterDyad("run", gos.VFRun)
+	ctx.RegisterDyad("say", gos.VFSay)
+	ctx.RegisterDyad("shell", gos.VFShell)
+
+	ctx.AssignGlobal("STDOUT", gos.NewStdHandle(os.Stdout))
+	ctx.AssignGlobal("STDERR", gos.NewStdHandle(os.Stderr))
+	ctx.AssignGlobal("STDIN", gos.NewStdHandle(os.Stdin))
+	ctx.AssignGlobal("ARGS", goal.NewAS(nil))
+	return ctx
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+)
+
+// MetaCommand represents a repl meta-command, invoked on a line of its own
+// with a backslash followed by the command's name and an optional argument,
+// like \name arg.
+type MetaCommand struct {
+	// Help is a short description shown by the \? meta-command.
+	Help string
+
+	// Run runs the command with the given argument, with leading and
+	// trailing spaces removed. A returned error is reported like an
+	// evaluation error.
+	Run func(ctx *goal.Context, arg string) error
+}
+
+// errQuit is returned by the \q meta-command.
+var errQuit = errors.New("quit")
+
+// metaCommands returns the repl meta-commands: builtin ones, and the ones
+// from cfg, which take precedence.
+func metaCommands(cfg Config, help map[string]string) map[string]MetaCommand {
+	cmds := map[string]MetaCommand{
+		"t": {Help: "t[:n] expr  time evaluation of expr (average of n runs)", Run: metaTime},
+		"l": {Help: "l file      load file", Run: metaLoad},
+		"v": {Help: "v [prefix]  list global variables with types and lengths", Run: metaVars},
+		"c": {Help: "c expr      show compiled instructions of expr", Run: metaCode},
+		"w": {Help: "w name      show which help topics document name", Run: func(ctx *goal.Context, arg string) error {
+			return metaWhich(ctx, arg, help)
+		}},
+		"q": {Help: "q           quit", Run: func(ctx *goal.Context, arg string) error { return errQuit }},
+	}
+	for name, c := range cfg.MetaCommands {
+		cmds[name] = c
+	}
+	cmds["?"] = MetaCommand{Help: "?           list meta-commands", Run: func(ctx *goal.Context, arg string) error {
+		names := make([]string, 0, len(cmds))
+		for name := range cmds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			h := cmds[name].Help
+			if h == "" {
+				h = name
+			}
+			fmt.Fprintf(gos.Stdout(ctx), "\\%s\n", h)
+		}
+		return nil
+	}}
+	return cmds
+}
+
+// parseMetaCommand returns the name and argument of a meta-command line like
+// \name arg. The name ends at the first space or colon.
+func parseMetaCommand(s string) (name, arg string, ok bool) {
+	s = strings.Trim(s, " \n")
+	if len(s) < 2 || s[0] != '\\' || strings.ContainsRune(s, '\n') {
+		return "", "", false
+	}
+	s = s[1:]
+	i := strings.IndexAny(s, " :")
+	if i < 0 {
+		return s, "", true
+	}
+	return s[:i], strings.TrimSpace(s[i:]), true
+}
+
+func metaTime(ctx *goal.Context, arg string) error {
+	n := 1
+	if strings.HasPrefix(arg, ":") {
+		i := strings.IndexByte(arg, ' ')
+		if i < 0 {
+			i = len(arg)
+		}
+		var err error
+		n, err = strconv.Atoi(arg[1:i])
+		if err != nil || n < 1 {
+			return fmt.Errorf("\\t:n : n not a positive integer (%s)", arg[1:i])
+		}
+		arg = strings.TrimSpace(arg[i:])
+	}
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		if err := ctx.Compile("", arg); err != nil {
+			return err
+		}
+		start := time.Now()
+		_, err := ctx.Run()
+		total += time.Since(start)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(gos.Stdout(ctx), total/time.Duration(n))
+	return nil
+}
+
+func metaLoad(ctx *goal.Context, arg string) error {
+	if arg == "" {
+		return errors.New("\\l file : missing file")
+	}
+	source, err := readScript(arg)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Compile(arg, source); err != nil {
+		return err
+	}
+	_, err = ctx.Run()
+	return err
+}
+
+func metaVars(ctx *goal.Context, arg string) error {
+	tw := tabwriter.NewWriter(gos.Stdout(ctx), 0, 8, 2, ' ', 0)
+	for _, name := range ctx.GlobalNames() {
+		if !strings.HasPrefix(name, arg) {
+			continue
+		}
+		x, _ := ctx.GetGlobal(name)
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", name, x.Type(), x.Len())
+	}
+	return tw.Flush()
+}
+
+func metaCode(ctx *goal.Context, arg string) error {
+	s, err := ctx.Disassemble(arg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(gos.Stdout(ctx), s)
+	return nil
+}
+
+// metaWhich prints the help topics documenting a name. Topics are the ones
+// listed in the main help text as "topic" followed by a description.
+func metaWhich(ctx *goal.Context, arg string, help map[string]string) error {
+	if arg == "" {
+		return errors.New("\\w name : missing name")
+	}
+	// A builtin's help text is extracted from its topic's text, so
+	// look for its first line, or otherwise for the name as a word.
+	first, _, _ := strings.Cut(strings.TrimSpace(help[arg]), "\n")
+	found := false
+	for _, line := range strings.Split(help[""], "\n") {
+		if !strings.HasPrefix(line, "\"") {
+			continue
+		}
+		topic, desc, ok := strings.Cut(line[1:], "\"")
+		if !ok {
+			continue
+		}
+		text := help[topic]
+		if first != "" && strings.Contains(text, first) || first == "" && containsWord(text, arg) {
+			fmt.Fprintf(gos.Stdout(ctx), "%q\t%s\n", topic, strings.TrimSpace(desc))
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no help topic documents %s", arg)
+	}
+	return nil
+}
+
+// containsWord reports whether s contains w not surrounded by other word
+// characters.
+func containsWord(s, w string) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], w)
+		if j < 0 {
+			return false
+		}
+		j += i
+		k := j + len(w)
+		if (j == 0 || !isWordRune(rune(s[j-1]))) && (k == len(s) || !isWordRune(rune(s[k]))) {
+			return true
+		}
+		i = j + 1
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package cmd
+
+import "errors"
+
+// isTerminal reports whether fd refers to a terminal. Terminals are not
+// supported on this platform, so the repl reads plain lines.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
+
+func termWidth(fd uintptr) int {
+	return 80
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"codeberg.org/anaseto/goal"
+	"codeberg.org/anaseto/goal/goaltest"
+	gos "codeberg.org/anaseto/goal/os"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// runTest runs the test subcommand with the given arguments, and returns the
+// exit status.
+func runTest(ctx *goal.Context, cfg Config, args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	optRun := fs.String("run", "", "run only test cases whose name or expression matches `regexp`")
+	optV := fs.Bool("v", false, "verbose: list passed test cases too")
+	optFormat := fs.String("format", "text", "output `format`: text, tap or junit")
+	fs.SetOutput(gos.Stderr(ctx))
+	fs.Usage = func() {
+		fmt.Fprintf(gos.Stderr(ctx), "Usage: %s test [-format format] [-run regexp] [-v] [path ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var tcfg goaltest.Config
+	if *optRun != "" {
+		rx, err := regexp.Compile(*optRun)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: test: -run: %v\n", cfg.ProgramName, err)
+			return 2
+		}
+		tcfg.Filter = rx
+	}
+	switch *optFormat {
+	case "text", "tap", "junit":
+	default:
+		fmt.Fprintf(gos.Stderr(ctx), "%s: test: -format: unknown format %q\n", cfg.ProgramName, *optFormat)
+		return 2
+	}
+	if _, ok := ctx.GetGlobal("ARGS"); !ok {
+		ctx.AssignGlobal("ARGS", goal.NewAS(nil))
+	}
+	tcfg.NewContext = ctx.Fork
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	fnames, err := goaltest.Find(paths...)
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: test: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	if len(fnames) == 0 {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: test: no test files\n", cfg.ProgramName)
+		return 0
+	}
+	status := 0
+	var frs []*goaltest.FileResult
+	for _, fname := range fnames {
+		fr := runTestFile(fname, tcfg)
+		if fr.Failed() {
+			status = 1
+		}
+		if *optFormat == "text" {
+			goaltest.WriteText(gos.Stdout(ctx), fr, *optV)
+		}
+		frs = append(frs, fr)
+	}
+	switch *optFormat {
+	case "tap":
+		err = goaltest.WriteTAP(gos.Stdout(ctx), frs)
+	case "junit":
+		err = goaltest.WriteJUnit(gos.Stdout(ctx), frs)
+	}
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: test: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	return status
+}
+
+// runTestFile runs a test file from within its directory, so that imports
+// are relative to it.
+func runTestFile(fname string, tcfg goaltest.Config) *goaltest.FileResult {
+	bs, err := os.ReadFile(fname)
+	if err != nil {
+		return &goaltest.FileResult{File: fname, Err: err}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return &goaltest.FileResult{File: fname, Err: err}
+	}
+	if err := os.Chdir(filepath.Dir(fname)); err != nil {
+		return &goaltest.FileResult{File: fname, Err: err}
+	}
+	defer os.Chdir(wd)
+	return goaltest.Run(fname, string(bs), tcfg)
+}
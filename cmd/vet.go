@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"codeberg.org/anaseto/goal"
+	gos "codeberg.org/anaseto/goal/os"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runVet runs the vet subcommand with the given arguments, and returns the
+// exit status.
+func runVet(ctx *goal.Context, cfg Config, args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	fs.SetOutput(gos.Stderr(ctx))
+	fs.Usage = func() {
+		fmt.Fprintf(gos.Stderr(ctx), "Usage: %s vet [path ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if _, ok := ctx.GetGlobal("ARGS"); !ok {
+		ctx.AssignGlobal("ARGS", goal.NewAS(nil))
+	}
+	if fs.NArg() == 0 {
+		bs, err := io.ReadAll(gos.Stdin(ctx))
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: vet: %v\n", cfg.ProgramName, err)
+			return 1
+		}
+		return vetSource(ctx, cfg, "<stdin>", string(bs))
+	}
+	status := 0
+	for _, fname := range fs.Args() {
+		bs, err := os.ReadFile(fname)
+		if err != nil {
+			fmt.Fprintf(gos.Stderr(ctx), "%s: vet: %v\n", cfg.ProgramName, err)
+			status = 1
+			continue
+		}
+		if vetSource(ctx, cfg, fname, string(bs)) != 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+// vetSource reports the problems found by linting source from file fname,
+// and returns the exit status.
+func vetSource(ctx *goal.Context, cfg Config, fname, source string) int {
+	issues, err := ctx.Lint(fname, source)
+	if err != nil {
+		fmt.Fprintf(gos.Stderr(ctx), "%s: vet: %v\n", cfg.ProgramName, err)
+		return 1
+	}
+	for _, li := range issues {
+		fmt.Fprintln(gos.Stderr(ctx), li)
+	}
+	if len(issues) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -57,7 +57,8 @@ func smallRange(xv *AI) (min, span int64, ok bool) {
 }
 
 // classify returns %x.
-func classify(ctx *Context, x V) V {
+func classify(ctx *Context, x V) (r V) {
+	defer catchInterrupt(&r)
 	switch xv := x.bv.(type) {
 	case *D:
 		return newDictValues(xv.keys, classify(ctx, NewV(xv.values)))
@@ -101,17 +102,17 @@ func classify(ctx *Context, x V) V {
 		if ok {
 			// fast path avoiding hash table
 			if span < 256 || xv.Len() < 256 {
-				r := classifyInt64s[byte](xv.elts, min, span)
+				r := classifyInt64s[byte](ctx, xv.elts, min, span)
 				return NewAB(r)
 			}
-			r := classifyInt64s[int64](xv.elts, min, span)
+			r := classifyInt64s[int64](ctx, xv.elts, min, span)
 			return NewAI(r)
 		}
 		if xv.Len() <= bruteForceNumeric {
 			r := classifyBrute(xv.elts)
 			return NewAB(r)
 		}
-		r := classifySlice[int64, int64](xv.elts)
+		r := classifySlice[int64, int64](ctx, xv.elts)
 		return NewAI(r)
 	case *AF:
 		if ascending(xv) {
@@ -126,7 +127,7 @@ func classify(ctx *Context, x V) V {
 			r := classifyBrute(xv.elts)
 			return NewAB(r)
 		}
-		r := classifySlice[float64, int64](xv.elts)
+		r := classifySlice[float64, int64](ctx, xv.elts)
 		return NewAI(r)
 	case *AS:
 		if ascending(xv) {
@@ -142,10 +143,10 @@ func classify(ctx *Context, x V) V {
 			return NewAB(r)
 		}
 		if xv.Len() < 256 {
-			r := classifySlice[string, byte](xv.elts)
+			r := classifySlice[string, byte](ctx, xv.elts)
 			return NewAB(r)
 		}
-		r := classifySlice[string, int64](xv.elts)
+		r := classifySlice[string, int64](ctx, xv.elts)
 		return NewAI(r)
 	case *AV:
 		if xv.Len() > bruteForceGeneric {
@@ -154,9 +155,9 @@ func classify(ctx *Context, x V) V {
 				ss[i] = xi.Sprint(ctx)
 			}
 			if xv.Len() < 256 {
-				return NewAB(classifySlice[string, byte](ss))
+				return NewAB(classifySlice[string, byte](ctx, ss))
 			}
-			return NewAI(classifySlice[string, int64](ss))
+			return NewAI(classifySlice[string, int64](ctx, ss))
 		}
 		r := make([]byte, xv.Len())
 		n := byte(0)
@@ -194,13 +195,14 @@ func classifyBytes(xs []byte) []byte {
 	return r
 }
 
-func classifyInt64s[T integer](xs []int64, min, span int64) []T {
+func classifyInt64s[T integer](ctx *Context, xs []int64, min, span int64) []T {
 	// len(xs) <= MaxIntT so that n+1 fits in T
 	r := make([]T, len(xs))
 	var n T
 	offset := -min
 	m := make([]T, span)
 	for i, xi := range xs {
+		ctx.pollInterrupt(i)
 		c := m[xi+offset]
 		if c == 0 {
 			r[i] = n
@@ -213,11 +215,12 @@ func classifyInt64s[T integer](xs []int64, min, span int64) []T {
 	return r
 }
 
-func classifySlice[T comparable, I integer](xs []T) []I {
+func classifySlice[T comparable, I integer](ctx *Context, xs []T) []I {
 	r := make([]I, len(xs))
 	m := map[T]I{}
 	n := I(0)
 	for i, xi := range xs {
+		ctx.pollInterrupt(i)
 		c, ok := m[xi]
 		if !ok {
 			r[i] = n
@@ -1139,15 +1142,15 @@ func occurrenceCountSortedSlice[T comparable](xs []T) []int64 {
 }
 
 // without returns x^y.
-func without(x, y V) V {
+func without(ctx *Context, x, y V) V {
 	if x.IsI() {
-		return windows(x.I(), y)
+		return windows(ctx, x.I(), y)
 	}
 	if x.IsF() {
 		if !isI(x.F()) {
 			return Panicf("i^y : i non-integer (%g)", x.F())
 		}
-		return windows(int64(x.F()), y)
+		return windows(ctx, int64(x.F()), y)
 	}
 	switch xv := x.bv.(type) {
 	case S:
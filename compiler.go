@@ -31,8 +31,11 @@ type lambdaCode struct {
 	UnusedArgs  []int32   // reversed indices of unused arguments
 	UsedArgs    []int32   // reversed indices of used arguments
 	AssignLists [][]int32 // assignement lists (resolved)
+	Captures    []int32   // variables capturing locals of enclosing lambdas (resolved)
 
 	namedArgs   bool                   // uses named parameters like {[a;b;c]....}
+	captures    []string               // names of captured locals, in order
+	freeGlobals map[string]int         // globals read in nested lambdas -> position
 	lastUses    []lastUse              // opcode index and block number of variable last use
 	joinPoints  []int32                // number of jumps ending at a given opcode index
 	assignLists [][]lambdaLocal        // assignement lists (locals)
@@ -430,9 +433,8 @@ func (c *compiler) doToken(tok *astToken, n int) error {
 			c.doGlobal(tok, n)
 			return nil
 		}
-		// local scope: argument, local or global variable
-		c.doLocal(tok, n)
-		return nil
+		// local scope: argument, local, captured or global variable
+		return c.doLocal(tok, n)
 	case astDYAD:
 		c.doVariadic(tok, n)
 		return nil
@@ -497,16 +499,81 @@ func (c *compiler) doGlobal(tok *astToken, n int) {
 	}
 }
 
-func (c *compiler) doLocal(tok *astToken, n int) {
+func (c *compiler) doLocal(tok *astToken, n int) error {
 	lc := c.scope()
-	local, ok := lc.local(tok.Text)
+	local, ok, err := c.lookupLocal(tok.Text)
+	if err != nil {
+		return err
+	}
 	if ok {
 		c.push2(opLocal, opArg)
 		lc.opIdxLocal[len(lc.Body)-1] = local
 		c.applyN(n)
-		return
+		return nil
 	}
+	c.freeGlobal(tok.Text, tok.Pos)
 	c.doGlobal(tok, n)
+	return nil
+}
+
+// lookupLocal returns the local with the given name in the current lambda. If
+// there is none, but an enclosing lambda has a local with that name, it
+// returns a new variable capturing its value.
+func (c *compiler) lookupLocal(name string) (lambdaLocal, bool, error) {
+	lc := c.scope()
+	_, exists := lc.locals[name]
+	local, ok := lc.local(name)
+	if ok {
+		if !exists {
+			// new implicit argument
+			return local, true, c.checkNewLocal(name)
+		}
+		return local, true, nil
+	}
+	for i := len(c.scopeStack) - 2; i >= 0; i-- {
+		// Implicit arguments x, y and z of an enclosing lambda are
+		// defined as if used there.
+		if _, ok := c.scopeStack[i].local(name); ok {
+			local = lambdaLocal{Type: localVar, ID: lc.nVars}
+			lc.locals[name] = local
+			lc.nVars++
+			lc.captures = append(lc.captures, name)
+			return local, true, nil
+		}
+	}
+	return lambdaLocal{}, false, nil
+}
+
+// newLocal returns a new variable with the given name in the current lambda.
+func (c *compiler) newLocal(name string) (lambdaLocal, error) {
+	lc := c.scope()
+	local := lambdaLocal{Type: localVar, ID: lc.nVars}
+	lc.locals[name] = local
+	lc.nVars++
+	return local, c.checkNewLocal(name)
+}
+
+// freeGlobal records that a lambda reads a global with the given name at
+// position pos, so that enclosing lambdas can check it is not ambiguous.
+func (c *compiler) freeGlobal(name string, pos int) {
+	for _, lc := range c.scopeStack[:len(c.scopeStack)-1] {
+		if lc.freeGlobals == nil {
+			lc.freeGlobals = map[string]int{}
+		}
+		if _, ok := lc.freeGlobals[name]; !ok {
+			lc.freeGlobals[name] = pos
+		}
+	}
+}
+
+// checkNewLocal returns an error if a new local of the current lambda was
+// previously read as a global by a nested lambda: the nested lambda would
+// otherwise capture it, if the local had been defined before.
+func (c *compiler) checkNewLocal(name string) error {
+	if pos, ok := c.scope().freeGlobals[name]; ok {
+		return c.perrorf(pos, "ambiguous %s in nested lambda: refers to a global, but is a local defined later in enclosing lambda", name)
+	}
+	return nil
 }
 
 func (c *compiler) doAdverb(tok *astToken) {
@@ -572,9 +639,10 @@ func (c *compiler) doAssign(e *astAssign, n int) error {
 	}
 	local, ok := lc.local(e.Name)
 	if !ok {
-		local = lambdaLocal{Type: localVar, ID: lc.nVars}
-		lc.locals[e.Name] = local
-		lc.nVars++
+		local, err = c.newLocal(e.Name)
+		if err != nil {
+			return err
+		}
 	}
 	c.push2(opAssignLocal, opArg)
 	lc.opIdxLocal[len(lc.Body)-1] = local
@@ -605,9 +673,10 @@ func (c *compiler) doListAssign(e *astListAssign, n int) error {
 	for i, name := range e.Names {
 		local, ok := lc.local(name)
 		if !ok {
-			local = lambdaLocal{Type: localVar, ID: lc.nVars}
-			lc.locals[name] = local
-			lc.nVars++
+			local, err = c.newLocal(name)
+			if err != nil {
+				return err
+			}
 		}
 		localList[i] = local
 	}
@@ -624,17 +693,17 @@ func (c *compiler) doAssignOp(e *astAssignOp, n int) error {
 	}
 	lc := c.scope()
 	if lc == nil || e.Global {
-		id, ok := c.ctx.gIDs[e.Name]
-		if !ok {
-			id = c.ctx.global(e.Name)
-		}
+		id := c.ctx.global(e.Name)
 		c.push2(opGlobalLast, opcode(id))
 		c.doVariadicAt(e.Dyad, e.Pos-1, 2)
 		c.push2(opAssignGlobal, opcode(id))
 		c.applyN(n)
 		return nil
 	}
-	local, ok := lc.local(e.Name)
+	local, ok, err := c.lookupLocal(e.Name)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		return c.perrorf(e.Pos,
 			"undefined local in assignement operation: %s", e.Name)
@@ -663,17 +732,17 @@ func (c *compiler) doAssignAmendOp(e *astAssignAmendOp, n int) error {
 	}
 	lc := c.scope()
 	if lc == nil || e.Global {
-		id, ok := c.ctx.gIDs[e.Name]
-		if !ok {
-			id = c.ctx.global(e.Name)
-		}
+		id := c.ctx.global(e.Name)
 		c.push2(opGlobalLast, opcode(id))
 		c.doVariadicAt("@", e.Pos-1, 4)
 		c.push2(opAssignGlobal, opcode(id))
 		c.applyN(n)
 		return nil
 	}
-	local, ok := lc.local(e.Name)
+	local, ok, err := c.lookupLocal(e.Name)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		return c.perrorf(e.Pos,
 			"undefined local in assignement amend operation: %s", e.Name)
@@ -699,17 +768,17 @@ func (c *compiler) doAssignDeepAmendOp(e *astAssignDeepAmendOp, n int) error {
 	}
 	lc := c.scope()
 	if lc == nil || e.Global {
-		id, ok := c.ctx.gIDs[e.Name]
-		if !ok {
-			id = c.ctx.global(e.Name)
-		}
+		id := c.ctx.global(e.Name)
 		c.push2(opGlobalLast, opcode(id))
 		c.doVariadicAt(".", e.Pos-1, 4)
 		c.push2(opAssignGlobal, opcode(id))
 		c.applyN(n)
 		return nil
 	}
-	local, ok := lc.local(e.Name)
+	local, ok, err := c.lookupLocal(e.Name)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		return c.perrorf(e.Pos,
 			"undefined local in assignement amend operation: %s", e.Name)
@@ -829,10 +898,27 @@ func (c *compiler) doLambda(b *astLambda, n int) error {
 	lc.StartPos = b.StartPos
 	lc.Source = c.ctx.sources[c.ctx.fname][lc.StartPos:b.EndPos]
 	lc.Filename = c.ctx.fname
+	captures := lc.captures
 	c.ctx.resolveLambda(lc)
 	analyzeLambdaLiveness(lc)
 	globalMonadicAssignOpAnalysis(lc.Body)
-	c.push2(opLambda, opcode(id))
+	analyzeTailCalls(lc.Body)
+	if len(captures) == 0 {
+		c.push2(opLambda, opcode(id))
+		c.applyAtN(b.EndPos-1, n)
+		return nil
+	}
+	// closure: push the captured values of the enclosing lambda's locals
+	opos := c.pos
+	c.pos = b.StartPos
+	for _, name := range captures {
+		err := c.doLocal(&astToken{Type: astIDENT, Pos: b.StartPos, Text: name}, 0)
+		if err != nil {
+			return err
+		}
+	}
+	c.pos = opos
+	c.push2(opClosure, opcode(id))
 	c.applyAtN(b.EndPos-1, n)
 	return nil
 }
@@ -906,10 +992,15 @@ func (ctx *Context) resolveLambda(lc *lambdaCode) {
 		}
 		ip += op.argc()
 	}
+	for _, name := range lc.captures {
+		lc.Captures = append(lc.Captures, int32(getID(lc.locals[name])))
+	}
 	// free unused data after this resolving pass
 	lc.locals = nil
 	lc.opIdxLocal = nil
 	lc.assignLists = nil
+	lc.captures = nil
+	lc.freeGlobals = nil
 }
 
 type lastUse struct {
@@ -1049,6 +1140,50 @@ func globalMonadicAssignOpAnalysis(ops []opcode) {
 	}
 }
 
+// analyzeTailCalls replaces apply opcodes in tail position in a lambda body
+// by their tail call variants, allowing the called lambda to reuse the
+// current frame. An apply is in tail position if it is directly followed by a
+// return, or the end of the body, possibly after jumps, as at the end of the
+// branches of a conditional.
+func analyzeTailCalls(ops []opcode) {
+	for ip := 0; ip < len(ops); ip += ops[ip].argc() + 1 {
+		var top opcode
+		switch ops[ip] {
+		case opApply:
+			top = opTailApply
+		case opApplyGlobal:
+			top = opTailApplyGlobal
+		case opApply2:
+			top = opTailApply2
+		case opApplyN:
+			top = opTailApplyN
+		case opApplyNGlobal:
+			top = opTailApplyNGlobal
+		default:
+			continue
+		}
+		if isTail(ops, ip+ops[ip].argc()+1) {
+			ops[ip] = top
+		}
+	}
+}
+
+// isTail reports whether execution from ip returns without doing anything
+// else.
+func isTail(ops []opcode, ip int) bool {
+	for ip < len(ops) {
+		switch ops[ip] {
+		case opReturn:
+			return true
+		case opJump:
+			ip += 1 + int(ops[ip+1])
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (c *compiler) doApply2(a *astApply2, n int) error {
 	switch v := a.Verb.(type) {
 	case *astToken:
@@ -28,10 +28,12 @@
 package goal
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"sort"
 	"strings"
 )
 
@@ -46,7 +48,17 @@ type Context struct {
 	stack     []V
 	frameIdx  int32
 	callDepth int32
-	lambda    int // currently executed lambda (if any)
+	lambda    int         // currently executed lambda (if any)
+	tail      pendingCall // tail call replacing the current frame (if any)
+	intr      *interrupt  // cancellation state (if any)
+
+	// resource limits
+	usage        *usage // resource usage (nil if no limits)
+	callDepthMax int32  // maximum call depth
+
+	// debugging
+	dbg  *debugState // execution hook state (if any)
+	prof *profiler   // profiling state (if any)
 
 	// values
 	globals        []V            // global variables
@@ -59,6 +71,7 @@ type Context struct {
 	gNames       []string       // ID: name
 	gIDs         map[string]int // name: ID
 	gPrefix      string         // current name prefix
+	pkg          *pkgState      // package export state (if any)
 	gAssignLists [][]int        // index: assign list ids
 
 	// parsing, scanning
@@ -70,7 +83,8 @@ type Context struct {
 	vNames   map[string]variadic  // variadic keywords
 
 	// error positions stack
-	errPos []position
+	errPos    []position
+	errElided int // number of positions omitted because of MaxFrames
 
 	// rand
 	rand *rand.Rand
@@ -85,6 +99,20 @@ type Context struct {
 	Log  io.Writer // output writer for logging with \expr and rt.log
 	Prec int       // floating point formatting precision (default: -1)
 	OFS  string    // output field separator (default: " ")
+
+	// Clock provides the current time for time builtins (system clock
+	// if nil). It is not used by rt.time, which measures real durations.
+	Clock Clock
+
+	// Standard input, output and error streams used by the os package
+	// and cmd (os.Stdin, os.Stdout and os.Stderr if nil).
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// MaxFrames is the maximum number of frames kept in error stack
+	// traces (default: 50). A non-positive value means no limit.
+	MaxFrames int
 }
 
 // NewContext returns a new context for compiling and interpreting code, with
@@ -99,6 +127,8 @@ func NewContext() *Context {
 	ctx.sconstants = map[string]int{}
 	ctx.Prec = -1
 	ctx.OFS = " "
+	ctx.MaxFrames = 50
+	ctx.callDepthMax = maxCallDepth
 	ctx.initVariadics()
 	return ctx
 }
@@ -107,6 +137,109 @@ const (
 	constAV = iota
 )
 
+// ContextOptions represents options for creating a context with
+// NewContextWith.
+type ContextOptions struct {
+	// Allow, if non-nil, lists the only builtin keywords to register,
+	// like "abs" or "rt.seed". An empty non-nil list means only primitive
+	// verbs and adverbs are available.
+	Allow []string
+
+	// Deny lists builtin keywords that should not be registered.
+	Deny []string
+}
+
+// NewContextWith returns a new context like NewContext, but registering only
+// the builtin keywords selected by opts. Keywords registered later, like the
+// IO ones from the os package, are not affected: they can be removed with
+// Unregister.
+func NewContextWith(opts ContextOptions) *Context {
+	ctx := NewContext()
+	ctx.restrict(opts)
+	return ctx
+}
+
+// restrict unregisters builtin keywords not allowed by opts.
+func (ctx *Context) restrict(opts ContextOptions) {
+	var allow map[string]bool
+	if opts.Allow != nil {
+		allow = make(map[string]bool, len(opts.Allow))
+		for _, name := range opts.Allow {
+			allow[name] = true
+		}
+	}
+	for name := range ctx.keywords {
+		if allow != nil && !allow[name] {
+			ctx.unregister(name)
+		}
+	}
+	for _, name := range opts.Deny {
+		if _, ok := ctx.keywords[name]; ok {
+			ctx.unregister(name)
+		}
+	}
+}
+
+// sandbox returns a new context for restricted evaluation, with the builtin
+// keywords still registered in ctx, using the same variadic functions.
+func (ctx *Context) sandbox() *Context {
+	nctx := NewContextWith(ContextOptions{Allow: ctx.Keywords()})
+	for name, t := range nctx.keywords {
+		if ctx.keywords[name] == t {
+			nctx.variadics[nctx.vNames[name]] = ctx.variadics[ctx.vNames[name]]
+		} else {
+			nctx.unregister(name)
+		}
+	}
+	return nctx
+}
+
+// Keywords returns the sorted list of keywords registered in the context.
+func (ctx *Context) Keywords() []string {
+	r := make([]string, 0, len(ctx.keywords))
+	for name := range ctx.keywords {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Unregister removes a keyword registered with RegisterMonad or RegisterDyad,
+// including builtin ones. It reports whether the keyword was registered. The
+// name is then parsed as an ordinary identifier, and may be registered
+// again. Already compiled code using the keyword panics when calling it.
+func (ctx *Context) Unregister(name string) bool {
+	if _, ok := ctx.keywords[name]; !ok {
+		return false
+	}
+	ctx.variadics = append([]VariadicFun(nil), ctx.variadics...)
+	ctx.unregister(name)
+	return true
+}
+
+func (ctx *Context) unregister(name string) {
+	v := ctx.vNames[name]
+	delete(ctx.keywords, name)
+	delete(ctx.vNames, name)
+	ctx.variadics[v] = func(ctx *Context, args []V) V {
+		return Panicf("%s : keyword not available", name)
+	}
+}
+
+// Override replaces the variadic function of a keyword registered with
+// RegisterMonad or RegisterDyad, including builtin ones, keeping its
+// monadic or dyadic parsing. The variadic is also returned as a value. It
+// panics if the keyword is not registered.
+func (ctx *Context) Override(name string, vf VariadicFun) V {
+	if _, ok := ctx.keywords[name]; !ok {
+		panic(fmt.Sprintf("Override: keyword %s not registered", name))
+	}
+	v := ctx.vNames[name]
+	ctx.variadics = append([]VariadicFun(nil), ctx.variadics...)
+	ctx.variadics[v] = vf
+	return newVariadic(v)
+}
+
 // RegisterMonad adds a variadic function to the context, and generates a new
 // monadic keyword for that variadic (parsing will not search for a left
 // argument). The variadic is also returned as a value.
@@ -211,6 +344,10 @@ func (ctx *Context) Run() (V, error) {
 	if len(ctx.gCode.Body) == 0 {
 		return V{}, nil
 	}
+	if ctx.usage != nil {
+		ctx.usage.startRun()
+		defer ctx.usage.endRun()
+	}
 	err := ctx.exec()
 	if err != nil {
 		return V{}, err
@@ -218,6 +355,98 @@ func (ctx *Context) Run() (V, error) {
 	return ctx.pop(), nil
 }
 
+// Program represents compiled code that can be run several times.
+type Program struct {
+	loc      string
+	code     globalCode
+	assigned bool
+}
+
+// CompileProgram is like Compile, but returns the compiled code as a program,
+// that can then be run several times with RunProgram. Compiled code is not
+// kept for Run.
+func (ctx *Context) CompileProgram(loc string, s string) (*Program, error) {
+	if err := ctx.Compile(loc, s); err != nil {
+		return nil, err
+	}
+	p := &Program{loc: loc, assigned: ctx.assigned}
+	p.code.Body = append([]opcode(nil), ctx.gCode.Body...)
+	p.code.Pos = append([]int(nil), ctx.gCode.Pos...)
+	p.code.last = ctx.gCode.last
+	ctx.resetCode()
+	return p, nil
+}
+
+// RunProgram runs a program compiled with CompileProgram, and returns the
+// result value.
+func (ctx *Context) RunProgram(p *Program) (V, error) {
+	ofname := ctx.fname
+	defer func() {
+		ctx.fname = ofname
+	}()
+	ctx.fname = p.loc
+	ctx.gCode.Body = append(ctx.gCode.Body[:0], p.code.Body...)
+	ctx.gCode.Pos = append(ctx.gCode.Pos[:0], p.code.Pos...)
+	ctx.gCode.last = p.code.last
+	ctx.assigned = p.assigned
+	return ctx.Run()
+}
+
+// RunContext is like Run, but execution is interrupted as soon as possible
+// when gctx is done. In that case, the returned error is a *PanicError
+// wrapping gctx.Err(), so that it can be checked with errors.Is, and the
+// context can still be used afterwards.
+func (ctx *Context) RunContext(gctx context.Context) (V, error) {
+	if len(ctx.gCode.Body) == 0 {
+		return V{}, nil
+	}
+	if err := gctx.Err(); err != nil {
+		ctx.resetCode()
+		return V{}, &PanicError{Msg: "interrupted: " + err.Error(), cause: err}
+	}
+	ointr := ctx.intr
+	intr := &interrupt{}
+	ctx.intr = intr
+	stop := make(chan struct{})
+	if done := gctx.Done(); done != nil {
+		go func() {
+			select {
+			case <-done:
+				intr.set()
+			case <-stop:
+			}
+		}()
+	}
+	slen := len(ctx.stack)
+	r, err := ctx.Run()
+	close(stop)
+	ctx.intr = ointr
+	if err != nil && intr.isSet() {
+		ctx.resetStack(slen)
+		e := err.(*PanicError)
+		e.cause = gctx.Err()
+		e.Msg = "interrupted: " + e.cause.Error()
+		return V{}, e
+	}
+	return r, err
+}
+
+// resetStack restores the execution state after an interrupted run, keeping
+// only the first n values of the stack.
+func (ctx *Context) resetStack(n int) {
+	if n > len(ctx.stack) {
+		n = len(ctx.stack)
+	}
+	rest := ctx.stack[n:]
+	for i := range rest {
+		rest[i] = V{}
+	}
+	ctx.stack = ctx.stack[:n]
+	ctx.frameIdx = 0
+	ctx.callDepth = 0
+	ctx.lambda = 0
+}
+
 // Eval calls Compile with the given string and an empty location, and then
 // Run.  You cannot call it within a variadic function, as the evaluation is
 // done on the current context, so it would interrupt compilation of current
@@ -234,6 +463,19 @@ func (ctx *Context) Eval(s string) (V, error) {
 	return ctx.Run()
 }
 
+// EvalContext is like Eval, but runs the code with RunContext.
+func (ctx *Context) EvalContext(gctx context.Context, s string) (V, error) {
+	ofname := ctx.fname
+	defer func() {
+		ctx.fname = ofname
+	}()
+	err := ctx.Compile("", s)
+	if err != nil {
+		return V{}, err
+	}
+	return ctx.RunContext(gctx)
+}
+
 // ErrPackageImported is returned by EvalPackage for packages that have already
 // been processed (same location).
 type ErrPackageImported struct{}
@@ -251,7 +493,9 @@ func (e ErrPackageImported) Error() string {
 // if separate files using the same package can be used together or alone),
 // only the first one counts.  The package is evaluated in a derived context
 // that is then merged on successful completion, so this function can be called
-// within a variadic function.
+// within a variadic function. If the package declares exported names with
+// top-level export statements and pfx is not empty, its other globals are kept
+// private to the package.
 func (ctx *Context) EvalPackage(s, loc, pfx string) (V, error) {
 	ofname := ctx.fname
 	defer func() {
@@ -269,6 +513,9 @@ func (ctx *Context) EvalPackage(s, loc, pfx string) (V, error) {
 		return NewI(0), ErrPackageImported{}
 	}
 	nctx := ctx.derive()
+	if exports := scanExports(ctx.keywords, s); exports != nil {
+		nctx.pkg = &pkgState{exports: exports, private: map[string]int{}}
+	}
 	err := nctx.Compile(loc, s)
 	if err != nil {
 		ctx.merge(nctx)
@@ -282,6 +529,12 @@ func (ctx *Context) EvalPackage(s, loc, pfx string) (V, error) {
 	return r, nil
 }
 
+// Location returns the location of the code being compiled or run, as given
+// to Compile or EvalPackage, or an empty string for code evaluated with Eval.
+func (ctx *Context) Location() string {
+	return ctx.fname
+}
+
 // AssignedLast returns true if the last compiled expression was an assignment.
 func (ctx *Context) AssignedLast() bool {
 	return ctx.assigned
@@ -300,19 +553,22 @@ func (ctx *Context) checkAssign() {
 }
 
 func (ctx *Context) exec() error {
+	prof := ctx.prof
+	if prof != nil {
+		ctx.pushProfFrame(nil)
+	}
 	ip, err := ctx.execute(ctx.gCode.Body)
+	if prof != nil {
+		ctx.popProfFrame(prof)
+	}
 	if err != nil {
 		ctx.stack = ctx.stack[0:]
 		ctx.push(V{})
-		ctx.updateErrPos(ip, nil)
-		ctx.gCode.Body = ctx.gCode.Body[:0]
-		ctx.gCode.Pos = ctx.gCode.Pos[:0]
-		ctx.gCode.last = 0
+		ctx.updateErrPos(ip, nil, 0)
+		ctx.resetCode()
 		return ctx.getError(err, false)
 	}
-	ctx.gCode.Body = ctx.gCode.Body[:0]
-	ctx.gCode.Pos = ctx.gCode.Pos[:0]
-	ctx.gCode.last = 0
+	ctx.resetCode()
 	if len(ctx.stack) == 0 {
 		// should not happen
 		return ctx.getError(errors.New("no result: empty stack"), false)
@@ -320,18 +576,28 @@ func (ctx *Context) exec() error {
 	return nil
 }
 
+// resetCode clears the last compiled global code.
+func (ctx *Context) resetCode() {
+	ctx.gCode.Body = ctx.gCode.Body[:0]
+	ctx.gCode.Pos = ctx.gCode.Pos[:0]
+	ctx.gCode.last = 0
+}
+
 func (ctx *Context) getError(err error, compile bool) error {
 	e := &PanicError{
 		Msg:       err.Error(),
+		Elided:    ctx.errElided,
 		positions: ctx.errPos,
 		sources:   ctx.sources,
 		compile:   compile,
 	}
+	e.Frames = e.frames(ctx)
 	ctx.errPos = nil
+	ctx.errElided = 0
 	return e
 }
 
-func (ctx *Context) updateErrPos(ip int, lc *lambdaCode) {
+func (ctx *Context) updateErrPos(ip int, lc *lambdaCode, tails int) {
 	fname := ctx.fname
 	if lc != nil {
 		fname = lc.Filename
@@ -346,14 +612,73 @@ func (ctx *Context) updateErrPos(ip int, lc *lambdaCode) {
 			ip = len(lc.Body) - 1
 		}
 		pos := lc.Pos[ip]
-		ctx.errPos = append(ctx.errPos, position{Filename: fname, Pos: pos, lambda: lc})
+		ctx.pushErrPos(position{Filename: fname, Pos: pos, lambda: lc, tails: tails})
 	} else {
 		if ip >= len(ctx.gCode.Body) || ip < 0 {
 			ip = len(ctx.gCode.Body) - 1
 		}
 		pos := ctx.gCode.Pos[ip]
-		ctx.errPos = append(ctx.errPos, position{Filename: fname, Pos: pos})
+		ctx.pushErrPos(position{Filename: fname, Pos: pos})
+	}
+}
+
+// maxErrCycle is the maximum number of positions in a cycle of recursive
+// calls collapsed by pushErrPos.
+const maxErrCycle = 4
+
+// pushErrPos adds a position to the error stack, collapsing repeated cycles
+// of positions produced by recursion. When MaxFrames is exceeded, the
+// position before the last is dropped, so that the outermost position is
+// kept.
+func (ctx *Context) pushErrPos(p position) {
+	ctx.errPos = append(ctx.errPos, p)
+	ctx.collapseErrPos()
+	n := len(ctx.errPos)
+	if ctx.MaxFrames > 0 && n > ctx.MaxFrames {
+		i := n - 2
+		if ctx.MaxFrames == 1 {
+			i = n - 1
+		}
+		d := ctx.errPos[i]
+		k := 1 + d.elided + d.repeat*d.cycle
+		ctx.errElided += k
+		ctx.errPos = append(ctx.errPos[:i], ctx.errPos[i+1:]...)
+		ctx.errPos[i-1].elided += k
+	}
+}
+
+// collapseErrPos collapses the last positions of the error stack if they
+// repeat the positions just before them, for cycles of up to maxErrCycle
+// positions, as produced by direct or mutual recursion.
+func (ctx *Context) collapseErrPos() {
+	n := len(ctx.errPos)
+	for l := 1; l <= maxErrCycle && 2*l <= n; l++ {
+		prev, last := ctx.errPos[n-2*l:n-l], ctx.errPos[n-l:]
+		if !sameErrCycle(prev, last) {
+			continue
+		}
+		prev[l-1].repeat++
+		prev[l-1].cycle = l
+		ctx.errPos = ctx.errPos[:n-l]
+		return
+	}
+}
+
+// sameErrCycle reports whether the new positions in last repeat the ones in
+// prev, whose last position may already record previous repetitions.
+func sameErrCycle(prev, last []position) bool {
+	l := len(last)
+	for i := 0; i < l-1; i++ {
+		if prev[i] != last[i] {
+			return false
+		}
+	}
+	p, q := prev[l-1], last[l-1]
+	if q.repeat > 0 || q.elided > 0 || p.repeat > 0 && p.cycle != l {
+		return false
 	}
+	p.repeat, p.cycle = 0, 0
+	return p == q
 }
 
 // Show returns a string representation with debug information about the
@@ -362,6 +687,24 @@ func (ctx *Context) Show() string {
 	return ctx.programString()
 }
 
+// Disassemble compiles s without running it, and returns a string
+// representation of the resulting instructions, followed by the ones of any
+// new lambdas. The context is not modified.
+func (ctx *Context) Disassemble(s string) (string, error) {
+	nctx := ctx.lintContext()
+	llen := len(nctx.lambdas)
+	if err := nctx.Compile("", s); err != nil {
+		return "", err
+	}
+	sb := strings.Builder{}
+	sb.WriteString(nctx.opcodesString(nctx.gCode.Body, nil))
+	for i, lc := range nctx.lambdas[llen:] {
+		fmt.Fprintf(&sb, "---- Lambda %d (Rank: %d) -----\n", llen+i, lc.Rank)
+		sb.WriteString(nctx.lambdaString(lc))
+	}
+	return sb.String(), nil
+}
+
 func (ctx *Context) storeConst(x V) int {
 	if ctx.compiler.scope() != nil {
 		x.MarkImmutable()
@@ -371,6 +714,9 @@ func (ctx *Context) storeConst(x V) int {
 }
 
 func (ctx *Context) global(s string) int {
+	if id, ok := ctx.privateGlobal(s); ok {
+		return id
+	}
 	if ctx.gPrefix != "" && !strings.ContainsRune(s, '.') {
 		s = ctx.gPrefix + "." + s
 	} else {
@@ -397,7 +743,16 @@ func (ctx *Context) derive() *Context {
 	nctx.keywords = ctx.keywords
 	nctx.vNames = ctx.vNames
 	nctx.rand = ctx.rand
+	nctx.intr = ctx.intr
+	nctx.usage = ctx.usage
+	nctx.callDepthMax = ctx.callDepthMax
+	nctx.dbg = ctx.dbg
+	nctx.prof = ctx.prof
 	nctx.Log = ctx.Log
+	nctx.Clock = ctx.Clock
+	nctx.Stdin = ctx.Stdin
+	nctx.Stdout = ctx.Stdout
+	nctx.Stderr = ctx.Stderr
 
 	nctx.constants = ctx.constants
 	nctx.sconstants = ctx.sconstants
@@ -409,6 +764,73 @@ func (ctx *Context) derive() *Context {
 	nctx.gPrefix = ctx.gPrefix
 	nctx.Prec = ctx.Prec
 	nctx.OFS = ctx.OFS
+	nctx.MaxFrames = ctx.MaxFrames
+	return nctx
+}
+
+// Fork returns a new independent context that can be used concurrently with
+// ctx, for example in another goroutine. The forked context shares with ctx
+// compiled lambdas, constants and registered variadics. It has its own stack
+// and random number generator, and its own copy of the global variables.
+// Values shared by both contexts are marked as immutable, so that
+// modifications in one context never affect the other. Fork should not be
+// called while ctx is running.
+func (ctx *Context) Fork() *Context {
+	nctx := &Context{}
+	nctx.gCode = &globalCode{}
+	nctx.stack = make([]V, 0, 32)
+
+	nctx.variadics = ctx.variadics[:len(ctx.variadics):len(ctx.variadics)]
+	nctx.variadicsNames = ctx.variadicsNames[:len(ctx.variadicsNames):len(ctx.variadicsNames)]
+	nctx.keywords = make(map[string]IdentType, len(ctx.keywords))
+	for k, v := range ctx.keywords {
+		nctx.keywords[k] = v
+	}
+	nctx.vNames = make(map[string]variadic, len(ctx.vNames))
+	for k, v := range ctx.vNames {
+		nctx.vNames[k] = v
+	}
+	if ctx.rand == nil {
+		ctx.rand = rand.New(rand.NewSource(1))
+	}
+	nctx.rand = rand.New(rand.NewSource(ctx.rand.Int63()))
+	if ctx.usage != nil {
+		nctx.usage = &usage{limits: ctx.usage.limits}
+	}
+	nctx.callDepthMax = ctx.callDepthMax
+	nctx.Log = ctx.Log
+	nctx.Clock = ctx.Clock
+	nctx.Stdin = ctx.Stdin
+	nctx.Stdout = ctx.Stdout
+	nctx.Stderr = ctx.Stderr
+
+	for _, x := range ctx.constants {
+		markImmutableRec(x)
+	}
+	nctx.constants = ctx.constants[:len(ctx.constants):len(ctx.constants)]
+	nctx.sconstants = make(map[string]int, len(ctx.sconstants))
+	for k, v := range ctx.sconstants {
+		nctx.sconstants[k] = v
+	}
+	nctx.lambdas = ctx.lambdas[:len(ctx.lambdas):len(ctx.lambdas)]
+	for _, x := range ctx.globals {
+		markImmutableRec(x)
+	}
+	nctx.globals = make([]V, len(ctx.globals))
+	copy(nctx.globals, ctx.globals)
+	nctx.gNames = ctx.gNames[:len(ctx.gNames):len(ctx.gNames)]
+	nctx.gIDs = make(map[string]int, len(ctx.gIDs))
+	for k, v := range ctx.gIDs {
+		nctx.gIDs[k] = v
+	}
+	nctx.gAssignLists = ctx.gAssignLists[:len(ctx.gAssignLists):len(ctx.gAssignLists)]
+	nctx.sources = make(map[string]string, len(ctx.sources))
+	for k, v := range ctx.sources {
+		nctx.sources[k] = v
+	}
+	nctx.Prec = ctx.Prec
+	nctx.OFS = ctx.OFS
+	nctx.MaxFrames = ctx.MaxFrames
 	return nctx
 }
 
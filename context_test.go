@@ -1,12 +1,19 @@
 package goal
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 type matchTest struct {
@@ -176,6 +183,942 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestRunContext(t *testing.T) {
+	ctx := NewContext()
+	gctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := ctx.EvalContext(gctx, "f:{x+1};1e12 f/0")
+	if err == nil {
+		t.Fatalf("no error for cancelled evaluation")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("bad error: %v", err)
+	}
+	if ctx.callDepth != 0 || len(ctx.stack) != 0 {
+		t.Fatalf("bad state after interruption: depth %d, stack %d", ctx.callDepth, len(ctx.stack))
+	}
+	gctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ctx.EvalContext(gctx, `.[{1e12 f/x};0;{"caught"}]`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("interruption caught by try: %v", err)
+	}
+	gctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ctx.EvalContext(gctx, "g:{g x};g 0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("bad error for tail call loop: %v", err)
+	}
+	r, err := ctx.Eval("f 2")
+	if err != nil || !r.Matches(NewI(3)) {
+		t.Fatalf("bad result after interruption: %v (%v)", r, err)
+	}
+}
+
+func TestInterruptPrimitives(t *testing.T) {
+	ctx := NewContext()
+	x, err := ctx.Eval("x:4e6?1e9;y:4e6?1e3;x")
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	y, _ := ctx.Eval("y")
+	ctx.intr = &interrupt{}
+	ctx.intr.set()
+	prims := []struct {
+		Name string
+		F    func() V
+	}{
+		{"sort", func() V { return sortUp(ctx, x) }},
+		{"ascend", func() V { return ascend(ctx, x) }},
+		{"descend", func() V { return descend(ctx, x) }},
+		{"icount", func() V { return icountGroup(ctx, y) }},
+		{"group-by", func() V { return groupBy(ctx, y, y) }},
+		{"classify", func() V { return classify(ctx, x) }},
+	}
+	for _, p := range prims {
+		r := p.F()
+		if !r.IsPanic() {
+			t.Errorf("%s: no interruption", p.Name)
+		}
+	}
+	ctx.intr = nil
+	gctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ctx.EvalContext(gctx, "^x")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("bad error for large sort: %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := NewContext()
+	ctx.SetLimits(Limits{MaxOps: 10000, MaxArrayLen: 1000, MaxAlloc: 5000, MaxCallDepth: 50})
+	tests := []struct {
+		Expr string
+		Msg  string
+	}{
+		{"!1000000000", "array too big"},
+		{`1e9#"x"`, "array too big"},
+		{"2^!100000", "array too big"},
+		{"!1000 1000", "array too big"},
+		{"&1000000", "array too big"},
+		{"&,1000000000", "array too big"},
+		{"&1000000000 0", "array too big"},
+		{"&(500 600)", "array too big"},
+		{"{,100000000}#,1", "array too big"},
+		{"{600 600}#1 2", "array too big"},
+		{"{1e9}#,1", "array too big"},
+		{"1e9@1 2", "array too big"},
+		{"(-1e9)@(,\"a\")!,1", "array too big"},
+		{"10 {x+#!900}/0", "exceeded maximum allocation"},
+		{"(!600),!600", "array too big"},
+		{"10 {x,!900}/!0", "array too big"},
+		{"1e9?0", "array too big"},
+		{"(-1e9)?1e9", "array too big"},
+		{"?1e9", "array too big"},
+		{`1e9*"x"`, "array too big"},
+		{`"x"*1e9`, "array too big"},
+		{`(1e9 1e9)*"x"`, "array too big"},
+		{`1e9!"x"`, "array too big"},
+		{`(-1e9)!"x" "y"`, "array too big"},
+		{`json "[` + strings.Repeat("0,", 1100) + `0]"`, "array too big"},
+		{`csv "` + strings.Repeat("a,", 1100) + `a"`, "array too big"},
+		{"f:{1+f x};f 0", "exceeded maximum call depth"},
+		{"f:{f x};f 0", "exceeded maximum number of instructions"},
+		{"1000000 {x+1}/0", "exceeded maximum number of instructions"},
+		{`eval "!10000"`, "array too big"},
+	}
+	for _, test := range tests {
+		_, err := ctx.Eval(test.Expr)
+		if err == nil {
+			t.Errorf("%s: no error", test.Expr)
+			continue
+		}
+		if !strings.Contains(err.(*PanicError).Msg, test.Msg) {
+			t.Errorf("%s: bad error: %v", test.Expr, err)
+		}
+	}
+	r, err := ctx.Eval("+/!1000")
+	if err != nil || !r.Matches(NewI(499500)) {
+		t.Errorf("bad result within limits: %v (%v)", r, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	type item struct {
+		Name  string `goal:"name"`
+		Count int
+		Tags  []string
+		Skip  bool `goal:"-"`
+		When  time.Time
+	}
+	type doc struct {
+		Items []item
+		Meta  map[string]float64
+	}
+	ctx := NewContext()
+	d := doc{
+		Items: []item{{Name: "a", Count: 2, Tags: []string{"x", "y"}, When: time.Unix(5, 250)}},
+		Meta:  map[string]float64{"b": 1.5, "a": 2},
+	}
+	x, err := FromGo(d)
+	if err != nil {
+		t.Fatalf("FromGo: %v", err)
+	}
+	ctx.AssignGlobal("x", x)
+	r, err := ctx.Eval(`(x["Items";0;"name"];x["Items";0;"Tags"];x["Meta"];x["Items";0;"When"])~("a";"x" "y";"a" "b"!2.0 1.5;5000000250)`)
+	if err != nil || !r.Matches(NewI(1)) {
+		t.Errorf("FromGo: bad result: %v (%v)", x.Sprint(ctx), err)
+	}
+	var d2 doc
+	if err := x.ToGo(ctx, &d2); err != nil {
+		t.Fatalf("ToGo: %v", err)
+	}
+	if fmt.Sprint(d2) != fmt.Sprint(d) {
+		t.Errorf("ToGo: bad round trip: %v vs %v", d2, d)
+	}
+	var a interface{}
+	r, _ = ctx.Eval(`"a" "b"!(1 2;3.5)`)
+	if err := r.ToGo(ctx, &a); err != nil || fmt.Sprint(a) != "map[a:[1 2] b:3.5]" {
+		t.Errorf("ToGo: bad any result: %v (%v)", a, err)
+	}
+	r, _ = ctx.Eval(`(,"Items")!,,"name" "Count"!("a";1.5)`)
+	err = r.ToGo(ctx, &d2)
+	if err == nil || err.Error() != ".Items[0].Count: ToGo: non-integer value for int (1.5)" {
+		t.Errorf("ToGo: bad error: %v", err)
+	}
+	_, err = FromGo(map[string][]interface{}{"k": {1, make(chan int)}})
+	if err == nil || err.Error() != `["k"][1]: FromGo: unsupported type chan int` {
+		t.Errorf("FromGo: bad error: %v", err)
+	}
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: "a"}
+	n.Next = &node{Name: "b", Next: n}
+	_, err = FromGo(n)
+	if err == nil || err.Error() != ".Next.Next: FromGo: cyclic value of type *goal.node" {
+		t.Errorf("FromGo: bad error for cycle: %v", err)
+	}
+	l := []interface{}{1, nil}
+	l[1] = l
+	_, err = FromGo(l)
+	if err == nil || !strings.Contains(err.Error(), "cyclic value") {
+		t.Errorf("FromGo: bad error for cyclic slice: %v", err)
+	}
+	x, err = FromGo([]*doc{&d, &d})
+	if err != nil || x.Len() != 2 {
+		t.Errorf("FromGo: bad result for shared pointer: %v (%v)", x, err)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterFunc("repeat", func(s string, n int64) ([]string, error) {
+		if n < 0 {
+			return nil, errors.New("negative count")
+		}
+		r := make([]string, n)
+		for i := range r {
+			r[i] = s
+		}
+		return r, nil
+	})
+	ctx.RegisterFuncWith("half", func(x float64) float64 { return x / 2 }, FuncOptions{Vectorize: true})
+	ctx.RegisterFunc("sum", func(x ...int) (n int) {
+		for _, xi := range x {
+			n += xi
+		}
+		return n
+	})
+	ctx.RegisterFunc("zero", func() int { return 42 })
+	var called int
+	ctx.RegisterFunc("nop", func(s string) { called++ })
+	ctx.RegisterFunc("none", func() interface{} { return nil })
+	ctx.RegisterFunc("nonep", func() *int { return nil })
+	ctx.RegisterFunc("clamp", func(x, lo, hi int) int {
+		if x < lo {
+			return lo
+		}
+		if x > hi {
+			return hi
+		}
+		return x
+	})
+	tests := []struct {
+		Expr   string
+		Result string
+	}{
+		{`"a" repeat 2`, `"a" "a"`},
+		{`"a" repeat -1`, `error["negative count"]`},
+		{`half 3`, `1.5`},
+		{`half 1 2 3`, `0.5 1.0 1.5`},
+		{`sum[1;2;3]`, `6`},
+		{`sum 5`, `5`},
+		{`zero 0`, `42`},
+		{`zero[0]`, `42`},
+		{`x:nop "a"; x`, `1`},
+		{`none 0`, `0`},
+		{`nonep 0`, `0`},
+		{`clamp[5;1;3]`, `3`},
+	}
+	for _, test := range tests {
+		r, err := ctx.Eval(test.Expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.Expr, err)
+			continue
+		}
+		if s := r.Sprint(ctx); s != test.Result {
+			t.Errorf("%s: got %s, expected %s", test.Expr, s, test.Result)
+		}
+	}
+	errTests := []struct {
+		Expr string
+		Msg  string
+	}{
+		{`2 repeat 2`, `x repeat y : bad type "i" in x`},
+		{`"a" repeat 1.5`, `x repeat y : y: ToGo: non-integer value for int64 (1.5)`},
+		{`"a" repeat 1 2`, `x repeat y : bad type "I" in y`},
+		{`repeat["a";1;2]`, `x repeat y got too many arguments`},
+		{`sum "a"`, `sum[x;y;...] : bad type "s" in x`},
+		{`zero[1;2]`, `zero x got too many arguments`},
+		{`clamp["a";1;3]`, `clamp[x;y;z] : bad type "s" in x`},
+		{`clamp[1;3]`, `clamp[x;y;z] : f expected 3 arguments, but got 2`},
+	}
+	if called != 1 {
+		t.Errorf("nop called %d times", called)
+	}
+	for _, test := range errTests {
+		_, err := ctx.Eval(test.Expr)
+		if err == nil {
+			t.Errorf("%s: no error", test.Expr)
+			continue
+		}
+		if msg := err.(*PanicError).Msg; msg != test.Msg {
+			t.Errorf("%s: bad error: %s", test.Expr, msg)
+		}
+	}
+}
+
+func TestCompileTo(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterFunc("double", func(x int64) int64 { return 2 * x })
+	src := `f:{[x;y](a;b):x,y; a+b+double 3}; g:{[n]{n*x}}; s:"str" "ing"; r:rx/^a+$/; (f[1;2];s;r "aaa";2.5 3;1 "a";9876543210)`
+	if err := ctx.Compile("test.goal", src); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var buf strings.Builder
+	if err := ctx.CompileTo(&buf); err != nil {
+		t.Fatalf("CompileTo: %v", err)
+	}
+	want, err := ctx.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	nctx := NewContext()
+	nctx.AssignGlobal("z", NewI(1))
+	nctx.RegisterFunc("double", func(x int64) int64 { return 2 * x })
+	if err := nctx.LoadCompiled(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("LoadCompiled: %v", err)
+	}
+	got, err := nctx.Run()
+	if err != nil {
+		t.Fatalf("Run (loaded): %v", err)
+	}
+	if !got.Matches(want) {
+		t.Errorf("bad result: %s vs %s", got.Sprint(nctx), want.Sprint(ctx))
+	}
+	if r, err := nctx.Eval("z+f[3;4]"); err != nil || !r.Matches(NewI(14)) {
+		t.Errorf("bad result after load: %v (%v)", r, err)
+	}
+	if r, err := nctx.Eval("(g 2)5"); err != nil || !r.Matches(NewI(10)) {
+		t.Errorf("bad closure result after load: %v (%v)", r, err)
+	}
+	nctx = NewContext()
+	nglobals, nlists := len(nctx.globals), len(nctx.gAssignLists)
+	err = nctx.LoadCompiled(strings.NewReader(buf.String()))
+	if err == nil || !strings.Contains(err.Error(), "unknown variadic: double") {
+		t.Errorf("LoadCompiled: bad error: %v", err)
+	}
+	if len(nctx.globals) != nglobals || len(nctx.gNames) != nglobals || len(nctx.gIDs) != nglobals ||
+		len(nctx.gAssignLists) != nlists {
+		t.Errorf("LoadCompiled: context modified after error")
+	}
+	err = NewContext().LoadCompiled(strings.NewReader("\x07" + compiledMagic + "\x04\x80\x80\x80\x40"))
+	if err == nil || !strings.Contains(err.Error(), "length too big") {
+		t.Errorf("LoadCompiled: bad length error: %v", err)
+	}
+	bad := strings.Replace(buf.String(), compiledMagic+"\x04", compiledMagic+"\x05", 1)
+	err = NewContext().LoadCompiled(strings.NewReader(bad))
+	if err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("LoadCompiled: bad version error: %v", err)
+	}
+	for i := 0; i < buf.Len(); i++ {
+		err = NewContext().LoadCompiled(strings.NewReader(buf.String()[:i]))
+		if err == nil {
+			t.Errorf("LoadCompiled: no error for input truncated at %d", i)
+		}
+	}
+}
+
+func TestLoadCompiledCorrupted(t *testing.T) {
+	ctx := NewContext()
+	src := `f:{[x;y](a;b):x,y; a+b}; g:{[n]{n*x}}; h:{?[x;1;y]}; s:"str" "ing"; (f[1;2];s;2.5 3;h[0;2];(g 2)3;9 "a")`
+	if err := ctx.Compile("test.goal", src); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var buf strings.Builder
+	if err := ctx.CompileTo(&buf); err != nil {
+		t.Fatalf("CompileTo: %v", err)
+	}
+	// Corrupted code should either be rejected or run without panicking.
+	run := func(data []byte) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		nctx := NewContext()
+		nctx.SetLimits(Limits{MaxOps: 10000, MaxAlloc: 1e6, MaxCallDepth: 100})
+		if nctx.LoadCompiled(bytes.NewReader(data)) == nil {
+			nctx.Run()
+		}
+		return nil
+	}
+	for i := 0; i < buf.Len(); i++ {
+		for _, mask := range []byte{0x01, 0x02, 0x10, 0x7f, 0x80, 0xff} {
+			data := []byte(buf.String())
+			data[i] ^= mask
+			if err := run(data); err != nil {
+				t.Fatalf("byte %d flipped with %#x: %v", i, mask, err)
+			}
+		}
+	}
+	tests := []struct {
+		Ops []opcode
+		Msg string
+	}{
+		{[]opcode{opInt, 1, opJump, -3}, "invalid jump"},
+		{[]opcode{opInt, 1, opJump, 5}, "invalid jump"},
+		{[]opcode{opInt, 0, opJumpFalse, 3, opDrop, opInt, 2}, "invalid jump target"},
+		{[]opcode{opLocal, 0}, "invalid local"},
+		{[]opcode{opInt, 1, opListAssignLocal, 0}, "invalid assignment list"},
+		{[]opcode{opInt, 1, opDrop}, "invalid stack"},
+		{[]opcode{opInt, 1, opInt, 2, opApply2}, "invalid stack"},
+		{[]opcode{opInt, 1, opInt, 2, opApplyN, 0}, "invalid argument count"},
+		{[]opcode{opInt, 1, opInt, 0, opJumpFalse, 5, opInt, 3, opJump, 2, opDrop, opNil}, "inconsistent stack"},
+	}
+	for _, test := range tests {
+		lf := &loadedFile{body: test.Ops, pos: make([]int, len(test.Ops))}
+		err := NewContext().link(lf)
+		if err == nil || !strings.Contains(err.Error(), test.Msg) {
+			t.Errorf("%v: bad error: %v", test.Ops, err)
+		}
+	}
+	lf := &loadedFile{
+		lambdas: []*lambdaCode{{Body: []opcode{opLocal, 2}, Pos: []int{0, 0}, Names: []string{"x", "y"}, Rank: 2}},
+		body:    []opcode{opLambda, 0},
+		pos:     []int{0, 0},
+	}
+	if err := NewContext().link(lf); err == nil || !strings.Contains(err.Error(), "invalid local") {
+		t.Errorf("bad error for local out of range: %v", err)
+	}
+	lf.lambdas[0].Body = []opcode{opLocal, 1}
+	lf.lambdas[0].AssignLists = [][]int32{{0, 2}}
+	if err := NewContext().link(lf); err == nil || !strings.Contains(err.Error(), "invalid local in assignment list") {
+		t.Errorf("bad error for assignment list: %v", err)
+	}
+}
+
+func TestPrivateGlobals(t *testing.T) {
+	ctx := NewContext()
+	_, err := ctx.Eval("eval[`export \"f\";a:3;f:{a+x}`;\"p.goal\";\"p\"]")
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if names := fmt.Sprint(ctx.GlobalNames()); names != "[p.f]" {
+		t.Errorf("GlobalNames: got %s, expected [p.f]", names)
+	}
+	if err := ctx.Compile("main.goal", "p.f 1"); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	var buf strings.Builder
+	if err := ctx.CompileTo(&buf); err != nil {
+		t.Fatalf("CompileTo: %v", err)
+	}
+	nctx := NewContext()
+	nctx.AssignGlobal("p.a", NewI(5))
+	if err := nctx.LoadCompiled(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("LoadCompiled: %v", err)
+	}
+	if _, ok := nctx.gIDs["p.f"]; !ok {
+		t.Errorf("LoadCompiled: exported global p.f not loaded")
+	}
+	if x, _ := nctx.GetGlobal("p.a"); !x.Matches(NewI(5)) || len(nctx.privateGlobals()) != 1 {
+		t.Errorf("LoadCompiled: private global p.a became public")
+	}
+	if names := fmt.Sprint(nctx.GlobalNames()); names != "[p.a]" {
+		t.Errorf("GlobalNames after load: got %s, expected [p.a]", names)
+	}
+}
+
+func TestFork(t *testing.T) {
+	ctx := NewContext()
+	_, err := ctx.Eval(`a:!10; d:"x" "y"!(1 2;3 4); f:{[x;y]a+x*y}`)
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	const n = 8
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		fctx := ctx.Fork()
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				src := fmt.Sprintf(`a[0]+:1; a:a+%d; d["x"]:(%d;0); g:{x+1}; g f[1;2]`, i, i)
+				_, err := fctx.Eval(src)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			r, err := fctx.Eval("a[0 9]")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !r.Matches(NewAI([]int64{100 + 100*int64(i), 9 + 100*int64(i)})) {
+				errs <- fmt.Errorf("fork %d: bad result: %s", i, r.Sprint(fctx))
+				return
+			}
+			errs <- nil
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	r, err := ctx.Eval(`(a;d["x"])`)
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	want, _ := ctx.Eval(`(!10;1 2)`)
+	if !r.Matches(want) {
+		t.Errorf("parent modified: %s", r.Sprint(ctx))
+	}
+}
+
+func TestForkClosure(t *testing.T) {
+	ctx := NewContext()
+	_, err := ctx.Eval(`mk:{m:x; {a:m 0; a[0]:x; (a;m)}}; c:mk(1000+!2;1002+!2)`)
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	const n = 4
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		fctx := ctx.Fork()
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				r, err := fctx.Eval(fmt.Sprintf("c %d", i))
+				if err != nil {
+					errs <- err
+					return
+				}
+				want, _ := fctx.Eval(fmt.Sprintf("(%d 1001;(1000 1001;1002 1003))", i))
+				if !r.Matches(want) {
+					errs <- fmt.Errorf("fork %d: bad result: %s", i, r.Sprint(fctx))
+					return
+				}
+			}
+			errs <- nil
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	// values captured by closures are shared with forks
+	c, _ := ctx.GetGlobal("c")
+	m := c.bv.(*closure).Env[0].bv.(*AV)
+	if m.flags&flagImmutable == 0 {
+		t.Errorf("captured value not immutable: %s", NewV(m).Sprint(ctx))
+	}
+	for _, mi := range m.elts {
+		if mi.bv.(*AI).flags&flagImmutable == 0 {
+			t.Errorf("captured value not immutable: %s", mi.Sprint(ctx))
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	ctx := NewContext()
+	err := ctx.Compile("f.goal", "f:{?[x>5;1+`a`;f x+1]}\ng:{f x}\ng 0")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	_, err = ctx.Run()
+	e, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("bad error: %v", err)
+	}
+	// frames of tail calls are elided
+	want := []Frame{
+		{Filename: "f.goal", Line: 1, Column: 11, Lambda: "f", Excerpt: "f:{?[x>5;1+`a`;f x+1]}", Tails: 7},
+		{Filename: "f.goal", Line: 3, Column: 1, Excerpt: "g 0"},
+	}
+	if fmt.Sprint(e.Frames) != fmt.Sprint(want) {
+		t.Errorf("bad frames:\n%+v\nexpected:\n%+v", e.Frames, want)
+	}
+	if !strings.Contains(e.Error(), "(7 frames elided by tail calls)") {
+		t.Errorf("bad error string:\n%s", e.Error())
+	}
+	err = ctx.Compile("f.goal", "f:{?[x>5;1+`a`;1*f x+1]}\ng:{f x}\ng 0")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	_, err = ctx.Run()
+	e = err.(*PanicError)
+	want = []Frame{
+		{Filename: "f.goal", Line: 1, Column: 11, Lambda: "f", Excerpt: "f:{?[x>5;1+`a`;1*f x+1]}"},
+		{Filename: "f.goal", Line: 1, Column: 18, Lambda: "f", Excerpt: "f:{?[x>5;1+`a`;1*f x+1]}", Repeat: 4, Cycle: 1},
+		{Filename: "f.goal", Line: 1, Column: 18, Lambda: "f", Excerpt: "f:{?[x>5;1+`a`;1*f x+1]}", Tails: 1},
+		{Filename: "f.goal", Line: 3, Column: 1, Excerpt: "g 0"},
+	}
+	if fmt.Sprint(e.Frames) != fmt.Sprint(want) {
+		t.Errorf("bad frames:\n%+v\nexpected:\n%+v", e.Frames, want)
+	}
+	if s := e.Error(); !strings.Contains(s, "(1 frame elided by tail calls)") || !strings.Contains(s, "(repeated 4 more times)") {
+		t.Errorf("bad error string:\n%s", s)
+	}
+	// mutual recursion is collapsed too
+	_, err = ctx.Eval("h:{?[x>5;1+`a`;1*k x+1]};k:{1*h x};k 0")
+	e = err.(*PanicError)
+	if len(e.Frames) != 5 || e.Frames[2].Repeat != 5 || e.Frames[2].Cycle != 2 {
+		t.Errorf("bad mutual recursion frames: %+v", e.Frames)
+	}
+	if !strings.Contains(e.Error(), "(last 2 frames repeated 5 more times)") {
+		t.Errorf("bad error string:\n%s", e.Error())
+	}
+	ctx.MaxFrames = 3
+	_, err = ctx.Eval("h:{?[x>5;1+`a`;1*k x+1]};k:{1*h x};k 0")
+	e = err.(*PanicError)
+	if len(e.Frames) != 3 || e.Elided != 12 || e.Frames[1].Elided != 12 || e.Frames[2].Column != 36 {
+		t.Errorf("bad capped frames (%d elided): %+v", e.Elided, e.Frames)
+	}
+	if lines := strings.Split(e.Error(), "\n"); len(lines) < 6 || lines[5] != "  (12 more frames)" {
+		t.Errorf("bad capped error string:\n%s", e.Error())
+	}
+}
+
+type testHook struct {
+	stops []string
+}
+
+func (h *testHook) Statement(ctx *Context, loc Location) error {
+	locals := ctx.Locals()
+	names := make([]string, 0, len(locals))
+	for name, x := range locals {
+		names = append(names, name+"="+x.Sprint(ctx))
+	}
+	sort.Strings(names)
+	h.stops = append(h.stops, fmt.Sprintf("%d:%d:%s", loc.Line, loc.Depth, strings.Join(names, ",")))
+	if loc.Line == 5 {
+		return errors.New("stop")
+	}
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	ctx := NewContext()
+	h := &testHook{}
+	ctx.SetHook(h)
+	err := ctx.Compile("h.goal", "a:1\nf:{b:x+1\nb*2}\nc:f a\nc+1\nc+2")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	_, err = ctx.Run()
+	if err == nil || err.(*PanicError).Msg != "stop" {
+		t.Errorf("bad error: %v", err)
+	}
+	want := "1:0: 2:0: 4:0: 2:1:x=1 3:1:b=2,x=1 5:0:"
+	if got := strings.Join(h.stops, " "); got != want {
+		t.Errorf("bad stops:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestNewContextWith(t *testing.T) {
+	ctx := NewContextWith(ContextOptions{Deny: []string{"eval", "rt.seed"}})
+	for _, s := range []string{`eval "1"`, `."eval 1"`, `rt.seed 1`} {
+		if _, err := ctx.Eval(s); err == nil || !strings.Contains(err.Error(), "undefined global") {
+			t.Errorf("%s: bad error: %v", s, err)
+		}
+	}
+	if r, err := ctx.Eval(`abs -1`); err != nil || !r.Matches(NewI(1)) {
+		t.Errorf("abs -1: got %v (%v)", r, err)
+	}
+	ctx = NewContextWith(ContextOptions{Allow: []string{}})
+	if len(ctx.Keywords()) != 0 {
+		t.Errorf("bad keywords: %v", ctx.Keywords())
+	}
+	if r, err := ctx.Eval(`+/!5`); err != nil || !r.Matches(NewI(10)) {
+		t.Errorf("+/!5: got %v (%v)", r, err)
+	}
+	if _, err := ctx.Eval(`»1 2`); err == nil || !strings.Contains(err.Error(), "rshift : keyword not available") {
+		t.Errorf("»1 2: bad error: %v", err)
+	}
+	ctx = NewContextWith(ContextOptions{Allow: []string{"abs", "sign"}})
+	if got := strings.Join(ctx.Keywords(), " "); got != "abs sign" {
+		t.Errorf("bad keywords: %s", got)
+	}
+	ctx.Override("abs", func(ctx *Context, args []V) V { return NewI(42) })
+	for _, s := range []string{`abs -1`, `."abs -1"`} {
+		if r, err := ctx.Eval(s); err != nil || !r.Matches(NewI(42)) {
+			t.Errorf("%s: got %v (%v)", s, r, err)
+		}
+	}
+	if ctx.Unregister("eval") || !ctx.Unregister("sign") {
+		t.Errorf("bad Unregister result")
+	}
+	if _, err := ctx.Eval(`."sign -1"`); err == nil {
+		t.Errorf("sign available in reval")
+	}
+	ctx.RegisterDyad("sign", func(ctx *Context, args []V) V { return NewS("dyad") })
+	if r, err := ctx.Eval(`1 sign 2`); err != nil || !r.Matches(NewS("dyad")) {
+		t.Errorf("sign: got %v (%v)", r, err)
+	}
+}
+
+func TestClock(t *testing.T) {
+	ctx := NewContext()
+	c := NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	ctx.Clock = c
+	tests := []struct{ s, want string }{
+		{`time "unix"`, "1685620800"},
+		{`time "date"`, "2023 6 1"},
+		{`."time \"hour\""`, "12"},
+	}
+	for _, test := range tests {
+		r, err := ctx.Eval(test.s)
+		if err != nil {
+			t.Fatalf("%s: %v", test.s, err)
+		}
+		if got := r.Sprint(ctx); got != test.want {
+			t.Errorf("%s: got %s, expected %s", test.s, got, test.want)
+		}
+	}
+	c.Advance(time.Hour)
+	if r, _ := ctx.Eval(`time "hour"`); !r.Matches(NewI(13)) {
+		t.Errorf("bad hour after Advance: %s", r.Sprint(ctx))
+	}
+	// rt.time measures real durations
+	if r, err := ctx.Eval(`rt.time["+/!100000";10]`); err != nil || !r.IsI() || r.I() <= 0 {
+		t.Errorf("bad rt.time result with fake clock: %v (%v)", r, err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	ctx := NewContext()
+	err := ctx.Compile("p.goal", "sq:{x*x}\nf:{+/sq'!x}\nf 10000\nf 20000")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	ctx.StartProfile(time.Microsecond)
+	_, err = ctx.Run()
+	prof := ctx.StopProfile()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	d := prof.value().bv.(*D)
+	fns := d.values.VAt(0).bv.(*AS).elts
+	found := false
+	for _, fn := range fns {
+		if fn == "sq" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no samples for sq: %v", fns)
+	}
+	var buf bytes.Buffer
+	if err := prof.WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	bs, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	for _, s := range []string{"sq", "p.goal", "nanoseconds", "alloc_space"} {
+		if !bytes.Contains(bs, []byte(s)) {
+			t.Errorf("pprof output does not contain %q", s)
+		}
+	}
+	if ctx.StopProfile() != nil {
+		t.Errorf("profile not stopped")
+	}
+}
+
+func TestParse(t *testing.T) {
+	src := "#!/usr/bin/env goal\n/ comment\na:1 2 3 / trailing\n/\nblock\n\\\n" +
+		"f:{[x;y] x+y}; (b;c):(\"a$a\";rx/x/)\nd[1]+:3\n+/!10\n:f'qq/$x/"
+	f, err := Parse("test.goal", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stmts []string
+	for _, es := range f.Body {
+		stmts = append(stmts, src[es.Pos():es.End()])
+	}
+	if got, want := strings.Join(stmts, "|"), `a:1 2 3|f:{[x;y] x+y}|(b;c):("a$a";rx/x/)|d[1]+:3|+/!10|:f'qq/$x/`; got != want {
+		t.Errorf("statements: got %q, expected %q", got, want)
+	}
+	var comments []string
+	for _, c := range f.Comments {
+		comments = append(comments, src[c.Pos():c.End()])
+	}
+	if got, want := strings.Join(comments, "|"), "#!/usr/bin/env goal|/ comment|/ trailing|/\nblock\n\\"; got != want {
+		t.Errorf("comments: got %q, expected %q", got, want)
+	}
+	var nodes []string
+	Inspect(f.Body[1], func(n Node) bool {
+		if n != nil {
+			nodes = append(nodes, fmt.Sprintf("%T", n))
+		}
+		return true
+	})
+	if got, want := strings.Join(nodes, " "), "*goal.Exprs *goal.AssignExpr *goal.Exprs *goal.LambdaExpr "+
+		"*goal.Exprs *goal.BinaryExpr *goal.Ident *goal.Verb *goal.Exprs *goal.Ident"; got != want {
+		t.Errorf("nodes: got %q, expected %q", got, want)
+	}
+	lambda := f.Body[1].List[0].(*AssignExpr).Right.List[0].(*LambdaExpr)
+	if strings.Join(lambda.Params, ";") != "x;y" {
+		t.Errorf("bad lambda params: %v", lambda.Params)
+	}
+	la := f.Body[2].List[0].(*ListAssignExpr)
+	if src[la.Lparen:la.Rparen+1] != "(b;c)" {
+		t.Errorf("bad list assignment positions: %d %d", la.Lparen, la.Rparen)
+	}
+	_, err = Parse("test.goal", "a:1\nf:{x+")
+	var perr *PanicError
+	if !errors.As(err, &perr) || len(perr.Frames) == 0 || perr.Frames[0].Line != 2 {
+		t.Errorf("bad parse error: %v", err)
+	}
+}
+
+func TestLint(t *testing.T) {
+	ctx := NewContext()
+	ctx.AssignGlobal("ARGS", NewAS(nil))
+	src := "#!/usr/bin/env goal\nf:{x+y}; f[1;2;3]; ARGS; p.g 1; u+1\n" +
+		"g:{[a;f] b:1; c:2; :a+c; c}\nh:{n:1;{n}0}\n{x}[1;2]\nn:3\n(d;e):1 2; {(c;d):x;c}\n:n\n\n2"
+	issues, err := ctx.Lint("t.goal", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, li := range issues {
+		got = append(got, li.String())
+	}
+	want := []string{
+		"t.goal:2:10: too many arguments in call to f: got 3, expected 2",
+		"t.goal:2:33: global u read but never assigned",
+		"t.goal:3:3: local f shadows global",
+		"t.goal:3:10: local b assigned but never used",
+		"t.goal:3:26: unreachable code",
+		"t.goal:4:4: local n shadows global",
+		"t.goal:5:1: too many arguments in call to lambda: got 2, expected 1",
+		"t.goal:7:13: local d assigned but never used",
+		"t.goal:7:13: local d shadows global",
+		"t.goal:10:1: unreachable code",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := ctx.GlobalNames(); len(got) != 1 {
+		t.Errorf("Lint modified globals: %v", got)
+	}
+	if _, err := ctx.Lint("", "(1"); err == nil {
+		t.Error("expected compilation error")
+	}
+	issues, err = ctx.Lint("", "a:1;b:{[x;y] c:x+y; c*a}; b[1;2]")
+	if err != nil || len(issues) != 0 {
+		t.Errorf("unexpected issues: %v (%v)", issues, err)
+	}
+	issues, err = ctx.Lint("", "{a:1;b:2;{b:3;a+b+x}b}")
+	if err != nil || len(issues) != 1 || issues[0].String() != ":1:11: local b shadows local of enclosing lambda" {
+		t.Errorf("bad closure issues: %v (%v)", issues, err)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	ctx := NewContext()
+	p, err := ctx.CompileProgram("p.goal", "n+:1;{x*2}n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.AssignGlobal("n", NewI(0))
+	for i := 1; i <= 3; i++ {
+		r, err := ctx.RunProgram(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Sprint(ctx); got != fmt.Sprint(2*i) {
+			t.Errorf("run %d: got %s", i, got)
+		}
+	}
+	if r, err := ctx.Eval("n"); err != nil || r.Sprint(ctx) != "3" {
+		t.Errorf("bad n: %v (%v)", r, err)
+	}
+	p, err = ctx.CompileProgram("p.goal", "1+\"a\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.RunProgram(p); err == nil || !strings.Contains(err.Error(), "p.goal:1:2") {
+		t.Errorf("expected error with location: %v", err)
+	}
+	if _, err := ctx.CompileProgram("", "(1"); err == nil {
+		t.Error("expected compilation error")
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	ctx := NewContext()
+	ctx.AssignGlobal("a", NewI(1))
+	got, err := ctx.Disassemble("b:a+{x*2}3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"opGlobal\t0 (a)", "opAssignGlobal\t1 (b)", "---- Lambda 0 (Rank: 1) -----", "opLocalLast\t0 (x)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if got := ctx.GlobalNames(); len(got) != 1 {
+		t.Errorf("Disassemble modified globals: %v", got)
+	}
+	got, err = ctx.Disassemble("{?[x;a x;1+a[x;2]]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"opTailApplyGlobal\t0 (a)", "opApplyNGlobal\t0 (a)\t2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if _, err := ctx.Disassemble("(1"); err == nil {
+		t.Error("expected compilation error")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"x: 1+2 ;y: 3 4", "x:1+2;y:3 4\n"},
+		{"a - 1;  a -1;1 - -2;a- 1;1 2 . ()", "a-1; a -1;1--2;a-1;1 2 .()\n"},
+		{"f:{[x;y]\n      x+y   / sum  \n     }\r\n\n\n\ng 2", "f:{[x;y]\n  x+y   / sum\n}\n\ng 2\n"},
+		{"#!/usr/bin/env goal\n/\n  block\n\\\nrx/a b/ qq|$x| rq#c# \"d\"", "#!/usr/bin/env goal\n/\n  block\n\\\nrx/a b/ qq|$x| rq#c# \"d\"\n"},
+		{"d:(\"a\"\n   ( 1\n3))\n+/ 'x", "d:(\"a\"\n  (1\n    3))\n+/ 'x\n"},
+	}
+	for _, test := range tests {
+		got, err := Format("", test.src)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, expected %q", test.src, got, test.want)
+		}
+	}
+	if _, err := Format("", "(1;2"); err == nil {
+		t.Error("expected syntax error")
+	}
+	mts, err := getMatchTests("*.goal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smts, err := getScriptMatchTests("*.goal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mt := range append(mts, smts...) {
+		if _, err := Parse("", mt.Left); err != nil {
+			continue
+		}
+		got, err := Format("", mt.Left)
+		if err != nil {
+			t.Errorf("%s:%d: %v", mt.Fname, mt.Line, err)
+			continue
+		}
+		if again, err := Format("", got); err != nil || again != got {
+			t.Errorf("%s:%d: not idempotent: %q -> %q (%v)", mt.Fname, mt.Line, got, again, err)
+		}
+	}
+}
+
 func BenchmarkFoldMinus(b *testing.B) {
 	ctx := NewContext()
 	ctx.Eval("a:!1000")
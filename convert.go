@@ -0,0 +1,563 @@
+package goal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvError represents an error during a conversion between Go and goal
+// values with FromGo or ToGo.
+type ConvError struct {
+	Path string // path to the failing value, like .Items[2]["key"]
+	Msg  string // error message
+
+	badType bool // value of unexpected type
+}
+
+func (e *ConvError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+func convErrorf(format string, a ...interface{}) error {
+	return &ConvError{Msg: fmt.Sprintf(format, a...)}
+}
+
+// convErrorAt prefixes the path of a conversion error with the given element.
+func convErrorAt(err error, elt string) error {
+	if e, ok := err.(*ConvError); ok {
+		e.Path = elt + e.Path
+	}
+	return err
+}
+
+var (
+	typeV    = reflect.TypeOf(V{})
+	typeTime = reflect.TypeOf(time.Time{})
+)
+
+// FromGo returns a goal value representing the given Go value. Supported
+// values are:
+//
+//   - V and BV values, returned as-is.
+//   - Booleans and integers, as integers, and floating point numbers.
+//   - Strings, and byte slices as strings.
+//   - time.Time values, as integers representing Unix time in nanoseconds.
+//   - Slices and arrays, as AB, AI, AF or AS arrays when possible, and generic
+//     arrays otherwise.
+//   - Maps with string or integer keys, as dicts with sorted keys.
+//   - Structs, as dicts with exported field names as keys. A goal:"name"
+//     struct tag may be used to rename a field, and goal:"-" to skip it.
+//   - Pointers and interfaces, by converting the value they refer to.
+//
+// It returns a *ConvError for unsupported or cyclic values.
+func FromGo(x interface{}) (V, error) {
+	switch xv := x.(type) {
+	case V:
+		return xv, nil
+	case BV:
+		return NewV(xv), nil
+	case nil:
+		return V{}, convErrorf("FromGo: nil value")
+	}
+	r, err := fromGo(reflect.ValueOf(x), map[visit]bool{})
+	if err != nil {
+		return V{}, err
+	}
+	return r, nil
+}
+
+// visit identifies a pointer, map or slice being converted by FromGo, for
+// detecting cycles.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func fromGo(x reflect.Value, visiting map[visit]bool) (V, error) {
+	switch x.Kind() {
+	case reflect.Bool:
+		return NewI(b2I(x.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewI(x.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := x.Uint()
+		if u > math.MaxInt64 {
+			return V{}, convErrorf("FromGo: integer overflow (%d)", u)
+		}
+		return NewI(int64(u)), nil
+	case reflect.Float32, reflect.Float64:
+		return NewF(x.Float()), nil
+	case reflect.String:
+		return NewS(x.String()), nil
+	case reflect.Slice:
+		if x.Type().Elem().Kind() == reflect.Uint8 {
+			return NewS(string(x.Bytes())), nil
+		}
+		return fromGoRef(x, visiting)
+	case reflect.Array:
+		return fromGoArray(x, visiting)
+	case reflect.Map:
+		return fromGoRef(x, visiting)
+	case reflect.Struct:
+		if x.Type() == typeV {
+			return x.Interface().(V), nil
+		}
+		if x.Type() == typeTime {
+			return NewI(x.Interface().(time.Time).UnixNano()), nil
+		}
+		return fromGoStruct(x, visiting)
+	case reflect.Pointer, reflect.Interface:
+		if x.IsNil() {
+			return V{}, convErrorf("FromGo: nil %s", x.Type())
+		}
+		if bv, ok := x.Interface().(BV); ok {
+			return NewV(bv), nil
+		}
+		if x.Kind() == reflect.Pointer {
+			return fromGoRef(x, visiting)
+		}
+		return fromGo(x.Elem(), visiting)
+	default:
+		return V{}, convErrorf("FromGo: unsupported type %s", x.Type())
+	}
+}
+
+// fromGoRef converts a pointer, map or slice, returning an error if it
+// refers to a value that is already being converted.
+func fromGoRef(x reflect.Value, visiting map[visit]bool) (V, error) {
+	k := visit{ptr: x.Pointer(), typ: x.Type()}
+	if k.ptr != 0 {
+		if visiting[k] {
+			return V{}, convErrorf("FromGo: cyclic value of type %s", x.Type())
+		}
+		visiting[k] = true
+		defer delete(visiting, k)
+	}
+	switch x.Kind() {
+	case reflect.Pointer:
+		return fromGo(x.Elem(), visiting)
+	case reflect.Map:
+		return fromGoMap(x, visiting)
+	default:
+		return fromGoArray(x, visiting)
+	}
+}
+
+func fromGoArray(x reflect.Value, visiting map[visit]bool) (V, error) {
+	n := x.Len()
+	switch x.Type().Elem().Kind() {
+	case reflect.Bool:
+		r := make([]byte, n)
+		for i := range r {
+			r[i] = byte(b2I(x.Index(i).Bool()))
+		}
+		return newABb(r), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r := make([]int64, n)
+		for i := range r {
+			r[i] = x.Index(i).Int()
+		}
+		return NewAI(r), nil
+	case reflect.Uint8:
+		r := make([]byte, n)
+		for i := range r {
+			r[i] = byte(x.Index(i).Uint())
+		}
+		return NewAB(r), nil
+	case reflect.Float32, reflect.Float64:
+		r := make([]float64, n)
+		for i := range r {
+			r[i] = x.Index(i).Float()
+		}
+		return NewAF(r), nil
+	case reflect.String:
+		r := make([]string, n)
+		for i := range r {
+			r[i] = x.Index(i).String()
+		}
+		return NewAS(r), nil
+	default:
+		r := make([]V, n)
+		for i := range r {
+			ri, err := fromGo(x.Index(i), visiting)
+			if err != nil {
+				return V{}, convErrorAt(err, "["+strconv.Itoa(i)+"]")
+			}
+			ri.MarkImmutable()
+			r[i] = ri
+		}
+		return NewAV(r), nil
+	}
+}
+
+func fromGoMap(x reflect.Value, visiting map[visit]bool) (V, error) {
+	keys := x.MapKeys()
+	switch x.Type().Key().Kind() {
+	case reflect.String:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Uint() < keys[j].Uint() })
+	default:
+		return V{}, convErrorf("FromGo: unsupported map key type %s", x.Type().Key())
+	}
+	ks := make([]V, len(keys))
+	vs := make([]V, len(keys))
+	for i, k := range keys {
+		ki, err := fromGo(k, visiting)
+		if err != nil {
+			return V{}, err
+		}
+		vi, err := fromGo(x.MapIndex(k), visiting)
+		if err != nil {
+			return V{}, convErrorAt(err, "["+fmt.Sprintf("%#v", k.Interface())+"]")
+		}
+		vi.MarkImmutable()
+		ks[i] = ki
+		vs[i] = vi
+	}
+	return NewD(NewAV(ks), NewAV(vs)), nil
+}
+
+func fromGoStruct(x reflect.Value, visiting map[visit]bool) (V, error) {
+	t := x.Type()
+	ks := []string{}
+	vs := []V{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		vi, err := fromGo(x.Field(i), visiting)
+		if err != nil {
+			return V{}, convErrorAt(err, "."+f.Name)
+		}
+		vi.MarkImmutable()
+		ks = append(ks, name)
+		vs = append(vs, vi)
+	}
+	return NewD(NewAS(ks), NewAV(vs)), nil
+}
+
+// fieldName returns the dict key used for a struct field, and false if the
+// field should be skipped.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		// unexported field
+		return "", false
+	}
+	tag := f.Tag.Get("goal")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+// ToGo stores the result of converting x into the Go value pointed to by ptr.
+// It follows the rules of FromGo in reverse, converting numbers and strings as
+// needed, and leaving fields of structs without corresponding dict key
+// unchanged. Integers (Unix time in nanoseconds) and strings (in RFC3339
+// format) can be stored into time.Time values. Values stored into interfaces of type any use the
+// natural Go representation: int64, float64, string, slices of those, []any,
+// and map[string]any or map[any]any for dicts.
+//
+// It returns a *ConvError if x cannot be stored into ptr.
+func (x V) ToGo(ctx *Context, ptr interface{}) error {
+	p := reflect.ValueOf(ptr)
+	if p.Kind() != reflect.Pointer || p.IsNil() {
+		return convErrorf("ToGo: non-pointer or nil destination (%T)", ptr)
+	}
+	err := toGo(ctx, x, p.Elem())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func toGo(ctx *Context, x V, dst reflect.Value) error {
+	t := dst.Type()
+	switch t {
+	case typeV:
+		dst.Set(reflect.ValueOf(x))
+		return nil
+	case typeTime:
+		return toGoTime(x, dst)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		switch {
+		case x.IsI():
+			dst.SetBool(x.I() != 0)
+		case x.IsF():
+			dst.SetBool(x.F() != 0)
+		default:
+			return toGoTypeError(x, t)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toGoInt(x, t)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(i) {
+			return convErrorf("ToGo: integer overflow for %s (%d)", t, i)
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := toGoInt(x, t)
+		if err != nil {
+			return err
+		}
+		if i < 0 || dst.OverflowUint(uint64(i)) {
+			return convErrorf("ToGo: integer overflow for %s (%d)", t, i)
+		}
+		dst.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case x.IsI():
+			dst.SetFloat(float64(x.I()))
+		case x.IsF():
+			dst.SetFloat(x.F())
+		default:
+			return toGoTypeError(x, t)
+		}
+	case reflect.String:
+		s, ok := x.bv.(S)
+		if !ok {
+			return toGoTypeError(x, t)
+		}
+		dst.SetString(string(s))
+	case reflect.Slice:
+		if s, ok := x.bv.(S); ok && t.Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes([]byte(s))
+			return nil
+		}
+		xa, ok := x.bv.(Array)
+		if !ok {
+			return toGoTypeError(x, t)
+		}
+		r := reflect.MakeSlice(t, xa.Len(), xa.Len())
+		for i := 0; i < xa.Len(); i++ {
+			err := toGo(ctx, xa.VAt(i), r.Index(i))
+			if err != nil {
+				return convErrorAt(err, "["+strconv.Itoa(i)+"]")
+			}
+		}
+		dst.Set(r)
+	case reflect.Array:
+		xa, ok := x.bv.(Array)
+		if !ok {
+			return toGoTypeError(x, t)
+		}
+		if xa.Len() != t.Len() {
+			return convErrorf("ToGo: length mismatch for %s (%d)", t, xa.Len())
+		}
+		for i := 0; i < xa.Len(); i++ {
+			err := toGo(ctx, xa.VAt(i), dst.Index(i))
+			if err != nil {
+				return convErrorAt(err, "["+strconv.Itoa(i)+"]")
+			}
+		}
+	case reflect.Map:
+		d, ok := x.bv.(*D)
+		if !ok {
+			return toGoTypeError(x, t)
+		}
+		r := reflect.MakeMapWithSize(t, d.Len())
+		for i := 0; i < d.Len(); i++ {
+			ki := reflect.New(t.Key()).Elem()
+			err := toGo(ctx, d.keys.VAt(i), ki)
+			if err != nil {
+				return convErrorAt(err, "[key "+strconv.Itoa(i)+"]")
+			}
+			vi := reflect.New(t.Elem()).Elem()
+			err = toGo(ctx, d.values.VAt(i), vi)
+			if err != nil {
+				return convErrorAt(err, "["+d.keys.VAt(i).Sprint(ctx)+"]")
+			}
+			r.SetMapIndex(ki, vi)
+		}
+		dst.Set(r)
+	case reflect.Struct:
+		d, ok := x.bv.(*D)
+		if !ok {
+			return toGoTypeError(x, t)
+		}
+		keys, ok := d.keys.(*AS)
+		if !ok {
+			return convErrorf("ToGo: non-string keys for %s (%s)", t, d.keys.Type())
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			k := -1
+			for j, kj := range keys.elts {
+				if kj == name {
+					k = j
+					break
+				}
+			}
+			if k < 0 {
+				continue
+			}
+			err := toGo(ctx, d.values.VAt(k), dst.Field(i))
+			if err != nil {
+				return convErrorAt(err, "."+f.Name)
+			}
+		}
+	case reflect.Pointer:
+		r := reflect.New(t.Elem())
+		err := toGo(ctx, x, r.Elem())
+		if err != nil {
+			return err
+		}
+		dst.Set(r)
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return toGoTypeError(x, t)
+		}
+		r, err := toGoAny(ctx, x)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		dst.Set(reflect.ValueOf(r))
+	default:
+		return toGoTypeError(x, t)
+	}
+	return nil
+}
+
+func toGoTypeError(x V, t reflect.Type) error {
+	return &ConvError{badType: true, Msg: fmt.Sprintf("ToGo: cannot store value of type \"%s\" into %s", x.Type(), t)}
+}
+
+func toGoInt(x V, t reflect.Type) (int64, error) {
+	switch {
+	case x.IsI():
+		return x.I(), nil
+	case x.IsF():
+		if !isI(x.F()) {
+			return 0, convErrorf("ToGo: non-integer value for %s (%g)", t, x.F())
+		}
+		return int64(x.F()), nil
+	default:
+		return 0, toGoTypeError(x, t)
+	}
+}
+
+func toGoTime(x V, dst reflect.Value) error {
+	switch {
+	case x.IsI():
+		dst.Set(reflect.ValueOf(time.Unix(0, x.I())))
+		return nil
+	case x.IsF():
+		if !isI(x.F()) {
+			return convErrorf("ToGo: non-integer value for time.Time (%g)", x.F())
+		}
+		dst.Set(reflect.ValueOf(time.Unix(0, int64(x.F()))))
+		return nil
+	}
+	s, ok := x.bv.(S)
+	if !ok {
+		return toGoTypeError(x, typeTime)
+	}
+	t, err := time.Parse(time.RFC3339, string(s))
+	if err != nil {
+		return convErrorf("ToGo: %v", err)
+	}
+	dst.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// toGoAny returns the natural Go representation of x.
+func toGoAny(ctx *Context, x V) (interface{}, error) {
+	switch x.kind {
+	case valNil:
+		return nil, nil
+	case valInt:
+		return x.I(), nil
+	case valFloat:
+		return x.F(), nil
+	}
+	switch xv := x.bv.(type) {
+	case S:
+		return string(xv), nil
+	case *AB:
+		r := make([]int64, xv.Len())
+		for i, xi := range xv.elts {
+			r[i] = int64(xi)
+		}
+		return r, nil
+	case *AI:
+		r := make([]int64, xv.Len())
+		copy(r, xv.elts)
+		return r, nil
+	case *AF:
+		r := make([]float64, xv.Len())
+		copy(r, xv.elts)
+		return r, nil
+	case *AS:
+		r := make([]string, xv.Len())
+		copy(r, xv.elts)
+		return r, nil
+	case *AV:
+		r := make([]interface{}, xv.Len())
+		for i, xi := range xv.elts {
+			ri, err := toGoAny(ctx, xi)
+			if err != nil {
+				return nil, convErrorAt(err, "["+strconv.Itoa(i)+"]")
+			}
+			r[i] = ri
+		}
+		return r, nil
+	case *D:
+		if keys, ok := xv.keys.(*AS); ok {
+			r := make(map[string]interface{}, xv.Len())
+			for i, k := range keys.elts {
+				vi, err := toGoAny(ctx, xv.values.VAt(i))
+				if err != nil {
+					return nil, convErrorAt(err, "["+strconv.Quote(k)+"]")
+				}
+				r[k] = vi
+			}
+			return r, nil
+		}
+		r := make(map[interface{}]interface{}, xv.Len())
+		for i := 0; i < xv.Len(); i++ {
+			ki, err := toGoAny(ctx, xv.keys.VAt(i))
+			if err != nil {
+				return nil, convErrorAt(err, "[key "+strconv.Itoa(i)+"]")
+			}
+			if ki != nil && !reflect.TypeOf(ki).Comparable() {
+				return nil, convErrorf("ToGo: non-comparable key type \"%s\"", xv.keys.VAt(i).Type())
+			}
+			vi, err := toGoAny(ctx, xv.values.VAt(i))
+			if err != nil {
+				return nil, convErrorAt(err, "["+xv.keys.VAt(i).Sprint(ctx)+"]")
+			}
+			r[ki] = vi
+		}
+		return r, nil
+	default:
+		return nil, convErrorf("ToGo: unsupported value of type \"%s\"", x.Type())
+	}
+}
@@ -57,6 +57,9 @@ func fCSV(ctx *Context, comma rune, x V) V {
 				}
 				return Errorf("%v", err)
 			}
+			if err := ctx.allocN(int64(len(record))); err != nil {
+				return Panicf("csv x : %v", err)
+			}
 			r = append(r, NewV(&AS{elts: record, flags: flagImmutable}))
 		}
 	case *AS:
@@ -0,0 +1,157 @@
+package goal
+
+import (
+	"sort"
+	"strings"
+)
+
+// Hook is the interface implemented by execution hooks set with SetHook, like
+// step debuggers.
+type Hook interface {
+	// Statement is called before executing each statement of global code
+	// or lambdas. Execution stops with the returned error if non-nil.
+	// The context can be inspected with methods like Locals, Stack and
+	// GetGlobal, but it must not be used to compile or run code.
+	Statement(ctx *Context, loc Location) error
+}
+
+// Location represents the source location of a statement about to be
+// executed.
+type Location struct {
+	Filename string // file name (empty for code without location)
+	Line     int    // line number (starting from 1)
+	Column   int    // column number (starting from 1)
+	Excerpt  string // source line containing the statement
+	Depth    int    // lambda call depth (zero in global code)
+}
+
+// debugState represents the state of a context with a hook.
+type debugState struct {
+	hook  Hook
+	lines map[string][]int // filename: line start offsets
+}
+
+// SetHook sets an execution hook, or removes it if h is nil. Execution is
+// slower while a hook is set.
+func (ctx *Context) SetHook(h Hook) {
+	if h == nil {
+		ctx.dbg = nil
+		return
+	}
+	ctx.dbg = &debugState{hook: h, lines: map[string][]int{}}
+}
+
+// Locals returns the non-nil arguments and local variables of the currently
+// executing lambda, or nil in global code. It is intended to be used by hooks.
+func (ctx *Context) Locals() map[string]V {
+	if ctx.callDepth == 0 {
+		return nil
+	}
+	lc := ctx.lambdas[ctx.lambda]
+	r := make(map[string]V, len(lc.Names))
+	for i, name := range lc.Names {
+		idx := int(ctx.frameIdx) - i
+		if idx < 0 || idx >= len(ctx.stack) {
+			continue
+		}
+		if x := ctx.stack[idx]; x.kind != valNil {
+			r[name] = x
+		}
+	}
+	return r
+}
+
+// Stack returns a copy of the current execution stack, with the top value
+// last. It is intended to be used by hooks.
+func (ctx *Context) Stack() []V {
+	r := make([]V, len(ctx.stack))
+	copy(r, ctx.stack)
+	return r
+}
+
+// GlobalNames returns the sorted names of the defined global variables that
+// are accessible by name. Package-private globals are not included.
+func (ctx *Context) GlobalNames() []string {
+	var r []string
+	for id, name := range ctx.gNames {
+		if ctx.globals[id].kind != valNil && ctx.visibleGlobal(id) {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// statement calls the hook for the statement starting at ip in ops.
+func (ctx *Context) statement(ops []opcode, ip int) error {
+	var pos []int
+	var fname, src string
+	base := 0
+	if ctx.callDepth > 0 {
+		lc := ctx.lambdas[ctx.lambda]
+		pos = lc.Pos
+		fname = lc.Filename
+		if fname == "" {
+			src = lc.Source
+			base = lc.StartPos
+		}
+	} else {
+		pos = ctx.gCode.Pos
+		fname = ctx.fname
+	}
+	if len(pos) != len(ops) {
+		// should not happen
+		return nil
+	}
+	// Code is evaluated from right to left, so we use the smallest
+	// position within the statement.
+	p := pos[ip]
+	for i := ip; i < len(ops) && ops[i] != opDrop; i += 1 + ops[i].argc() {
+		if pos[i] < p {
+			p = pos[i]
+		}
+		if ops[i] == opLambda || ops[i] == opClosure {
+			// lambda positions are at the closing brace
+			if lc := ctx.lambdas[ops[i+1]]; lc.StartPos < p && lc.Filename == fname {
+				p = lc.StartPos
+			}
+		}
+	}
+	loc := Location{Filename: fname, Depth: int(ctx.callDepth)}
+	var col int
+	switch {
+	case ctx.callDepth > 0 && fname == "":
+		loc.Excerpt, loc.Line, col = getPosLine(src, p-base)
+	case fname == "":
+		loc.Excerpt, loc.Line, col = getPosLine(ctx.sources[""], p)
+	default:
+		loc.Excerpt, loc.Line, col = ctx.dbg.posLine(fname, ctx.sources[fname], p)
+	}
+	loc.Column = col + 1
+	return ctx.dbg.hook.Statement(ctx, loc)
+}
+
+// posLine is like getPosLine, but uses cached line offsets for the given
+// file.
+func (dbg *debugState) posLine(fname, s string, pos int) (string, int, int) {
+	lines, ok := dbg.lines[fname]
+	if !ok {
+		lines = []int{0}
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\n' {
+				lines = append(lines, i+1)
+			}
+		}
+		dbg.lines[fname] = lines
+	}
+	if pos > len(s) {
+		return "", 0, 0
+	}
+	i := sort.Search(len(lines), func(i int) bool { return lines[i] > pos }) - 1
+	start := lines[i]
+	end := strings.IndexByte(s[start:], '\n')
+	if end < 0 {
+		return s[start:], i + 1, pos - start
+	}
+	return s[start : start+end], i + 1, pos - start
+}
@@ -64,15 +64,15 @@ func (d *D) Len() int {
 	return d.keys.Len()
 }
 
-func dict(x, y V) V {
+func dict(ctx *Context, x, y V) V {
 	if x.IsI() {
-		return moddivpad(x.I(), y)
+		return moddivpad(ctx, x.I(), y)
 	}
 	if x.IsF() {
 		if !isI(x.F()) {
 			return Panicf("i!y : non-integer i (%g)", x.F())
 		}
-		return moddivpad(int64(x.F()), y)
+		return moddivpad(ctx, int64(x.F()), y)
 	}
 	xv, ok := x.bv.(Array)
 	if !ok {
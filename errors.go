@@ -8,11 +8,27 @@ import (
 
 // PanicError represents a fatal error returned by any Context method.
 type PanicError struct {
-	Msg string // error message (without location)
+	Msg    string  // error message (without location)
+	Frames []Frame // stack trace, from innermost to outermost location
+	Elided int     // number of frames omitted because of Context.MaxFrames
 
 	compile   bool
 	positions []position        // error location stack
 	sources   map[string]string // filename: source
+	cause     error             // underlying Go error (if any)
+}
+
+// Frame represents a location in the stack trace of a PanicError.
+type Frame struct {
+	Filename string // file name (empty for code without location)
+	Line     int    // line number (starting from 1)
+	Column   int    // column number (starting from 1)
+	Lambda   string // name of the global the lambda is assigned to (if any)
+	Excerpt  string // source line containing the location
+	Repeat   int    // number of collapsed repetitions of the last Cycle frames
+	Cycle    int    // number of frames in a repeated cycle ending here (if Repeat > 0)
+	Tails    int    // number of calling frames elided because of tail calls
+	Elided   int    // number of frames omitted after this one because of Context.MaxFrames
 }
 
 // position represents a source location, usually where an error occured.
@@ -20,6 +36,10 @@ type position struct {
 	Filename string // file name (as obtained from SetSource)
 	Pos      int    // byte offset
 	lambda   *lambdaCode
+	repeat   int // number of collapsed repetitions of the last cycle positions
+	cycle    int // number of positions in the repeated cycle (if repeat > 0)
+	tails    int // number of positions elided by tail calls
+	elided   int // number of positions omitted after this one because of MaxFrames
 }
 
 // Error returns the default string representation. It makes uses of position
@@ -28,24 +48,19 @@ func (e *PanicError) Error() string {
 	if len(e.positions) == 0 {
 		return e.Msg
 	}
-	const maxErrorStack = 50
-	if len(e.positions) > maxErrorStack {
-		e.positions = e.positions[:maxErrorStack]
-	}
 	sb := strings.Builder{}
 	sources := e.sources
 	for i, pos := range e.positions {
-		if i == 0 {
-			if pos.Filename != "" {
-				s, line, col := getPosLine(sources[pos.Filename], pos.Pos)
-				fmt.Fprintf(&sb, "%s:%d:%d: %s\n",
-					pos.Filename, line, col+1, e.Msg)
-				writeLine(&sb, s, col)
-				continue
-			}
+		if i == 0 && pos.Filename == "" {
 			fmt.Fprintf(&sb, "%s\n", e.Msg)
 		}
-		if pos.Filename != "" {
+		switch {
+		case i == 0 && pos.Filename != "":
+			s, line, col := getPosLine(sources[pos.Filename], pos.Pos)
+			fmt.Fprintf(&sb, "%s:%d:%d: %s\n",
+				pos.Filename, line, col+1, e.Msg)
+			writeLine(&sb, s, col)
+		case pos.Filename != "":
 			s, line, col := getPosLine(sources[pos.Filename], pos.Pos)
 			ctxs := "called from"
 			if e.compile {
@@ -53,17 +68,80 @@ func (e *PanicError) Error() string {
 			}
 			fmt.Fprintf(&sb, "  (%s) %s:%d:%d\n", ctxs, pos.Filename, line, col+1)
 			writeLine(&sb, s, col)
-		} else if lc := pos.lambda; lc != nil {
+		case pos.lambda != nil:
+			lc := pos.lambda
 			s, _, col := getPosLine(lc.Source, pos.Pos-lc.StartPos)
 			writeLine(&sb, s, col)
-		} else {
+		default:
 			s, _, col := getPosLine(sources[""], pos.Pos)
 			writeLine(&sb, s, col)
 		}
+		switch {
+		case pos.repeat > 0 && pos.cycle > 1:
+			fmt.Fprintf(&sb, "  (last %d frames repeated %s)\n", pos.cycle, plural(pos.repeat, "more time"))
+		case pos.repeat > 0:
+			fmt.Fprintf(&sb, "  (repeated %s)\n", plural(pos.repeat, "more time"))
+		}
+		if pos.tails > 0 {
+			fmt.Fprintf(&sb, "  (%s elided by tail calls)\n", plural(pos.tails, "frame"))
+		}
+		if pos.elided > 0 {
+			fmt.Fprintf(&sb, "  (%s)\n", plural(pos.elided, "more frame"))
+		}
 	}
 	return strings.TrimSuffix(sb.String(), "\n")
 }
 
+// plural returns n followed by the given noun, in plural form unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Unwrap returns the underlying Go error that caused the panic, if any, like
+// context.Canceled for an interrupted RunContext.
+func (e *PanicError) Unwrap() error {
+	return e.cause
+}
+
+// frames returns the stack trace corresponding to the error positions, using
+// lambda names obtained from globals.
+func (e *PanicError) frames(ctx *Context) []Frame {
+	if len(e.positions) == 0 {
+		return nil
+	}
+	names := map[*lambdaCode]string{}
+	for id, x := range ctx.globals {
+		if lc := x.lambdaCode(ctx); lc != nil {
+			if _, ok := names[lc]; !ok {
+				names[lc] = ctx.gNames[id]
+			}
+		}
+	}
+	frames := make([]Frame, len(e.positions))
+	for i, pos := range e.positions {
+		fr := Frame{Filename: pos.Filename, Repeat: pos.repeat, Cycle: pos.cycle,
+			Tails: pos.tails, Elided: pos.elided}
+		var col int
+		switch {
+		case pos.Filename != "":
+			fr.Excerpt, fr.Line, col = getPosLine(e.sources[pos.Filename], pos.Pos)
+		case pos.lambda != nil:
+			fr.Excerpt, fr.Line, col = getPosLine(pos.lambda.Source, pos.Pos-pos.lambda.StartPos)
+		default:
+			fr.Excerpt, fr.Line, col = getPosLine(e.sources[""], pos.Pos)
+		}
+		fr.Column = col + 1
+		if pos.lambda != nil {
+			fr.Lambda = names[pos.lambda]
+		}
+		frames[i] = fr
+	}
+	return frames
+}
+
 func writeLine(sb *strings.Builder, s string, col int) {
 	if s == "" {
 		return
@@ -7,29 +7,32 @@ import (
 )
 
 // enum returns !x.
-func enum(x V) V {
+func enum(ctx *Context, x V) V {
 	if x.IsI() {
+		if err := ctx.allocN(x.I()); err != nil {
+			return Panicf("!i : %v", err)
+		}
 		return enumI(x.I())
 	}
 	if x.IsF() {
 		if !isI(x.F()) {
 			return Panicf("!i : non-integer i (%g)", x.F())
 		}
-		return enumI(int64(x.F()))
+		return enum(ctx, NewI(int64(x.F())))
 	}
 	switch xv := x.bv.(type) {
 	case S:
 		return NewAS(strings.Fields(string(xv)))
 	case *AB:
-		return odometer(xv.elts)
+		return odometer(ctx, xv.elts)
 	case *AF:
 		x := toAI(xv)
 		if x.IsPanic() {
 			return ppanic("!I : ", x)
 		}
-		return enum(x)
+		return enum(ctx, x)
 	case *AI:
-		return odometer(xv.elts)
+		return odometer(ctx, xv.elts)
 	case *AS:
 		r := make([]V, xv.Len())
 		for i, xi := range xv.elts {
@@ -37,7 +40,7 @@ func enum(x V) V {
 		}
 		return newAVu(r)
 	case *AV:
-		return mapAV(xv, enum)
+		return mapAV(xv, func(xi V) V { return enum(ctx, xi) })
 	case *D:
 		return xv.Keys()
 	default:
@@ -61,7 +64,7 @@ func enumI(n int64) V {
 	return NewV(&AI{elts: r, flags: flagAscending | flagDistinct})
 }
 
-func odometer[I integer](x []I) V {
+func odometer[I integer](ctx *Context, x []I) V {
 	cols := int64(1)
 	bsize := true
 	for _, n := range x {
@@ -76,6 +79,12 @@ func odometer[I integer](x []I) V {
 		}
 		cols *= int64(n)
 	}
+	if int64(len(x)) > math.MaxInt64/cols {
+		return panics("!I : too big: overflow")
+	}
+	if err := ctx.allocN(cols * int64(len(x))); err != nil {
+		return Panicf("!I : %v", err)
+	}
 	if bsize {
 		a := odometerWithCols[I, byte](x, cols)
 		r := make([]V, len(x))
@@ -114,12 +123,15 @@ func odometerWithCols[I integer, J integer](x []I, cols int64) []J {
 }
 
 // where returns &x.
-func where(x V) V {
+func where(ctx *Context, x V) V {
 	if x.IsI() {
 		switch {
 		case x.I() <= 0:
 			return newABb(nil)
 		default:
+			if err := ctx.allocN(x.I()); err != nil {
+				return Panicf("&i : %v", err)
+			}
 			r := make([]byte, x.I())
 			return newABb(r)
 		}
@@ -128,19 +140,25 @@ func where(x V) V {
 		if !isI(x.F()) {
 			return Panicf("&x : x non-integer (%g)", x.F())
 		}
-		return where(NewI(int64(x.F())))
+		return where(ctx, NewI(int64(x.F())))
 	}
 	switch xv := x.bv.(type) {
 	case *AB:
+		if err := ctx.allocCounts(x); err != nil {
+			return Panicf("&x : %v", err)
+		}
 		return whereAB(xv)
 	case *AI:
+		if err := ctx.allocCounts(x); err != nil {
+			return Panicf("&x : %v", err)
+		}
 		return whereAI(xv)
 	case *AF:
 		x := toAI(xv)
 		if x.IsPanic() {
 			return ppanic("&x : ", x)
 		}
-		return where(x)
+		return where(ctx, x)
 	case S:
 		return NewI(int64(len(xv)))
 	case *AS:
@@ -150,16 +168,16 @@ func where(x V) V {
 		}
 		return NewAI(r)
 	case *AV:
-		return cmapAV(xv, where)
+		return cmapAV(xv, func(xi V) V { return where(ctx, xi) })
 	case *D:
 		if xv.values.numeric() {
-			r := where(NewV(xv.values))
+			r := where(ctx, NewV(xv.values))
 			if r.IsPanic() {
 				return r
 			}
 			return NewV(arrayAtIv(xv.keys, r))
 		}
-		return newDictValues(xv.keys, where(NewV(xv.values)))
+		return newDictValues(xv.keys, where(ctx, NewV(xv.values)))
 	default:
 		return panicType("&x", "x", x)
 	}
@@ -614,7 +632,11 @@ func get(ctx *Context, x V) V {
 
 // reval implements .s.
 func reval(ctx *Context, s S) V {
-	nctx := NewContext()
+	nctx := ctx.sandbox()
+	nctx.intr = ctx.intr
+	nctx.usage = ctx.usage
+	nctx.callDepthMax = ctx.callDepthMax
+	nctx.Clock = ctx.Clock
 	r, err := nctx.Eval(string(s))
 	if err != nil {
 		return Panicf(".s : %v", err)
@@ -683,6 +705,9 @@ func recompileLambdas(ctx, nctx *Context, x V) V {
 			xv.Args[i] = xi
 		}
 		return x
+	case *closure:
+		// The closure's representation captures the same values.
+		return evalString(ctx, x.Sprint(nctx))
 	case *projectionMonad:
 		xv.Fun = recompileLambdas(ctx, nctx, xv.Fun)
 		if xv.Fun.IsPanic() {
@@ -791,7 +816,7 @@ func try(ctx *Context, f1, x, f2 V) V {
 		ctx.push(av.VAt(i))
 	}
 	r := f1.applyN(ctx, av.Len())
-	if r.IsPanic() {
+	if r.IsPanic() && !ctx.interrupted() {
 		r = NewS(string(r.bv.(panicV)))
 		ctx.replaceTop(r)
 		r = f2.applyN(ctx, 1)
@@ -807,7 +832,7 @@ func try(ctx *Context, f1, x, f2 V) V {
 // tryAt implements @[f1;x;f2].
 func tryAt(ctx *Context, f1, x, f2 V) V {
 	r := ctx.Apply(f1, x)
-	if r.IsPanic() {
+	if r.IsPanic() && !ctx.interrupted() {
 		r = NewS(string(r.bv.(panicV)))
 		ctx.replaceTop(r)
 		r = f2.applyN(ctx, 1)
@@ -0,0 +1,334 @@
+package goal
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// fmtIndent is the indentation used for each nesting level by Format.
+const fmtIndent = "  "
+
+// fmtItem represents a token or a comment in the source being formatted.
+type fmtItem struct {
+	Type    TokenType // token type (NONE for comments)
+	Pos     int
+	End     int
+	Text    string // source text
+	comment bool
+}
+
+// Format parses the source src with the builtin keywords of a new context,
+// and returns it reformatted in canonical style. See Context.Format.
+func Format(loc, src string) (string, error) {
+	return NewContext().Format(loc, src)
+}
+
+// Format parses the source src with the keywords defined in the context, and
+// returns it reformatted in canonical style, or a parse error. Line breaks are
+// preserved, with runs of blank lines reduced to one. Lines are indented with
+// two spaces per nesting level of brackets opened on previous lines. Spaces
+// within lines are reduced to those separating juxtaposed values, separating
+// statements after a semicolon, or needed to keep the same meaning. Comments,
+// string and regular expression literals are kept as written. Formatting is
+// idempotent.
+func (ctx *Context) Format(loc, src string) (string, error) {
+	if _, err := ctx.Parse(loc, src); err != nil {
+		return "", err
+	}
+	items := fmtItems(ctx.keywords, src)
+	var sb strings.Builder
+	var open []int // line of each open bracket
+	line := 0
+	var prev *fmtItem
+	prevSpace := false // space before prev
+	for i := range items {
+		it := &items[i]
+		nl := 0
+		if prev != nil {
+			nl = strings.Count(src[prev.End:it.Pos], "\n")
+		}
+		space := ""
+		switch {
+		case prev == nil || nl > 0:
+			if prev != nil {
+				if nl > 2 {
+					nl = 2
+				}
+				sb.WriteString(strings.Repeat("\n", nl))
+				line++
+			}
+			if !(it.comment && isBlockComment(it.Text)) {
+				depth := fmtDepth(open, items[i:])
+				sb.WriteString(strings.Repeat(fmtIndent, depth))
+			}
+		default:
+			space = fmtSpace(items[:i+1], prevSpace, open, src[prev.End:it.Pos])
+			sb.WriteString(space)
+		}
+		if it.comment {
+			if !isBlockComment(it.Text) {
+				sb.WriteString(strings.TrimRight(it.Text, " \t\r"))
+			} else {
+				sb.WriteString(it.Text)
+			}
+		} else {
+			sb.WriteString(it.Text)
+		}
+		switch it.Type {
+		case LEFTBRACE, LEFTBRACKET, LEFTBRACKETS, LEFTPAREN:
+			open = append(open, line)
+		case RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+		prev = it
+		prevSpace = space != ""
+	}
+	if prev != nil {
+		sb.WriteByte('\n')
+	}
+	r := sb.String()
+	if err := fmtCheck(ctx.keywords, src, r); err != nil {
+		return "", fmt.Errorf("%s: %v", loc, err)
+	}
+	return r, nil
+}
+
+// fmtItems returns the tokens and comments of src, with interpolated strings
+// as a single item.
+func fmtItems(keywords map[string]IdentType, src string) []fmtItem {
+	s := NewScanner(keywords, blankShebang(src))
+	s.keepComments = true
+	var items []fmtItem
+	qq := -1 // start of current interpolated string
+	for {
+		tok := s.Next()
+		switch tok.Type {
+		case EOF, ERROR:
+			return fmtMergeComments(items, s.comments, src)
+		case NEWLINE:
+			continue
+		case QQSTART:
+			qq = tok.Pos
+			continue
+		case QQEND:
+			tok.Type = STRING
+			tok.Pos = qq
+			qq = -1
+		}
+		if qq >= 0 {
+			continue
+		}
+		items = append(items, fmtItem{Type: tok.Type, Pos: tok.Pos, End: tok.End, Text: src[tok.Pos:tok.End]})
+	}
+}
+
+// fmtMergeComments inserts comments into items, sorted by position.
+func fmtMergeComments(items []fmtItem, comments []Comment, src string) []fmtItem {
+	if strings.HasPrefix(src, "#!") {
+		c := Comment{Slash: 0, Text: src[:strings.IndexByte(src+"\n", '\n')]}
+		comments = append([]Comment{c}, comments...)
+	}
+	if len(comments) == 0 {
+		return items
+	}
+	r := make([]fmtItem, 0, len(items)+len(comments))
+	i := 0
+	for _, c := range comments {
+		for i < len(items) && items[i].Pos < c.Slash {
+			r = append(r, items[i])
+			i++
+		}
+		r = append(r, fmtItem{Pos: c.Slash, End: c.Slash + len(c.Text), Text: c.Text, comment: true})
+	}
+	return append(r, items[i:]...)
+}
+
+// blankShebang replaces a starting #! line with spaces, so that positions are
+// preserved.
+func blankShebang(src string) string {
+	if !strings.HasPrefix(src, "#!") {
+		return src
+	}
+	i := strings.IndexByte(src, '\n')
+	if i < 0 {
+		i = len(src)
+	}
+	return strings.Repeat(" ", i) + src[i:]
+}
+
+func isBlockComment(s string) bool {
+	return strings.HasPrefix(s, "/\n") || strings.HasPrefix(s, "/\r\n")
+}
+
+// fmtDepth returns the indentation depth for a line starting with items[0],
+// given the lines of open brackets. Closing brackets at the start of the line
+// get the same depth as the line of their opening bracket, and several
+// brackets opened on the same line count as one level.
+func fmtDepth(open []int, items []fmtItem) int {
+	n := len(open)
+	for _, it := range items {
+		if n == 0 {
+			break
+		}
+		switch it.Type {
+		case RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
+			n--
+			continue
+		}
+		break
+	}
+	depth := 0
+	for i := 0; i < n; i++ {
+		if i == 0 || open[i] != open[i-1] {
+			depth++
+		}
+	}
+	return depth
+}
+
+// fmtEndsExpr reports whether the scanner considers that an expression may
+// end after the item, so that a following - starts a dyad instead of a
+// negative number.
+func fmtEndsExpr(it *fmtItem) bool {
+	switch it.Type {
+	case IDENT, NUMBER, STRING, REGEXP, RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
+		return !it.comment
+	default:
+		return false
+	}
+}
+
+// fmtStartsValue reports whether the item starts a value that can be
+// juxtaposed to a previous one.
+func fmtStartsValue(it *fmtItem) bool {
+	switch it.Type {
+	case IDENT, NUMBER, STRING, REGEXP, LEFTBRACE, LEFTPAREN:
+		return !it.comment
+	default:
+		return false
+	}
+}
+
+func isOpRune(r rune) bool {
+	return strings.ContainsRune("+-*%!&|<>=~,^#_$?@.:»«¿", r)
+}
+
+// fmtSpace returns the spacing that should separate the last two items,
+// given whether there was a space before the previous one in the output, and
+// the source text between them. Spaces that are not needed are only kept
+// before a trailing comment, between juxtaposed values, and after a semicolon
+// separating statements.
+func fmtSpace(items []fmtItem, prevSpace bool, open []int, gap string) string {
+	b := &items[len(items)-1]
+	a := &items[len(items)-2]
+	if b.comment {
+		return gap
+	}
+	ra, _ := utf8.DecodeLastRuneInString(a.Text)
+	rb, _ := utf8.DecodeRuneInString(b.Text)
+	switch {
+	case b.Type == SADVERB || b.Type == LEFTBRACKETS:
+		// meaning depends on the space
+		return " "
+	case (isAlphaNum(ra) || ra == '.') && (isAlphaNum(rb) || rb == '.' && (a.Type == NUMBER || b.Type == NUMBER)):
+		return " "
+	case rb == '-' && b.Type == NUMBER:
+		// negative number
+		return fmtSpaceIf(fmtEndsExpr(a) || isAlphaNum(ra))
+	case a.Type == DYAD && a.Text == "-" && isDigit(rb):
+		// not a negative number
+		return fmtSpaceIf(len(items) < 3 || prevSpace || !fmtEndsExpr(&items[len(items)-3]))
+	case rb == ':' && isOpRune(ra):
+		return " "
+	case a.Type == IDENT && (a.Text == "qq" || a.Text == "rq" || a.Text == "rx"):
+		return fmtSpaceIf(strings.ContainsRune(":+-*%!&|=~,^#_?@/'", rb))
+	case a.Type == SEMICOLON:
+		// statement separator
+		return fmtSpaceIf(gap != "" && (len(open) == 0 || fmtOpenType(items[:len(items)-1]) == LEFTBRACE))
+	case fmtEndsExpr(a) && fmtStartsValue(b):
+		// juxtaposition
+		return fmtSpaceIf(gap != "")
+	}
+	return ""
+}
+
+func fmtSpaceIf(b bool) string {
+	if b {
+		return " "
+	}
+	return ""
+}
+
+// fmtOpenType returns the type of the innermost open bracket at the end of
+// items.
+func fmtOpenType(items []fmtItem) TokenType {
+	n := 0
+	for i := len(items) - 1; i >= 0; i-- {
+		switch items[i].Type {
+		case RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
+			n++
+		case LEFTBRACE, LEFTBRACKET, LEFTBRACKETS, LEFTPAREN:
+			if n == 0 {
+				return items[i].Type
+			}
+			n--
+		}
+	}
+	return NONE
+}
+
+// fmtCheck returns an error if the tokens of formatted source r differ from
+// the ones of source src.
+func fmtCheck(keywords map[string]IdentType, src, r string) error {
+	t1 := fmtTokens(keywords, src)
+	t2 := fmtTokens(keywords, r)
+	for i := range t1 {
+		if i >= len(t2) || t1[i].Type != t2[i].Type || t1[i].Text != t2[i].Text {
+			pos := len(r)
+			if i < len(t2) {
+				pos = t2[i].Pos
+			}
+			_, line, _ := getPosLine(r, pos)
+			return fmt.Errorf("formatting changed tokens at line %d", line)
+		}
+	}
+	return nil
+}
+
+// fmtTokens returns the tokens of src, with consecutive, leading and trailing
+// newlines elided, and token types normalized for those that only differ by
+// indentation.
+func fmtTokens(keywords map[string]IdentType, src string) []Token {
+	s := NewScanner(keywords, blankShebang(src))
+	var toks []Token
+	prev := NEWLINE
+	for {
+		tok := s.Next()
+		switch tok.Type {
+		case NEWLINE:
+			if prev == NEWLINE {
+				continue
+			}
+		case EOF, ERROR:
+			if prev == NEWLINE && len(toks) > 0 {
+				toks = toks[:len(toks)-1]
+			}
+			return append(toks, tok)
+		}
+		typ := tok.Type
+		switch prev {
+		case NEWLINE, SEMICOLON, LEFTBRACE, LEFTBRACKET, LEFTBRACKETS, LEFTPAREN:
+			switch tok.Type {
+			case SADVERB:
+				tok.Type = ADVERB
+			case LEFTBRACKETS:
+				tok.Type = LEFTBRACKET
+			}
+		}
+		prev = typ
+		toks = append(toks, tok)
+	}
+}
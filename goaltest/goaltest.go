@@ -0,0 +1,237 @@
+// Package goaltest runs test cases written in goal.
+//
+// Test files have names ending in _test.goal. Each line of the form
+//
+//	expr / expected
+//
+// is a test case, that passes if the results of expr and expected match, as
+// with the ~ verb. As a result, test files are valid goal source, where the
+// expected results appear as comments. Comment lines and blocks are ignored.
+// Other lines are setup code, like imports or helper definitions, that is
+// evaluated in order before the following test cases. Setup code should not
+// use trailing comments, as those would be taken for test cases.
+//
+// All the setup code of a file runs in a same context, and each test case
+// runs in a fork of it, so that test cases do not affect each other.
+package goaltest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"codeberg.org/anaseto/goal"
+)
+
+// Case represents a test case.
+type Case struct {
+	File      string // file name
+	Line      int    // line number (starting from 1)
+	Column    int    // column number of Expr (starting from 1)
+	Expr      string // tested expression
+	Expected  string // expression with expected result
+	Setup     string // setup code to run before, if any
+	SetupLine int    // line number of the first line of Setup
+}
+
+// Name returns the name of the test case, made of the file base name and the
+// line number, like in lib_test.goal:12.
+func (c *Case) Name() string {
+	return fmt.Sprintf("%s:%d", filepath.Base(c.File), c.Line)
+}
+
+// Parse returns the test cases of a test file. Setup code following the last
+// test case is ignored.
+func Parse(fname, src string) []Case {
+	var cases []Case
+	var setup []string
+	block := false // within a comment block
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case block:
+			block = line != "\\"
+		case line == "/":
+			block = true
+		}
+		if block || trimmed == "" || trimmed[0] == '/' || line == "\\" || i == 0 && strings.HasPrefix(line, "#!") {
+			setup = append(setup, "")
+			continue
+		}
+		left, right, found := strings.Cut(trimmed, " /")
+		if !found || strings.TrimSpace(right) == "" {
+			setup = append(setup, line)
+			continue
+		}
+		c := Case{
+			File:     fname,
+			Line:     i + 1,
+			Column:   len(line) - len(trimmed) + 1,
+			Expr:     strings.TrimSpace(left),
+			Expected: strings.TrimSpace(right),
+		}
+		for j, sline := range setup {
+			if strings.TrimSpace(sline) != "" {
+				c.Setup = strings.TrimRight(strings.Join(setup[j:], "\n"), " \t\n")
+				c.SetupLine = i + 1 - len(setup) + j
+				break
+			}
+		}
+		cases = append(cases, c)
+		setup = setup[:0]
+	}
+	return cases
+}
+
+// Find returns the test files found in the given paths. Directories are
+// searched recursively, skipping the ones whose name starts with a dot.
+// Other paths are returned as is.
+func Find(paths ...string) ([]string, error) {
+	var fnames []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			fnames = append(fnames, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != p && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), "_test.goal") {
+				fnames = append(fnames, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fnames, nil
+}
+
+// Config describes options for running test files.
+type Config struct {
+	// NewContext returns the context in which a file's setup code is
+	// evaluated. If nil, goal.NewContext is used.
+	NewContext func() *goal.Context
+
+	// Filter, if not nil, selects the test cases to run: the ones whose
+	// name or expression matches.
+	Filter *regexp.Regexp
+}
+
+// Result represents the result of running a test case.
+type Result struct {
+	Case
+	Got      string        // result of Expr, formatted with Sprint
+	Want     string        // result of Expected, formatted with Sprint
+	Err      error         // evaluation error, if any
+	Failed   bool          // whether the test failed
+	Duration time.Duration // running time
+}
+
+// FileResult represents the results of running a test file.
+type FileResult struct {
+	File     string        // file name
+	Results  []Result      // results of selected test cases
+	Err      error         // error reading the file or running setup code
+	Duration time.Duration // running time
+}
+
+// Failed reports whether the file has failed test cases or an error.
+func (fr *FileResult) Failed() bool {
+	if fr.Err != nil {
+		return true
+	}
+	for i := range fr.Results {
+		if fr.Results[i].Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// RunFile runs the test cases of test file fname. Paths in imports are
+// relative to the current directory, as usual.
+func RunFile(fname string, cfg Config) *FileResult {
+	bs, err := os.ReadFile(fname)
+	if err != nil {
+		return &FileResult{File: fname, Err: err}
+	}
+	return Run(fname, string(bs), cfg)
+}
+
+// Run runs the test cases of test file fname with source src.
+func Run(fname, src string, cfg Config) *FileResult {
+	start := time.Now()
+	fr := &FileResult{File: fname}
+	defer func() { fr.Duration = time.Since(start) }()
+	newContext := cfg.NewContext
+	if newContext == nil {
+		newContext = goal.NewContext
+	}
+	ctx := newContext()
+	for _, c := range Parse(fname, src) {
+		if c.Setup != "" {
+			if err := runSetup(ctx, c); err != nil {
+				fr.Err = fmt.Errorf("setup before line %d: %v", c.Line, err)
+				return fr
+			}
+		}
+		if cfg.Filter != nil && !cfg.Filter.MatchString(c.Name()) && !cfg.Filter.MatchString(c.Expr) {
+			continue
+		}
+		fr.Results = append(fr.Results, runCase(ctx, c))
+	}
+	return fr
+}
+
+// runSetup runs the setup code of a test case, so that error locations refer
+// to the test file.
+func runSetup(ctx *goal.Context, c Case) error {
+	// Lines before the setup code are padded with tabs, because Compile
+	// trims leading spaces and newlines.
+	err := ctx.Compile(c.File, strings.Repeat("\t\n", c.SetupLine-1)+c.Setup)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.Run()
+	return err
+}
+
+// runCase runs a test case in forks of ctx.
+func runCase(ctx *goal.Context, c Case) (r Result) {
+	start := time.Now()
+	r.Case = c
+	defer func() { r.Duration = time.Since(start) }()
+	lctx := ctx.Fork()
+	got, err := lctx.Eval(c.Expr)
+	if err != nil {
+		r.Err, r.Failed = err, true
+		return r
+	}
+	rctx := ctx.Fork()
+	want, err := rctx.Eval(c.Expected)
+	if err != nil {
+		r.Err, r.Failed = fmt.Errorf("expected: %v", err), true
+		return r
+	}
+	r.Got, r.Want = got.Sprint(lctx), want.Sprint(rctx)
+	r.Failed = !got.Matches(want)
+	return r
+}
@@ -0,0 +1,148 @@
+package goaltest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const src = `#!/usr/bin/env goal
+/ comment / 1
+sq:{x*x}
+/
+block / 2
+\
+sq 3 / 9
+  sq 2 / 5
+f:{
+  1+x
+}
+f 1 / 2
+1+"a" / 2
+`
+
+func TestParse(t *testing.T) {
+	cases := Parse("t_test.goal", src)
+	if len(cases) != 4 {
+		t.Fatalf("expected 4 cases, got %d: %+v", len(cases), cases)
+	}
+	want := []Case{
+		{File: "t_test.goal", Line: 7, Column: 1, Expr: "sq 3", Expected: "9", Setup: "sq:{x*x}", SetupLine: 3},
+		{File: "t_test.goal", Line: 8, Column: 3, Expr: "sq 2", Expected: "5"},
+		{File: "t_test.goal", Line: 12, Column: 1, Expr: "f 1", Expected: "2", Setup: "f:{\n  1+x\n}", SetupLine: 9},
+		{File: "t_test.goal", Line: 13, Column: 1, Expr: `1+"a"`, Expected: "2"},
+	}
+	for i, c := range cases {
+		if c != want[i] {
+			t.Errorf("case %d: got %+v, expected %+v", i, c, want[i])
+		}
+	}
+	if got := cases[0].Name(); got != "t_test.goal:7" {
+		t.Errorf("bad name: %s", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	fr := Run("t_test.goal", src, Config{})
+	if fr.Err != nil {
+		t.Fatal(fr.Err)
+	}
+	if !fr.Failed() {
+		t.Error("expected failure")
+	}
+	failed := map[int]bool{}
+	for _, r := range fr.Results {
+		failed[r.Line] = r.Failed
+	}
+	if failed[7] || !failed[8] || failed[12] || !failed[13] {
+		t.Errorf("bad results: %+v", fr.Results)
+	}
+	if r := fr.Results[1]; r.Got != "4" || r.Want != "5" || r.Err != nil {
+		t.Errorf("bad mismatch result: %+v", r)
+	}
+	if r := fr.Results[3]; r.Err == nil {
+		t.Errorf("expected error: %+v", r)
+	}
+
+	fr = Run("t_test.goal", src, Config{Filter: regexp.MustCompile(`^sq|:12$`)})
+	if len(fr.Results) != 3 || fr.Results[2].Line != 12 {
+		t.Errorf("bad filtered results: %+v", fr.Results)
+	}
+
+	fr = Run("t_test.goal", "x:(\n1 / 1\n", Config{})
+	if fr.Err == nil || !strings.Contains(fr.Err.Error(), "setup before line 2") {
+		t.Errorf("expected setup error: %v", fr.Err)
+	}
+	fr = Run("t_test.goal", "/ c\n\n  y:1+\"a\"\n1 / 1\n", Config{})
+	if fr.Err == nil || !strings.Contains(fr.Err.Error(), "t_test.goal:3:6:") {
+		t.Errorf("bad setup error location: %v", fr.Err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	fr := Run("t_test.goal", src, Config{})
+	var buf bytes.Buffer
+	if err := WriteText(&buf, fr, false); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, s := range []string{"--- FAIL: t_test.goal:8", "t_test.goal:8:3: sq 2\n        got:      4\n        expected: 5\n", "FAIL\tt_test.goal\t"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("missing %q in text output:\n%s", s, text)
+		}
+	}
+	if strings.Contains(text, "PASS") {
+		t.Errorf("unexpected passed cases in non-verbose output:\n%s", text)
+	}
+	buf.Reset()
+	if err := WriteTAP(&buf, []*FileResult{fr, {File: "bad_test.goal", Err: os.ErrNotExist}}); err != nil {
+		t.Fatal(err)
+	}
+	tap := buf.String()
+	for _, s := range []string{"TAP version 13\n1..5\n", "ok 1 - t_test.goal:7 sq 3\n", "not ok 2 - t_test.goal:8 sq 2\n", "not ok 5 - bad_test.goal\n"} {
+		if !strings.Contains(tap, s) {
+			t.Errorf("missing %q in TAP output:\n%s", s, tap)
+		}
+	}
+	buf.Reset()
+	if err := WriteJUnit(&buf, []*FileResult{fr}); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 4 || suites.Failures != 1 || suites.Errors != 1 {
+		t.Errorf("bad JUnit output:\n%s", buf.String())
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"a_test.goal", "b.goal", "sub/c_test.goal", ".hidden/d_test.goal"} {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fnames, err := Find(dir, filepath.Join(dir, "b.goal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a_test.goal", "sub/c_test.goal", "b.goal"}
+	if len(fnames) != len(want) {
+		t.Fatalf("got %v, expected %v", fnames, want)
+	}
+	for i, fname := range fnames {
+		if rel, _ := filepath.Rel(dir, fname); filepath.ToSlash(rel) != want[i] {
+			t.Errorf("got %s, expected %s", rel, want[i])
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package goaltest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// position returns the source position of a test case.
+func (c *Case) position() string {
+	return fmt.Sprintf("%s:%d:%d", c.File, c.Line, c.Column)
+}
+
+// message returns a one-line description of a failure.
+func (r *Result) message() string {
+	if r.Err != nil {
+		msg, _, _ := strings.Cut(r.Err.Error(), "\n")
+		return msg
+	}
+	return fmt.Sprintf("got %s, expected %s", r.Got, r.Want)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// indent indents the lines of s with the given prefix.
+func indent(s, prefix string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix) + "\n"
+}
+
+// WriteText writes the results of a test file in a plain text format, in
+// the style of go test. Failed test cases are reported with the position of
+// the tested expression, and the formatted results or the error. In verbose
+// mode, passed test cases are listed too.
+func WriteText(w io.Writer, fr *FileResult, verbose bool) error {
+	var sb strings.Builder
+	for i := range fr.Results {
+		r := &fr.Results[i]
+		if !r.Failed {
+			if verbose {
+				fmt.Fprintf(&sb, "--- PASS: %s (%ss)\n", r.Name(), seconds(r.Duration))
+			}
+			continue
+		}
+		fmt.Fprintf(&sb, "--- FAIL: %s (%ss)\n", r.Name(), seconds(r.Duration))
+		fmt.Fprintf(&sb, "    %s: %s\n", r.position(), r.Expr)
+		if r.Err != nil {
+			sb.WriteString(indent(r.Err.Error(), "        "))
+			continue
+		}
+		fmt.Fprintf(&sb, "        got:      %s\n", r.Got)
+		fmt.Fprintf(&sb, "        expected: %s\n", r.Want)
+	}
+	switch {
+	case fr.Err != nil:
+		fmt.Fprintf(&sb, "--- FAIL: %s\n", fr.File)
+		sb.WriteString(indent(fr.Err.Error(), "    "))
+		fmt.Fprintf(&sb, "FAIL\t%s\t%ss\n", fr.File, seconds(fr.Duration))
+	case fr.Failed():
+		fmt.Fprintf(&sb, "FAIL\t%s\t%ss\n", fr.File, seconds(fr.Duration))
+	case len(fr.Results) == 0:
+		fmt.Fprintf(&sb, "ok  \t%s\t%ss [no tests to run]\n", fr.File, seconds(fr.Duration))
+	default:
+		fmt.Fprintf(&sb, "ok  \t%s\t%ss\n", fr.File, seconds(fr.Duration))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteTAP writes the results of test files in the Test Anything Protocol
+// format (version 13). A file that could not be run counts as a failed
+// test.
+func WriteTAP(w io.Writer, frs []*FileResult) error {
+	var sb strings.Builder
+	n := 0
+	for _, fr := range frs {
+		n += len(fr.Results)
+		if fr.Err != nil {
+			n++
+		}
+	}
+	fmt.Fprintf(&sb, "TAP version 13\n1..%d\n", n)
+	i := 0
+	for _, fr := range frs {
+		for j := range fr.Results {
+			r := &fr.Results[j]
+			i++
+			if !r.Failed {
+				fmt.Fprintf(&sb, "ok %d - %s %s\n", i, r.Name(), r.Expr)
+				continue
+			}
+			fmt.Fprintf(&sb, "not ok %d - %s %s\n", i, r.Name(), r.Expr)
+			sb.WriteString("  ---\n")
+			fmt.Fprintf(&sb, "  at: %s\n", strconv.Quote(r.position()))
+			if r.Err != nil {
+				fmt.Fprintf(&sb, "  error: %s\n", strconv.Quote(r.Err.Error()))
+			} else {
+				fmt.Fprintf(&sb, "  got: %s\n", strconv.Quote(r.Got))
+				fmt.Fprintf(&sb, "  expected: %s\n", strconv.Quote(r.Want))
+			}
+			sb.WriteString("  ...\n")
+		}
+		if fr.Err != nil {
+			i++
+			fmt.Fprintf(&sb, "not ok %d - %s\n", i, fr.File)
+			fmt.Fprintf(&sb, "  ---\n  error: %s\n  ...\n", strconv.Quote(fr.Err.Error()))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results of test files in the JUnit XML format, with
+// a test suite per file. Mismatched results are reported as failures, and
+// evaluation errors as errors. A file that could not be run is reported as
+// an error in a test case named after the file.
+func WriteJUnit(w io.Writer, frs []*FileResult) error {
+	var suites junitSuites
+	for _, fr := range frs {
+		s := junitSuite{Name: fr.File, Time: seconds(fr.Duration)}
+		for i := range fr.Results {
+			r := &fr.Results[i]
+			jc := junitCase{Classname: fr.File, Name: r.Name() + " " + r.Expr, Time: seconds(r.Duration)}
+			switch {
+			case r.Err != nil:
+				jc.Error = &junitFailure{Message: r.message(), Text: r.position() + ": " + r.Err.Error()}
+				s.Errors++
+			case r.Failed:
+				jc.Failure = &junitFailure{Message: r.message(),
+					Text: fmt.Sprintf("%s: %s\ngot:      %s\nexpected: %s", r.position(), r.Expr, r.Got, r.Want)}
+				s.Failures++
+			}
+			s.Cases = append(s.Cases, jc)
+		}
+		if fr.Err != nil {
+			s.Cases = append(s.Cases, junitCase{Classname: fr.File, Name: fr.File, Time: seconds(fr.Duration),
+				Error: &junitFailure{Message: fr.Err.Error(), Text: fr.Err.Error()}})
+			s.Errors++
+		}
+		s.Tests = len(s.Cases)
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+		suites.Errors += s.Errors
+		suites.Suites = append(suites.Suites, s)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,233 @@
+package goal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FuncOptions represents options for RegisterFuncWith.
+type FuncOptions struct {
+	// Vectorize makes the function apply element-wise when an array is
+	// passed for an argument whose Go type is a number, boolean, string
+	// or time.Time. Atom arguments are then repeated as needed, and
+	// results collected into an array.
+	Vectorize bool
+}
+
+// goFunc represents a Go function registered with RegisterFunc.
+type goFunc struct {
+	fn        reflect.Value
+	in        []reflect.Type // parameter types
+	variadic  bool           // whether last parameter is variadic
+	nout      int            // number of non-error results
+	hasErr    bool           // whether last result is an error
+	op        string         // name for error messages, like "x name y"
+	vectorize bool
+}
+
+var typeError = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc is like RegisterFuncWith with default options.
+func (ctx *Context) RegisterFunc(name string, fn interface{}) V {
+	return ctx.RegisterFuncWith(name, fn, FuncOptions{})
+}
+
+// RegisterFuncWith adds a Go function to the context as a new keyword, and
+// returns the corresponding variadic value. Functions with two parameters are
+// registered as dyads, and other functions as monads. Functions without
+// parameters ignore their single argument, as in f 0. Arguments are converted
+// using ToGo, and a result using FromGo. A function may return zero or one
+// result, optionally followed by an error: a non-nil error is returned as a
+// goal error value. Functions without results return 1, like say, and nil
+// pointer or interface results are returned as 0. Parameters of type V
+// receive the goal value unchanged.
+//
+// It panics if fn is not a function with a supported signature, or if the
+// keyword is already in use.
+func (ctx *Context) RegisterFuncWith(name string, fn interface{}, opts FuncOptions) V {
+	gf := newGoFunc(name, fn)
+	gf.vectorize = opts.Vectorize
+	vf := func(ctx *Context, args []V) V { return gf.call(ctx, args) }
+	if len(gf.in) == 2 && !gf.variadic {
+		return ctx.RegisterDyad(name, vf)
+	}
+	return ctx.RegisterMonad(name, vf)
+}
+
+func newGoFunc(name string, fn interface{}) *goFunc {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	if t.Kind() != reflect.Func {
+		panic(fmt.Sprintf("RegisterFunc: %s: not a function (%T)", name, fn))
+	}
+	gf := &goFunc{fn: f, variadic: t.IsVariadic()}
+	for i := 0; i < t.NumIn(); i++ {
+		gf.in = append(gf.in, t.In(i))
+	}
+	gf.nout = t.NumOut()
+	if gf.nout > 0 && t.Out(gf.nout-1) == typeError {
+		gf.hasErr = true
+		gf.nout--
+	}
+	if gf.nout > 1 {
+		panic(fmt.Sprintf("RegisterFunc: %s: too many results (%s)", name, t))
+	}
+	switch {
+	case len(gf.in) <= 1 && !gf.variadic:
+		gf.op = name + " x"
+	case len(gf.in) == 2 && !gf.variadic:
+		gf.op = "x " + name + " y"
+	case !gf.variadic:
+		names := make([]string, len(gf.in))
+		for i := range names {
+			names[i] = argName(i)
+		}
+		gf.op = name + "[" + strings.Join(names, ";") + "]"
+	default:
+		gf.op = name + "[x;y;...]"
+	}
+	return gf
+}
+
+// argName returns the name used in error messages for the i-th argument.
+func argName(i int) string {
+	switch i {
+	case 0:
+		return "x"
+	case 1:
+		return "y"
+	case 2:
+		return "z"
+	default:
+		return "arg " + strconv.Itoa(i+1)
+	}
+}
+
+// paramType returns the Go type of the i-th argument.
+func (gf *goFunc) paramType(i int) reflect.Type {
+	if gf.variadic && i >= len(gf.in)-1 {
+		return gf.in[len(gf.in)-1].Elem()
+	}
+	return gf.in[i]
+}
+
+func (gf *goFunc) call(ctx *Context, args []V) V {
+	n := len(args)
+	wanted := len(gf.in)
+	if wanted == 0 && n == 1 {
+		// argument of a niladic function
+		args = args[:0]
+		n = 0
+	}
+	switch {
+	case gf.variadic && n < wanted-1:
+		return panicRankN(gf.op, "f", wanted-1, n)
+	case !gf.variadic && n != wanted:
+		if n > wanted {
+			return panicRank(gf.op)
+		}
+		return panicRankN(gf.op, "f", wanted, n)
+	}
+	if gf.vectorize {
+		if l := gf.vectorLen(args); l >= 0 {
+			return gf.callVectorized(ctx, args, l)
+		}
+	}
+	return gf.callOnce(ctx, args)
+}
+
+// vectorLen returns the length of array arguments for scalar parameters, or
+// -1 if there are none.
+func (gf *goFunc) vectorLen(args []V) int {
+	l := -1
+	for i := range args {
+		xa, ok := args[len(args)-1-i].bv.(Array)
+		if !ok || !isScalarType(gf.paramType(i)) {
+			continue
+		}
+		if l < 0 || xa.Len() < l {
+			l = xa.Len()
+		}
+	}
+	return l
+}
+
+func isScalarType(t reflect.Type) bool {
+	if t == typeTime {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func (gf *goFunc) callVectorized(ctx *Context, args []V, l int) V {
+	for i := range args {
+		xa, ok := args[len(args)-1-i].bv.(Array)
+		if ok && isScalarType(gf.paramType(i)) && xa.Len() != l {
+			return panicLength(gf.op, l, xa.Len())
+		}
+	}
+	r := make([]V, l)
+	eargs := make([]V, len(args))
+	for j := range r {
+		for i, arg := range args {
+			if xa, ok := arg.bv.(Array); ok && isScalarType(gf.paramType(len(args)-1-i)) {
+				eargs[i] = xa.VAt(j)
+			} else {
+				eargs[i] = arg
+			}
+		}
+		rj := gf.callOnce(ctx, eargs)
+		if rj.IsPanic() || rj.IsError() {
+			return rj
+		}
+		r[j] = rj
+	}
+	return NewAV(r)
+}
+
+func (gf *goFunc) callOnce(ctx *Context, args []V) V {
+	in := make([]reflect.Value, len(args))
+	for i := range in {
+		x := args[len(args)-1-i]
+		t := gf.paramType(i)
+		v := reflect.New(t).Elem()
+		err := toGo(ctx, x, v)
+		if err != nil {
+			if e, ok := err.(*ConvError); ok && e.badType && e.Path == "" {
+				return panicType(gf.op, argName(i), x)
+			}
+			return Panicf("%s : %s: %v", gf.op, argName(i), err)
+		}
+		in[i] = v
+	}
+	out := gf.fn.Call(in)
+	if gf.hasErr {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return Errorf("%v", err)
+		}
+	}
+	if gf.nout == 0 {
+		return NewI(1)
+	}
+	switch out[0].Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if out[0].IsNil() {
+			return NewI(0)
+		}
+	}
+	r, err := fromGo(out[0], map[visit]bool{})
+	if err != nil {
+		return Panicf("%s : result: %v", gf.op, err)
+	}
+	return r
+}
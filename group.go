@@ -1,7 +1,8 @@
 package goal
 
 // icountGroup returns =x.
-func icountGroup(x V) V {
+func icountGroup(ctx *Context, x V) (r V) {
+	defer catchInterrupt(&r)
 	switch xv := x.bv.(type) {
 	case S:
 		return NewAS(lineSplit(string(xv)))
@@ -31,15 +32,15 @@ func icountGroup(x V) V {
 			return newABb(nil)
 		}
 		if xv.Len() < 256 {
-			return NewAB(icountIs[byte](xv.elts))
+			return NewAB(icountIs[byte](ctx, xv.elts))
 		}
-		return NewAI(icountIs[int64](xv.elts))
+		return NewAI(icountIs[int64](ctx, xv.elts))
 	case *AF:
 		x = toAI(xv)
 		if x.IsPanic() {
 			return ppanic("=x : ", x)
 		}
-		return icountGroup(x)
+		return icountGroup(ctx, x)
 	case *AS:
 		r := make([]V, xv.Len())
 		for i, xi := range xv.elts {
@@ -47,21 +48,22 @@ func icountGroup(x V) V {
 		}
 		return newAVu(r)
 	case *D:
-		return groupBy(NewV(xv.values), NewV(xv.keys))
+		return groupBy(ctx, NewV(xv.values), NewV(xv.keys))
 	case *AV:
-		return mapAV(xv, icountGroup)
+		return mapAV(xv, func(x V) V { return icountGroup(ctx, x) })
 	default:
 		return panicType("=x", "x", x)
 	}
 }
 
-func icountIs[I integer](x []int64) []I {
+func icountIs[I integer](ctx *Context, x []int64) []I {
 	max := maxIs(x)
 	if max < 0 {
 		max = -1
 	}
 	icounts := make([]I, max+1)
-	for _, xi := range x {
+	for i, xi := range x {
+		ctx.pollInterrupt(i)
 		if xi >= 0 {
 			icounts[xi]++
 		}
@@ -79,7 +81,8 @@ func icountBytes[I integer](x []byte) []I {
 }
 
 // groupBy by returns {x}=y.
-func groupBy(x, y V) V {
+func groupBy(ctx *Context, x, y V) (r V) {
+	defer catchInterrupt(&r)
 	xlen := x.Len()
 	if xlen != y.Len() {
 		return Panicf("f=Y : length mismatch for f[Y] and Y: %d vs %d ",
@@ -98,7 +101,7 @@ func groupBy(x, y V) V {
 		if ascending(xv) {
 			switch yv := y.bv.(type) {
 			case Array:
-				return groupBySorted(xv.elts, yv, int64(max))
+				return groupBySorted(ctx, xv.elts, yv, int64(max))
 			default:
 				return panicType("f=Y", "Y", y)
 			}
@@ -125,22 +128,22 @@ func groupBy(x, y V) V {
 		if ascending(xv) {
 			switch yv := y.bv.(type) {
 			case Array:
-				return groupBySorted(xv.elts, yv, int64(max))
+				return groupBySorted(ctx, xv.elts, yv, int64(max))
 			default:
 				return panicType("f=Y", "Y", y)
 			}
 		}
 		switch yv := y.bv.(type) {
 		case *AB:
-			return groupByInt64sBytes(xv.elts, yv.elts, max, yv.IsBoolean())
+			return groupByInt64sBytes(ctx, xv.elts, yv.elts, max, yv.IsBoolean())
 		case *AI:
-			return groupByInt64sInt64s(xv.elts, yv.elts, max)
+			return groupByInt64sInt64s(ctx, xv.elts, yv.elts, max)
 		case *AF:
-			return groupByInt64sFloat64s(xv.elts, yv.elts, max)
+			return groupByInt64sFloat64s(ctx, xv.elts, yv.elts, max)
 		case *AS:
-			return groupByInt64sStrings(xv.elts, yv.elts, max)
+			return groupByInt64sStrings(ctx, xv.elts, yv.elts, max)
 		case *AV:
-			return groupByInt64sVs(xv.elts, yv.elts, max)
+			return groupByInt64sVs(ctx, xv.elts, yv.elts, max)
 		default:
 			return panicType("f=Y", "Y", y)
 		}
@@ -149,7 +152,7 @@ func groupBy(x, y V) V {
 		if ix.IsPanic() {
 			return ppanic("f=x : f[Y]", ix)
 		}
-		return groupBy(ix, y)
+		return groupBy(ctx, ix, y)
 	default:
 		return panicType("f=Y", "f[Y]", x)
 	}
@@ -318,78 +321,84 @@ func groupByScatterBytes[T any](x []byte, y []T, yg []T, offset []int) {
 	}
 }
 
-func groupByInt64sBytes(x []int64, y []byte, max int64, b bool) V {
-	r, offset, yg := groupByPrepare[byte](x, max)
+func groupByInt64sBytes(ctx *Context, x []int64, y []byte, max int64, b bool) V {
+	r, offset, yg := groupByPrepare[byte](ctx, x, max)
 	var fl flags
 	if b {
 		fl = flagBool
 	}
 	count := 0
 	for i, n := range offset {
+		ctx.pollInterrupt(i)
 		offset[i] = count
 		r[i] = NewV(&AB{elts: yg[count : count+n], flags: fl | flagImmutable})
 		count += n
 	}
-	groupByScatter[byte](x, y, yg, offset)
+	groupByScatter[byte](ctx, x, y, yg, offset)
 	return newAVu(r)
 }
 
-func groupByInt64sInt64s(x []int64, y []int64, max int64) V {
-	r, offset, yg := groupByPrepare[int64](x, max)
+func groupByInt64sInt64s(ctx *Context, x []int64, y []int64, max int64) V {
+	r, offset, yg := groupByPrepare[int64](ctx, x, max)
 	count := 0
 	for i, n := range offset {
+		ctx.pollInterrupt(i)
 		offset[i] = count
 		r[i] = NewV(&AI{elts: yg[count : count+n], flags: flagImmutable})
 		count += n
 	}
-	groupByScatter[int64](x, y, yg, offset)
+	groupByScatter[int64](ctx, x, y, yg, offset)
 	return newAVu(r)
 }
 
-func groupByInt64sFloat64s(x []int64, y []float64, max int64) V {
-	r, offset, yg := groupByPrepare[float64](x, max)
+func groupByInt64sFloat64s(ctx *Context, x []int64, y []float64, max int64) V {
+	r, offset, yg := groupByPrepare[float64](ctx, x, max)
 	count := 0
 	for i, n := range offset {
+		ctx.pollInterrupt(i)
 		offset[i] = count
 		r[i] = NewV(&AF{elts: yg[count : count+n], flags: flagImmutable})
 		count += n
 	}
-	groupByScatter[float64](x, y, yg, offset)
+	groupByScatter[float64](ctx, x, y, yg, offset)
 	return newAVu(r)
 }
 
-func groupByInt64sStrings(x []int64, y []string, max int64) V {
-	r, offset, yg := groupByPrepare[string](x, max)
+func groupByInt64sStrings(ctx *Context, x []int64, y []string, max int64) V {
+	r, offset, yg := groupByPrepare[string](ctx, x, max)
 	count := 0
 	for i, n := range offset {
+		ctx.pollInterrupt(i)
 		offset[i] = count
 		r[i] = NewV(&AS{elts: yg[count : count+n], flags: flagImmutable})
 		count += n
 	}
-	groupByScatter[string](x, y, yg, offset)
+	groupByScatter[string](ctx, x, y, yg, offset)
 	return newAVu(r)
 }
 
-func groupByInt64sVs(x []int64, y []V, max int64) V {
-	r, offset, yg := groupByPrepare[V](x, max)
+func groupByInt64sVs(ctx *Context, x []int64, y []V, max int64) V {
+	r, offset, yg := groupByPrepare[V](ctx, x, max)
 	count := 0
 	for i, n := range offset {
+		ctx.pollInterrupt(i)
 		offset[i] = count
 		r[i] = NewV(&AV{elts: yg[count : count+n], flags: flagImmutable})
 		count += n
 	}
-	groupByScatter[V](x, y, yg, offset)
+	groupByScatter[V](ctx, x, y, yg, offset)
 	for i, ri := range r {
 		r[i] = canonicalImmut(ri)
 	}
 	return newAVu(r)
 }
 
-func groupByPrepare[T any](x []int64, max int64) ([]V, []int, []T) {
+func groupByPrepare[T any](ctx *Context, x []int64, max int64) ([]V, []int, []T) {
 	r := make([]V, max+1)
 	offset := make([]int, max+1)
 	count := 0
-	for _, xi := range x {
+	for i, xi := range x {
+		ctx.pollInterrupt(i)
 		if xi < 0 {
 			continue
 		}
@@ -400,8 +409,9 @@ func groupByPrepare[T any](x []int64, max int64) ([]V, []int, []T) {
 	return r, offset, yg
 }
 
-func groupByScatter[T any](x []int64, y []T, yg []T, offset []int) {
+func groupByScatter[T any](ctx *Context, x []int64, y []T, yg []T, offset []int) {
 	for i, xi := range x {
+		ctx.pollInterrupt(i)
 		if xi < 0 {
 			continue
 		}
@@ -411,7 +421,7 @@ func groupByScatter[T any](x []int64, y []T, yg []T, offset []int) {
 	}
 }
 
-func groupBySorted[I integer](x []I, y Array, max int64) V {
+func groupBySorted[I integer](ctx *Context, x []I, y Array, max int64) V {
 	r := make([]V, max+1)
 	var from, i0 int
 	var n int64
@@ -425,6 +435,7 @@ func groupBySorted[I integer](x []I, y Array, max int64) V {
 	var p V
 	y.MarkImmutable()
 	for i, xi := range x[i0:] {
+		ctx.pollInterrupt(i)
 		if int64(xi) == n {
 			continue
 		}
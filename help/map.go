@@ -0,0 +1,80 @@
+// Package help provides the help text of the goal command, indexed by topic
+// and builtin name.
+package help
+
+import (
+	"bufio"
+	"strings"
+)
+
+// Map returns the help strings by topic or builtin name, as used by the goal
+// command's repl. The empty topic gives an overview of the other topics.
+func Map() map[string]string {
+	help := map[string]string{}
+	help[""] = helpTopics
+	help["s"] = helpSyntax
+	help["t"] = helpTypes
+	help["v"] = helpVerbs
+	help["nv"] = helpNamedVerbs
+	help["a"] = helpAdverbs
+	help["io"] = helpIO
+	help["tm"] = helpTime
+	help["time"] = helpTime // for the builtin name
+	help["rt"] = helpRuntime
+	const vcols = 4
+	const scols = 12
+	const acols = 5
+	const nvcols = 10
+	help[":"] = getBuiltin(helpSyntax, "assign", scols) + getBuiltin(helpVerbs, ":", vcols)
+	help["::"] = getBuiltin(helpSyntax, "assign", scols) + getBuiltin(helpVerbs, "::", vcols)
+	help["»"] = getBuiltin(helpVerbs, "»", vcols)
+	help["rshift"] = getBuiltin(helpVerbs, "»", vcols)
+	help["«"] = getBuiltin(helpVerbs, "«", vcols)
+	help["shift"] = getBuiltin(helpVerbs, "«", vcols)
+	for _, v := range []string{"+", "-", "*", "%", "!", "&", "|", "<", ">", "=", "~", ",", "^", "#", "_", "$", "?", "@", "."} {
+		help[v] = getBuiltin(helpVerbs, v, vcols)
+	}
+	for _, v := range []string{"'", "/", "\\"} {
+		help[v] = getBuiltin(helpAdverbs, v, acols)
+	}
+	help["rx"] = getBuiltin(helpSyntax, "regexp", scols) + getBuiltin(helpNamedVerbs, "rx", nvcols)
+	for _, v := range []string{"abs", "bytes", "uc", "error", "eval", "export", "firsts", "json", "ocount", "panic", "sign", "csv", "in", "mod", "nan", "rotate", "sub"} {
+		help[v] = getBuiltin(helpNamedVerbs, v, nvcols)
+	}
+	help["¿"] = getBuiltin(helpNamedVerbs, "firsts", nvcols) + getBuiltin(helpNamedVerbs, "in", nvcols)
+	for _, v := range []string{"chdir", "close", "env", "flush", "import", "open", "print", "read", "run", "say", "shell", "ARGS", "STDIN", "STDOUT", "STDERR"} {
+		help[v] = getBuiltin(helpIO, v, nvcols)
+	}
+	for _, v := range []string{"rt.vars", "rt.prec", "rt.prof", "rt.seed", "rt.time"} {
+		help[v] = getBuiltin(helpRuntime, v, nvcols)
+	}
+	help["qq"] = getBuiltin(helpSyntax, "strings", scols)
+	help["rq"] = getBuiltin(helpSyntax, "raw strings", scols)
+	return help
+}
+
+func getBuiltin(s string, v string, n int) string {
+	var sb strings.Builder
+	r := strings.NewReader(s)
+	sc := bufio.NewScanner(r)
+	match := false
+	blanks := strings.Repeat(" ", n)
+	for sc.Scan() {
+		ln := sc.Text()
+		if len(ln) < n {
+			match = false
+			continue
+		}
+		if strings.Contains(ln[:n], v) || ln[:n] == blanks && match {
+			// NOTE: currently no builtin name is a substring of
+			// another. Otherwise, this could match more names than
+			// wanted.
+			match = true
+			sb.WriteString(ln)
+			sb.WriteByte('\n')
+			continue
+		}
+		match = false
+	}
+	return sb.String()
+}
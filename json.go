@@ -5,26 +5,29 @@ import (
 	"strings"
 )
 
-func fJSON(x V) V {
+func fJSON(ctx *Context, x V) V {
 	switch xv := x.bv.(type) {
 	case S:
-		return jsonStringToGoal(string(xv))
+		return jsonStringToGoal(ctx, string(xv))
 	case *AS:
 		r := make([]V, xv.Len())
 		for i, xi := range xv.elts {
-			ri := jsonStringToGoal(xi)
+			ri := jsonStringToGoal(ctx, xi)
+			if ri.IsPanic() {
+				return ri
+			}
 			ri.MarkImmutable()
 			r[i] = ri
 		}
 		return canonicalVs(r)
 	case *AV:
-		return mapAV(xv, fJSON)
+		return mapAV(xv, func(xi V) V { return fJSON(ctx, xi) })
 	default:
 		return panicType("json x", "x", x)
 	}
 }
 
-func jsonStringToGoal(s string) V {
+func jsonStringToGoal(ctx *Context, s string) V {
 	sr := strings.NewReader(s)
 	dec := json.NewDecoder(sr)
 	var v any
@@ -32,9 +35,33 @@ func jsonStringToGoal(s string) V {
 	if err != nil {
 		return Errorf("%v", err)
 	}
+	if ctx.usage != nil {
+		if err := ctx.allocN(jsonSize(v)); err != nil {
+			return Panicf("json x : %v", err)
+		}
+	}
 	return jsonToGoal(v)
 }
 
+// jsonSize returns the number of elements of the arrays and objects in a
+// decoded JSON value.
+func jsonSize(v any) int64 {
+	var n int64
+	switch vv := v.(type) {
+	case []any:
+		n = int64(len(vv))
+		for _, vi := range vv {
+			n += jsonSize(vi)
+		}
+	case map[string]any:
+		n = 2 * int64(len(vv))
+		for _, vi := range vv {
+			n += jsonSize(vi)
+		}
+	}
+	return n
+}
+
 func jsonToGoal(v any) V {
 	switch vv := v.(type) {
 	case bool:
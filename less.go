@@ -281,6 +281,18 @@ func (xv *projectionFirst) LessT(y BV) bool {
 	}
 }
 
+func (xv *closure) LessT(y BV) bool {
+	switch yv := y.(type) {
+	case *closure:
+		return xv.Fun < yv.Fun ||
+			xv.Fun == yv.Fun && newAVu(xv.Env).LessT(newAVu(yv.Env))
+	case function:
+		return xv.stype() < yv.stype()
+	default:
+		return xv.Type() < y.Type()
+	}
+}
+
 func (xv *projectionMonad) LessT(y BV) bool {
 	switch yv := y.(type) {
 	case *projectionMonad:
@@ -0,0 +1,245 @@
+package goal
+
+import (
+	"fmt"
+	"math"
+)
+
+// Limits describes resource limits for code evaluation, useful when running
+// code from semi-trusted sources. A zero value for a field means no limit.
+// Instruction and allocation counts are reset at the start of each top-level
+// Run.
+type Limits struct {
+	MaxOps       int64 // maximum number of executed instructions
+	MaxArrayLen  int64 // maximum number of elements of a single array allocation
+	MaxAlloc     int64 // maximum total number of allocated elements (estimate)
+	MaxCallDepth int   // maximum lambda call depth (default: 100000)
+}
+
+// usage represents resource usage of a context with limits. It is shared
+// with derived contexts.
+type usage struct {
+	limits Limits
+	ops    int64 // number of executed instructions
+	alloc  int64 // total number of allocated elements
+	runs   int   // number of nested runs
+}
+
+// SetLimits sets resource limits for the context. Limits are shared with
+// contexts derived during evaluation, like for eval or import.
+func (ctx *Context) SetLimits(l Limits) {
+	ctx.callDepthMax = maxCallDepth
+	if l.MaxCallDepth > 0 {
+		ctx.callDepthMax = int32(l.MaxCallDepth)
+	}
+	if l.MaxOps <= 0 && l.MaxArrayLen <= 0 && l.MaxAlloc <= 0 {
+		ctx.usage = nil
+		return
+	}
+	ctx.usage = &usage{limits: l}
+}
+
+// startRun resets usage counters if this is not a nested run.
+func (u *usage) startRun() {
+	if u.runs == 0 {
+		u.ops = 0
+		u.alloc = 0
+	}
+	u.runs++
+}
+
+func (u *usage) endRun() {
+	u.runs--
+}
+
+// step records the execution of an instruction, and returns an error if the
+// maximum number of instructions has been exceeded.
+func (u *usage) step() error {
+	u.ops++
+	if u.limits.MaxOps > 0 && u.ops > u.limits.MaxOps {
+		return fmt.Errorf("exceeded maximum number of instructions (%d)", u.limits.MaxOps)
+	}
+	return nil
+}
+
+// allocN records the allocation of an array of n elements, and returns an
+// error if doing so would exceed the context's limits.
+func (ctx *Context) allocN(n int64) error {
+	u := ctx.usage
+	if u == nil {
+		return nil
+	}
+	if n < 0 {
+		n = -n
+	}
+	if u.limits.MaxArrayLen > 0 && n > u.limits.MaxArrayLen {
+		return fmt.Errorf("array too big (%d > %d)", n, u.limits.MaxArrayLen)
+	}
+	if u.limits.MaxAlloc > 0 {
+		if n > u.limits.MaxAlloc-u.alloc {
+			return fmt.Errorf("exceeded maximum allocation (%d)", u.limits.MaxAlloc)
+		}
+		u.alloc += n
+	}
+	return nil
+}
+
+// allocJoin records the allocation for x,y. The length of the result is
+// checked against MaxArrayLen, but only the elements of y count toward
+// MaxAlloc, because x's storage is often reused.
+func (ctx *Context) allocJoin(x, y V) error {
+	u := ctx.usage
+	if u == nil {
+		return nil
+	}
+	n := int64(x.Len()) + int64(y.Len())
+	if u.limits.MaxArrayLen > 0 && n > u.limits.MaxArrayLen {
+		return fmt.Errorf("array too big (%d > %d)", n, u.limits.MaxArrayLen)
+	}
+	return ctx.allocN(int64(y.Len()))
+}
+
+// allocRepeat records the allocation for the string repeat x*y, where one of
+// x and y is a count (or count array), and the other a string (or string
+// array). It returns nil for other kinds of arguments.
+func (ctx *Context) allocRepeat(x, y V) error {
+	if ctx.usage == nil {
+		return nil
+	}
+	size, maxLen, ok := stringsSize(y)
+	if !ok {
+		x, y = y, x
+		size, maxLen, ok = stringsSize(y)
+		if !ok {
+			return nil
+		}
+	}
+	if x.IsI() || x.IsF() {
+		var n float64
+		if x.IsI() {
+			n = float64(x.I())
+		} else {
+			n = x.F()
+		}
+		if n <= 0 {
+			return nil
+		}
+		return ctx.allocN(mulSat(int64(math.Min(n, math.MaxInt64)), size))
+	}
+	total, ok := countsSum(x)
+	if !ok {
+		return nil
+	}
+	return ctx.allocN(mulSat(total, maxLen))
+}
+
+// allocCounts records the allocation for a result whose length is the sum of
+// the counts in x, like for &x or f#y. It returns nil if x is not a count or
+// numeric array.
+func (ctx *Context) allocCounts(x V) error {
+	if ctx.usage == nil {
+		return nil
+	}
+	var n int64
+	switch {
+	case x.IsI():
+		n = x.I()
+	case x.IsF():
+		n = int64(math.Max(math.Min(x.F(), math.MaxInt64), 0))
+	default:
+		var ok bool
+		n, ok = countsSum(x)
+		if !ok {
+			return nil
+		}
+	}
+	if n <= 0 {
+		return nil
+	}
+	return ctx.allocN(n)
+}
+
+// countsSum returns the sum of the positive counts in numeric array x,
+// saturated at math.MaxInt64.
+func countsSum(x V) (int64, bool) {
+	var total int64
+	switch xv := x.bv.(type) {
+	case *AB:
+		for _, xi := range xv.elts {
+			total += int64(xi)
+		}
+	case *AI:
+		for _, xi := range xv.elts {
+			if xi > 0 {
+				total = addSat(total, xi)
+			}
+		}
+	case *AF:
+		for _, xi := range xv.elts {
+			if xi > 0 {
+				total = addSat(total, int64(math.Min(xi, math.MaxInt64)))
+			}
+		}
+	default:
+		return 0, false
+	}
+	return total, true
+}
+
+// allocPad records the allocation for the string pad i!y, where y is a string
+// or string array.
+func (ctx *Context) allocPad(n int64, y V) error {
+	if ctx.usage == nil {
+		return nil
+	}
+	switch yv := y.bv.(type) {
+	case S:
+		return ctx.allocN(n)
+	case *AS:
+		return ctx.allocN(mulSat(n, int64(yv.Len())))
+	default:
+		return nil
+	}
+}
+
+// stringsSize returns the total size and maximum length of the strings in x,
+// which should be a string or string array.
+func stringsSize(x V) (size, maxLen int64, ok bool) {
+	switch xv := x.bv.(type) {
+	case S:
+		return int64(len(xv)), int64(len(xv)), true
+	case *AS:
+		for _, xi := range xv.elts {
+			size += int64(len(xi))
+			if int64(len(xi)) > maxLen {
+				maxLen = int64(len(xi))
+			}
+		}
+		return size, maxLen, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// mulSat returns the product of the absolute values of x and y, saturated at
+// math.MaxInt64.
+func mulSat(x, y int64) int64 {
+	if x < 0 {
+		x = -x
+	}
+	if y < 0 {
+		y = -y
+	}
+	if x < 0 || y < 0 || y != 0 && x > math.MaxInt64/y {
+		return math.MaxInt64
+	}
+	return x * y
+}
+
+// addSat returns x+y for non-negative x and y, saturated at math.MaxInt64.
+func addSat(x, y int64) int64 {
+	if x > math.MaxInt64-y {
+		return math.MaxInt64
+	}
+	return x + y
+}
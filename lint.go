@@ -0,0 +1,332 @@
+package goal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintIssue represents a problem found by Lint.
+type LintIssue struct {
+	Filename string // file name (as given to Lint)
+	Pos      int    // byte offset in the source
+	Line     int    // line number (starting from 1)
+	Column   int    // column number (starting from 1)
+	Msg      string // description of the problem
+}
+
+// String returns a description of the issue with its location.
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", li.Filename, li.Line, li.Column, li.Msg)
+}
+
+// Lint compiles the source s without running it, and reports problems found
+// by static analysis, sorted by position: globals read but never assigned
+// (nor already defined in the context), locals assigned but never used,
+// locals shadowing globals or locals of enclosing lambdas, calls to lambdas
+// with too many arguments, and
+// unreachable statements after a return. Globals with a dotted name, like
+// the ones defined by imported packages, are assumed to be defined. The
+// context is not modified. Lint returns an error if s cannot be compiled.
+func (ctx *Context) Lint(loc, s string) ([]LintIssue, error) {
+	src := blankShebang(s)
+	lctx := ctx.lintContext()
+	llen := len(lctx.lambdas)
+	if err := lctx.Compile(loc, src); err != nil {
+		return nil, err
+	}
+	l := &linter{ctx: ctx, lctx: lctx, lambdas: lctx.lambdas[llen:], lambdaExprs: map[int]*LambdaExpr{}}
+	// Compile trims the source: code positions are relative to the
+	// trimmed source.
+	l.lead = len(src) - len(strings.TrimLeft(src, " \n"))
+	f, err := ctx.Parse(loc, s)
+	if err == nil {
+		Inspect(f, func(n Node) bool {
+			if lambda, ok := n.(*LambdaExpr); ok {
+				l.lambdaExprs[lambda.Lbrace] = lambda
+			}
+			return true
+		})
+	}
+	l.globals()
+	l.locals()
+	l.calls()
+	if err == nil {
+		l.unreachable(f.Body)
+	}
+	issues := l.issues
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Pos < issues[j].Pos })
+	for i := range issues {
+		li := &issues[i]
+		li.Filename = loc
+		_, li.Line, li.Column = getPosLine(src, li.Pos)
+		li.Column++
+	}
+	return issues, nil
+}
+
+// lintContext returns a scratch context for compiling code without modifying
+// ctx.
+func (ctx *Context) lintContext() *Context {
+	nctx := ctx.derive()
+	nctx.constants = ctx.constants[:len(ctx.constants):len(ctx.constants)]
+	nctx.sconstants = make(map[string]int, len(ctx.sconstants))
+	for k, v := range ctx.sconstants {
+		nctx.sconstants[k] = v
+	}
+	nctx.lambdas = ctx.lambdas[:len(ctx.lambdas):len(ctx.lambdas)]
+	nctx.globals = ctx.globals[:len(ctx.globals):len(ctx.globals)]
+	nctx.gNames = ctx.gNames[:len(ctx.gNames):len(ctx.gNames)]
+	nctx.gIDs = make(map[string]int, len(ctx.gIDs))
+	for k, v := range ctx.gIDs {
+		nctx.gIDs[k] = v
+	}
+	nctx.sources = map[string]string{}
+	return nctx
+}
+
+// linter represents the state of a Lint analysis.
+type linter struct {
+	ctx         *Context            // linted context
+	lctx        *Context            // scratch context with compiled code
+	lead        int                 // offset of compiled code positions
+	lambdas     []*lambdaCode       // compiled lambdas
+	lambdaExprs map[int]*LambdaExpr // lambda syntax trees by { position
+	assigned    map[int]int         // global id -> number of assignments
+	issues      []LintIssue
+}
+
+// report adds an issue at the given position in the compiled code.
+func (l *linter) report(pos int, format string, a ...interface{}) {
+	l.reportAt(pos+l.lead, format, a...)
+}
+
+// reportAt adds an issue at the given position in the source.
+func (l *linter) reportAt(pos int, format string, a ...interface{}) {
+	l.issues = append(l.issues, LintIssue{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+}
+
+// localPos returns the source position of the first assignment to the local
+// name in the lambda, or the lambda's position if not found.
+func (l *linter) localPos(lc *lambdaCode, name string) int {
+	pos := lc.StartPos + l.lead
+	lambda, ok := l.lambdaExprs[pos]
+	if !ok {
+		return pos
+	}
+	found := false
+	for _, es := range lambda.Body {
+		Inspect(es, func(n Node) bool {
+			if found {
+				return false
+			}
+			switch n := n.(type) {
+			case *LambdaExpr:
+				return false
+			case *AssignExpr:
+				found = !n.Global && n.Name == name
+				pos = n.NamePos
+			case *ListAssignExpr:
+				for _, s := range n.Names {
+					found = found || !n.Global && s == name
+				}
+				pos = n.Lparen
+			}
+			return !found
+		})
+		if found {
+			return pos
+		}
+	}
+	return lc.StartPos + l.lead
+}
+
+// code calls f for each opcode of the compiled global code and lambdas, with
+// the index of the opcode in its body.
+func (l *linter) code(f func(body []opcode, pos []int, ip int, lc *lambdaCode)) {
+	walk := func(body []opcode, pos []int, lc *lambdaCode) {
+		for ip := 0; ip < len(body); ip += 1 + body[ip].argc() {
+			f(body, pos, ip, lc)
+		}
+	}
+	walk(l.lctx.gCode.Body, l.lctx.gCode.Pos, nil)
+	for _, lc := range l.lambdas {
+		walk(lc.Body, lc.Pos, lc)
+	}
+}
+
+// defined reports whether global id was defined before compilation.
+func (l *linter) defined(id int) bool {
+	return id < len(l.ctx.globals) && l.ctx.globals[id].kind != valNil
+}
+
+// globals reports globals read but never assigned.
+func (l *linter) globals() {
+	l.assigned = map[int]int{}
+	read := map[int]int{} // global id -> position of first read
+	var ids []int
+	l.code(func(body []opcode, pos []int, ip int, lc *lambdaCode) {
+		switch body[ip] {
+		case opGlobal, opGlobalLast, opApplyGlobal, opApplyNGlobal, opTailApplyGlobal, opTailApplyNGlobal:
+			id := int(body[ip+1])
+			if _, ok := read[id]; !ok {
+				read[id] = pos[ip]
+				ids = append(ids, id)
+			}
+		case opAssignGlobal:
+			l.assigned[int(body[ip+1])]++
+		case opListAssignGlobal:
+			for _, id := range l.lctx.gAssignLists[body[ip+1]] {
+				l.assigned[id]++
+			}
+		}
+	})
+	for _, id := range ids {
+		name := l.lctx.gNames[id]
+		if l.assigned[id] > 0 || l.defined(id) || strings.ContainsRune(name, '.') {
+			continue
+		}
+		l.report(read[id], "global %s read but never assigned", name)
+	}
+}
+
+// locals reports locals assigned but never used, and locals shadowing
+// globals or locals of enclosing lambdas. Variables capturing locals of
+// enclosing lambdas are not reported: a local read only by nested lambdas
+// is used.
+func (l *linter) locals() {
+	parent := map[*lambdaCode]*lambdaCode{}
+	l.code(func(body []opcode, pos []int, ip int, lc *lambdaCode) {
+		if lc != nil && (body[ip] == opLambda || body[ip] == opClosure) {
+			parent[l.lctx.lambdas[body[ip+1]]] = lc
+		}
+	})
+	for _, lc := range l.lambdas {
+		captured := map[int32]bool{}
+		for _, id := range lc.Captures {
+			captured[id] = true
+		}
+		read := make([]bool, len(lc.Names))
+		assign := make([]bool, len(lc.Names))
+		for ip := 0; ip < len(lc.Body); ip += 1 + lc.Body[ip].argc() {
+			switch lc.Body[ip] {
+			case opLocal, opLocalLast:
+				read[lc.Body[ip+1]] = true
+			case opAssignLocal:
+				assign[lc.Body[ip+1]] = true
+			case opListAssignLocal:
+				for _, i := range lc.AssignLists[lc.Body[ip+1]] {
+					assign[i] = true
+				}
+			}
+		}
+		for i, name := range lc.Names {
+			isVar := i < lc.nVars
+			if captured[int32(i)] {
+				continue
+			}
+			if isVar && assign[i] && !read[i] {
+				l.reportAt(l.localPos(lc, name), "local %s assigned but never used", name)
+			}
+			if name == "" || !isVar && !lc.namedArgs {
+				continue
+			}
+			pos := lc.StartPos + l.lead
+			if isVar {
+				pos = l.localPos(lc, name)
+			}
+			if id, ok := l.lctx.gIDs[name]; ok && (l.assigned[id] > 0 || l.defined(id)) {
+				l.reportAt(pos, "local %s shadows global", name)
+			}
+			for p := parent[lc]; p != nil; p = parent[p] {
+				if hasName(p.Names, name) {
+					l.reportAt(pos, "local %s shadows local of enclosing lambda", name)
+					break
+				}
+			}
+		}
+	}
+}
+
+func hasName(names []string, name string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// calls reports calls to lambdas with too many arguments, for lambda literals
+// and globals assigned only once to a lambda.
+func (l *linter) calls() {
+	rank := map[int]int{} // global id -> rank of assigned lambda
+	l.code(func(body []opcode, pos []int, ip int, lc *lambdaCode) {
+		if body[ip] == opAssignGlobal && ip >= 2 && body[ip-2] == opLambda {
+			id := int(body[ip+1])
+			if l.assigned[id] == 1 {
+				rank[id] = l.lctx.lambdas[body[ip-1]].Rank
+			}
+		}
+	})
+	check := func(name string, r, n, pos int) {
+		if n > r {
+			l.report(pos, "too many arguments in call to %s: got %d, expected %d", name, n, r)
+		}
+	}
+	l.code(func(body []opcode, pos []int, ip int, lc *lambdaCode) {
+		switch body[ip] {
+		case opApplyGlobal, opApplyNGlobal, opTailApplyGlobal, opTailApplyNGlobal:
+			id := int(body[ip+1])
+			if r, ok := rank[id]; ok {
+				n := 1
+				if body[ip] == opApplyNGlobal || body[ip] == opTailApplyNGlobal {
+					n = int(body[ip+2])
+				}
+				check(l.lctx.gNames[id], r, n, pos[ip])
+			}
+		case opLambda, opClosure:
+			next := ip + 2
+			if next >= len(body) {
+				break
+			}
+			lambda := l.lctx.lambdas[body[ip+1]]
+			switch body[next] {
+			case opApply, opTailApply:
+				check("lambda", lambda.Rank, 1, lambda.StartPos)
+			case opApply2, opTailApply2:
+				check("lambda", lambda.Rank, 2, lambda.StartPos)
+			case opApplyN, opTailApplyN:
+				check("lambda", lambda.Rank, int(body[next+1]), lambda.StartPos)
+			}
+		}
+	})
+}
+
+// unreachable reports statements following a return statement, in the
+// given statements and lambda bodies within.
+func (l *linter) unreachable(body []*Exprs) {
+	for i, es := range body {
+		if i+1 >= len(body) || len(es.List) == 0 {
+			continue
+		}
+		if r, ok := es.List[0].(*ReturnExpr); ok && !r.OnError {
+			for _, next := range body[i+1:] {
+				if len(next.List) > 0 {
+					l.reportAt(next.Pos(), "unreachable code")
+					break
+				}
+			}
+			break
+		}
+	}
+	for _, es := range body {
+		Inspect(es, func(n Node) bool {
+			if lambda, ok := n.(*LambdaExpr); ok {
+				l.unreachable(lambda.Body)
+				return false
+			}
+			return true
+		})
+	}
+}
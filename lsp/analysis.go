@@ -0,0 +1,546 @@
+package lsp
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"codeberg.org/anaseto/goal"
+)
+
+// analysis represents the result of analyzing a document.
+type analysis struct {
+	srv     *server
+	doc     *document
+	path    string // file path of the document ("" if not a file URI)
+	ctx     *goal.Context
+	names   map[string]goal.IdentType // keywords
+	globals map[string]goal.Node      // global definitions by name
+	imports []importDecl
+}
+
+// importDecl represents a package import found in a document.
+type importDecl struct {
+	name    string   // name of the imported package, as written
+	prefix  string   // prefix of the package globals
+	aliases []string // globals assigned in the current namespace
+	path    string   // file path of the package ("" if not found)
+}
+
+// analyze parses a document and collects its globals and imports.
+func (srv *server) analyze(doc *document) *analysis {
+	a := &analysis{srv: srv, doc: doc, ctx: srv.cfg.NewContext()}
+	a.path = uriPath(doc.uri)
+	a.names = map[string]goal.IdentType{}
+	for _, name := range a.ctx.Keywords() {
+		a.names[name] = goal.IdentDyad
+	}
+	f, _ := a.ctx.Parse(a.loc(), doc.text)
+	a.globals, a.imports = collect(f)
+	for i := range a.imports {
+		a.imports[i].path = a.resolve(a.imports[i].name)
+	}
+	return a
+}
+
+// loc returns the location used for the document in error messages.
+func (a *analysis) loc() string {
+	if a.path != "" {
+		return a.path
+	}
+	return a.doc.uri
+}
+
+// collect returns the global definitions and package imports in a syntax
+// tree.
+func collect(f *goal.File) (map[string]goal.Node, []importDecl) {
+	globals := map[string]goal.Node{}
+	var imports []importDecl
+	if f == nil {
+		return globals, nil
+	}
+	define := func(name string, n goal.Node) {
+		if _, ok := globals[name]; !ok {
+			globals[name] = n
+		}
+	}
+	var stack []goal.Node
+	depth := 0 // lambda depth
+	goal.Inspect(f, func(n goal.Node) bool {
+		if n == nil {
+			if _, ok := stack[len(stack)-1].(*goal.LambdaExpr); ok {
+				depth--
+			}
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		stack = append(stack, n)
+		switch n := n.(type) {
+		case *goal.LambdaExpr:
+			depth++
+		case *goal.AssignExpr:
+			if depth == 0 || n.Global {
+				define(n.Name, n)
+			}
+		case *goal.ListAssignExpr:
+			if depth == 0 || n.Global {
+				for _, name := range n.Names {
+					define(name, n)
+				}
+			}
+		case *goal.Exprs:
+			for i := 0; i+1 < len(n.List); i++ {
+				if isImport(n.List[i]) {
+					imports = appendImports(imports, nil, n.List[i+1])
+				}
+			}
+		case *goal.CallExpr:
+			if isImport(n.Fun) {
+				switch len(n.Args) {
+				case 1:
+					imports = appendImports(imports, nil, n.Args[0])
+				case 2:
+					imports = appendImports(imports, n.Args[0], n.Args[1])
+				}
+			}
+		case *goal.BinaryExpr:
+			if isImport(n.Verb) {
+				imports = appendImports(imports, n.Left, n.Right)
+			}
+		}
+		return true
+	})
+	return globals, imports
+}
+
+func isImport(e goal.Expr) bool {
+	v, ok := e.(*goal.Verb)
+	return ok && v.Name == "import"
+}
+
+// appendImports appends the imports of constant string names, with the
+// given left argument, if any.
+func appendImports(imports []importDecl, x, s goal.Expr) []importDecl {
+	names, ok := constStrings(s)
+	if !ok {
+		return imports
+	}
+	var prefix *string
+	var aliases []string
+	if x != nil {
+		l, ok := constStrings(x)
+		if !ok {
+			return imports
+		}
+		if _, single := unwrap(x).(*goal.Lit); single {
+			prefix = &l[0]
+		} else {
+			aliases = l
+		}
+	}
+	for _, name := range names {
+		im := importDecl{name: name, aliases: aliases}
+		if prefix != nil {
+			im.prefix = *prefix
+		} else {
+			im.prefix = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		}
+		imports = append(imports, im)
+	}
+	return imports
+}
+
+// unwrap returns the only expression in e, if e is a one-element *Exprs.
+func unwrap(e goal.Expr) goal.Expr {
+	for {
+		es, ok := e.(*goal.Exprs)
+		if !ok || len(es.List) != 1 {
+			return e
+		}
+		e = es.List[0]
+	}
+}
+
+// constStrings returns the values of e, if it is a constant string, or a
+// strand or list of constant strings.
+func constStrings(e goal.Expr) ([]string, bool) {
+	switch e := unwrap(e).(type) {
+	case *goal.Lit:
+		s, ok := unquote(e)
+		return []string{s}, ok
+	case *goal.Strand:
+		r := make([]string, 0, len(e.Items))
+		for _, item := range e.Items {
+			l, ok := constStrings(item)
+			if !ok || len(l) != 1 {
+				return nil, false
+			}
+			r = append(r, l[0])
+		}
+		return r, true
+	case *goal.ListExpr:
+		r := make([]string, 0, len(e.Items))
+		for _, item := range e.Items {
+			l, ok := constStrings(item)
+			if !ok || len(l) != 1 {
+				return nil, false
+			}
+			r = append(r, l[0])
+		}
+		return r, true
+	default:
+		return nil, false
+	}
+}
+
+// unquote returns the value of a string literal.
+func unquote(l *goal.Lit) (string, bool) {
+	if l.Kind != goal.STRING || len(l.Value) < 2 {
+		return "", false
+	}
+	switch {
+	case strings.HasPrefix(l.Value, "rq") && len(l.Value) >= 4:
+		return l.Value[3 : len(l.Value)-1], true
+	case strings.HasPrefix(l.Value, "qq"):
+		return "", false
+	}
+	s, err := strconv.Unquote(l.Value)
+	return s, err == nil
+}
+
+// resolve returns the path of the file imported by name, searched in the
+// document's directory, the current directory, and the GOALLIB directories,
+// or the empty string.
+func (a *analysis) resolve(name string) string {
+	fname := name
+	if filepath.Ext(fname) == "" {
+		fname += ".goal"
+	}
+	var dirs []string
+	if filepath.IsAbs(fname) {
+		dirs = []string{""}
+	} else {
+		if a.path != "" {
+			dirs = append(dirs, filepath.Dir(a.path))
+		}
+		dirs = append(dirs, ".")
+		if goalLIB, ok := os.LookupEnv("GOALLIB"); ok {
+			sep := ":"
+			if runtime.GOOS == "windows" {
+				sep = ";"
+			}
+			dirs = append(dirs, strings.Split(goalLIB, sep)...)
+		}
+	}
+	for _, dir := range dirs {
+		fpath := filepath.Join(dir, fname)
+		fi, err := os.Stat(fpath)
+		if err == nil && fi.Mode().IsRegular() {
+			if p, err := filepath.Abs(fpath); err == nil {
+				fpath = p
+			}
+			return fpath
+		}
+	}
+	return ""
+}
+
+// source returns the source of the file at path, using the text of the
+// corresponding open document, if any.
+func (srv *server) source(path string) (string, bool) {
+	if doc, ok := srv.docs[pathURI(path)]; ok {
+		return doc.text, true
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err == nil
+}
+
+// uriPath returns the file path of a file URI, or the empty string.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" {
+		p = strings.TrimPrefix(p, "/")
+	}
+	return filepath.FromSlash(p)
+}
+
+// pathURI returns the file URI of a path.
+func pathURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// blankShebang replaces a starting #! line with spaces.
+func blankShebang(src string) string {
+	if !strings.HasPrefix(src, "#!") {
+		return src
+	}
+	i := strings.IndexByte(src, '\n')
+	if i < 0 {
+		i = len(src)
+	}
+	return strings.Repeat(" ", i) + src[i:]
+}
+
+// diagnostics returns the compilation errors of the document, or the
+// problems reported by Context.Lint as warnings.
+func (a *analysis) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	src := blankShebang(a.doc.text)
+	issues, err := a.ctx.Lint(a.loc(), src)
+	if err == nil {
+		for _, li := range issues {
+			end := li.Pos
+			if tok, ok := a.tokenAt(li.Pos); ok {
+				end = tok.End
+			}
+			diags = append(diags, Diagnostic{
+				Range:    Range{Start: position(a.doc.text, li.Pos), End: position(a.doc.text, end)},
+				Severity: severityWarning,
+				Source:   "goal vet",
+				Message:  li.Msg,
+			})
+		}
+		return diags
+	}
+	d := Diagnostic{Severity: severityError, Source: "goal", Message: err.Error()}
+	if e, ok := err.(*goal.PanicError); ok {
+		d.Message = e.Msg
+		if len(e.Frames) > 0 && e.Frames[0].Line > 0 {
+			// Compilation trims the source: lines and columns are
+			// relative to the trimmed source.
+			fr := e.Frames[0]
+			lead := src[:len(src)-len(strings.TrimLeft(src, " \n"))]
+			line := fr.Line - 1 + strings.Count(lead, "\n")
+			col := fr.Column - 1
+			if fr.Line == 1 {
+				col += len(lead) - strings.LastIndexByte(lead, '\n') - 1
+			}
+			off := lineOffset(src, line) + col
+			end := off
+			if tok, ok := a.tokenAt(off); ok {
+				end = tok.End
+			}
+			d.Range = Range{Start: position(a.doc.text, off), End: position(a.doc.text, end)}
+		}
+	}
+	return append(diags, d)
+}
+
+// lineOffset returns the byte offset of the start of the given zero-based
+// line in text.
+func lineOffset(text string, line int) int {
+	i := 0
+	for ; line > 0; line-- {
+		j := strings.IndexByte(text[i:], '\n')
+		if j < 0 {
+			return len(text)
+		}
+		i += j + 1
+	}
+	return i
+}
+
+// tokenAt returns the token at byte offset off, or ending at off.
+func (a *analysis) tokenAt(off int) (goal.Token, bool) {
+	s := goal.NewScanner(a.names, blankShebang(a.doc.text))
+	var last goal.Token
+	found := false
+	for {
+		tok := s.Next()
+		switch {
+		case tok.Type == goal.EOF || tok.Type == goal.ERROR || tok.Pos > off:
+			return last, found
+		case tok.Type == goal.NEWLINE:
+		case tok.Pos <= off && off < tok.End:
+			return tok, true
+		case tok.End == off:
+			last, found = tok, true
+		}
+	}
+}
+
+// hover returns the help for the builtin or global at byte offset off.
+func (a *analysis) hover(off int) *Hover {
+	tok, ok := a.tokenAt(off)
+	if !ok {
+		return nil
+	}
+	key := tok.Text
+	switch tok.Type {
+	case goal.IDENT, goal.MONAD, goal.DYAD, goal.ADVERB, goal.SADVERB:
+	case goal.DYADASSIGN:
+		if key != "::" {
+			key = strings.TrimSuffix(key, ":")
+		}
+	default:
+		return nil
+	}
+	text, ok := a.srv.help[key]
+	if !ok && tok.Type == goal.IDENT {
+		if n, ok := a.globals[key]; ok {
+			line, _, _ := strings.Cut(a.doc.text[lineOffset(a.doc.text, position(a.doc.text, n.Pos()).Line):], "\n")
+			text = strings.TrimSpace(line)
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	r := Range{Start: position(a.doc.text, tok.Pos), End: position(a.doc.text, tok.End)}
+	return &Hover{Contents: markupContent{Kind: "plaintext", Value: strings.TrimSpace(text)}, Range: &r}
+}
+
+// complete returns the builtins, keywords and globals starting with the
+// name before byte offset off.
+func (a *analysis) complete(off int) []CompletionItem {
+	start := off
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(a.doc.text[:start])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' {
+			break
+		}
+		start -= size
+	}
+	prefix := a.doc.text[start:off]
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if seen[label] || !strings.HasPrefix(label, prefix) {
+			return
+		}
+		seen[label] = true
+		items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail,
+			Documentation: strings.TrimSpace(a.srv.help[label])})
+	}
+	for name := range a.globals {
+		add(name, kindVariable, "global")
+	}
+	for _, name := range a.ctx.GlobalNames() {
+		add(name, kindVariable, "global")
+	}
+	for _, im := range a.imports {
+		if im.path == "" {
+			continue
+		}
+		if im.prefix != "" {
+			add(im.prefix, kindModule, im.path)
+		}
+		for _, name := range im.aliases {
+			add(name, kindVariable, im.path)
+		}
+		if im.prefix != "" && !strings.HasPrefix(prefix, im.prefix+".") {
+			continue
+		}
+		for name := range a.packageGlobals(im.path) {
+			if im.prefix != "" {
+				name = im.prefix + "." + name
+			}
+			add(name, kindVariable, im.path)
+		}
+	}
+	for _, name := range a.ctx.Keywords() {
+		add(name, kindFunction, "builtin")
+	}
+	for name := range a.srv.help {
+		r, _ := utf8.DecodeRuneInString(name)
+		if unicode.IsLetter(r) {
+			add(name, kindKeyword, "builtin")
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// packageGlobals returns the global definitions in the file at path.
+func (a *analysis) packageGlobals(path string) map[string]goal.Node {
+	src, ok := a.srv.source(path)
+	if !ok {
+		return nil
+	}
+	f, _ := a.srv.cfg.NewContext().Parse(path, src)
+	globals, _ := collect(f)
+	return globals
+}
+
+// definition returns the location of the definition of the global or
+// imported package name at byte offset off.
+func (a *analysis) definition(off int) *Location {
+	tok, ok := a.tokenAt(off)
+	if !ok || tok.Type != goal.IDENT {
+		return nil
+	}
+	name := tok.Text
+	if n, ok := a.globals[name]; ok {
+		return &Location{URI: a.doc.uri, Range: a.nameRange(a.doc.text, n)}
+	}
+	for _, im := range a.imports {
+		if im.path == "" {
+			continue
+		}
+		switch {
+		case im.prefix != "" && name == im.prefix:
+			return &Location{URI: pathURI(im.path)}
+		case im.prefix != "" && strings.HasPrefix(name, im.prefix+"."):
+			if off-tok.Pos <= len(im.prefix) {
+				// on the package name
+				return &Location{URI: pathURI(im.path)}
+			}
+			return a.packageDefinition(im.path, name[len(im.prefix)+1:], true)
+		case im.prefix == "":
+			if loc := a.packageDefinition(im.path, name, false); loc != nil {
+				return loc
+			}
+		}
+		for _, alias := range im.aliases {
+			if alias == name {
+				return a.packageDefinition(im.path, name, true)
+			}
+		}
+	}
+	return nil
+}
+
+// packageDefinition returns the location of the definition of a global in
+// the package at path. If the global is not found, it returns the start of
+// the file if orFile is true, and nil otherwise.
+func (a *analysis) packageDefinition(path, name string, orFile bool) *Location {
+	src, ok := a.srv.source(path)
+	if !ok {
+		return nil
+	}
+	f, _ := a.srv.cfg.NewContext().Parse(path, src)
+	globals, _ := collect(f)
+	if n, ok := globals[name]; ok {
+		return &Location{URI: pathURI(path), Range: a.nameRange(src, n)}
+	}
+	if orFile {
+		return &Location{URI: pathURI(path)}
+	}
+	return nil
+}
+
+// nameRange returns the range of the names assigned by a global definition
+// node.
+func (a *analysis) nameRange(text string, n goal.Node) Range {
+	switch n := n.(type) {
+	case *goal.AssignExpr:
+		return Range{Start: position(text, n.NamePos), End: position(text, n.NamePos+len(n.Name))}
+	case *goal.ListAssignExpr:
+		return Range{Start: position(text, n.Lparen), End: position(text, n.Rparen+1)}
+	default:
+		return Range{Start: position(text, n.Pos()), End: position(text, n.Pos())}
+	}
+}
@@ -0,0 +1,292 @@
+// Package lsp provides a language server for goal source, speaking the
+// Language Server Protocol (LSP) as JSON-RPC messages over a stream.
+//
+// The server provides diagnostics from compilation errors and Context.Lint
+// warnings, hover documentation from help strings, completion of builtins,
+// keywords and globals, and go-to-definition for globals and imported package
+// names.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"codeberg.org/anaseto/goal"
+)
+
+// Config describes the configuration options of a language server.
+type Config struct {
+	// Help returns help strings by topic or builtin name, like
+	// help.Map. It is used for hover documentation and completion
+	// details. It may be nil.
+	Help func() map[string]string
+
+	// NewContext returns a new context with the keywords and globals of
+	// the target interpreter, used for analyzing documents. If nil,
+	// goal.NewContext is used.
+	NewContext func() *goal.Context
+}
+
+// server represents the state of a language server.
+type server struct {
+	w        io.Writer
+	cfg      Config
+	help     map[string]string
+	docs     map[string]*document // open documents by URI
+	started  bool                 // initialize request received
+	shutdown bool                 // shutdown request received
+}
+
+// document represents an open text document.
+type document struct {
+	uri     string
+	version int
+	text    string
+}
+
+// Serve runs a language server reading JSON-RPC messages from r and writing
+// responses and notifications to w. It returns when an exit notification is
+// received or at the end of input, and only returns a non-nil error if
+// reading or writing fails.
+func Serve(r io.Reader, w io.Writer, cfg Config) error {
+	if cfg.NewContext == nil {
+		cfg.NewContext = goal.NewContext
+	}
+	srv := &server{w: w, cfg: cfg, docs: map[string]*document{}}
+	if cfg.Help != nil {
+		srv.help = cfg.Help()
+	}
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		body, err := readMessage(tr)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := srv.reply(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := srv.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+// readMessage reads the body of the next message, framed by a
+// Content-Length header.
+func readMessage(tr *textproto.Reader) ([]byte, error) {
+	h, err := tr.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(h) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(h.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header: %q", h.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(tr.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write writes a framed JSON message.
+func (srv *server) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(srv.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// reply writes a response with the given result or error.
+func (srv *server) reply(id json.RawMessage, result interface{}, rerr *rpcError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = b
+	}
+	return srv.write(resp)
+}
+
+// notify writes a notification.
+func (srv *server) notify(method string, params interface{}) error {
+	return srv.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle handles a request or notification, replying to requests.
+func (srv *server) handle(req *request) error {
+	isRequest := req.ID != nil
+	if !srv.started && req.Method != "initialize" {
+		if isRequest {
+			return srv.reply(req.ID, nil, &rpcError{Code: codeServerNotStarted, Message: "server not initialized"})
+		}
+		return nil
+	}
+	if srv.shutdown && isRequest {
+		return srv.reply(req.ID, nil, &rpcError{Code: codeInvalidRequest, Message: "server is shutting down"})
+	}
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "initialize":
+		srv.started = true
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "goal-lsp"},
+		}
+	case "shutdown":
+		srv.shutdown = true
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			doc := &document{uri: p.TextDocument.URI, version: p.TextDocument.Version, text: p.TextDocument.Text}
+			srv.docs[doc.uri] = doc
+			return srv.publishDiagnostics(doc)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			doc, ok := srv.docs[p.TextDocument.URI]
+			if !ok {
+				return nil
+			}
+			for _, c := range p.ContentChanges {
+				if c.Range != nil {
+					i, j := offset(doc.text, c.Range.Start), offset(doc.text, c.Range.End)
+					doc.text = doc.text[:i] + c.Text + doc.text[j:]
+				} else {
+					doc.text = c.Text
+				}
+			}
+			doc.version = p.TextDocument.Version
+			return srv.publishDiagnostics(doc)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			delete(srv.docs, p.TextDocument.URI)
+			return srv.notify("textDocument/publishDiagnostics",
+				publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/hover", "textDocument/completion", "textDocument/definition":
+		var p textDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &p); err == nil {
+			result = srv.query(req.Method, &p)
+		}
+	default:
+		if isRequest {
+			return srv.reply(req.ID, nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method})
+		}
+		return nil
+	}
+	if !isRequest {
+		return nil
+	}
+	if err != nil {
+		return srv.reply(req.ID, nil, &rpcError{Code: codeInvalidParams, Message: err.Error()})
+	}
+	return srv.reply(req.ID, result, nil)
+}
+
+// query answers a request about a position in a document.
+func (srv *server) query(method string, p *textDocumentPositionParams) interface{} {
+	doc, ok := srv.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	a := srv.analyze(doc)
+	off := offset(doc.text, p.Position)
+	switch method {
+	case "textDocument/hover":
+		if h := a.hover(off); h != nil {
+			return h
+		}
+	case "textDocument/completion":
+		return a.complete(off)
+	case "textDocument/definition":
+		if loc := a.definition(off); loc != nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+// publishDiagnostics sends the diagnostics of a document.
+func (srv *server) publishDiagnostics(doc *document) error {
+	diags := srv.analyze(doc).diagnostics()
+	return srv.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{URI: doc.uri, Version: doc.version, Diagnostics: diags})
+}
+
+// offset returns the byte offset in text corresponding to position p.
+func offset(text string, p Position) int {
+	i := 0
+	for line := 0; line < p.Line; line++ {
+		j := strings.IndexByte(text[i:], '\n')
+		if j < 0 {
+			return len(text)
+		}
+		i += j + 1
+	}
+	col := 0
+	for j, r := range text[i:] {
+		if col >= p.Character || r == '\n' {
+			return i + j
+		}
+		col += utf16Len(r)
+	}
+	return len(text)
+}
+
+// position returns the position corresponding to byte offset off in text.
+func position(text string, off int) Position {
+	if off > len(text) {
+		off = len(text)
+	}
+	start := strings.LastIndexByte(text[:off], '\n') + 1
+	col := 0
+	for _, r := range text[start:off] {
+		col += utf16Len(r)
+	}
+	return Position{Line: strings.Count(text[:start], "\n"), Character: col}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
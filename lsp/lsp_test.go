@@ -0,0 +1,211 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"codeberg.org/anaseto/goal"
+)
+
+// script represents a scripted JSON-RPC client.
+type script struct {
+	buf bytes.Buffer
+	id  int
+}
+
+func (sc *script) request(method string, params interface{}) int {
+	sc.id++
+	sc.send(map[string]interface{}{"jsonrpc": "2.0", "id": sc.id, "method": method, "params": params})
+	return sc.id
+}
+
+func (sc *script) notify(method string, params interface{}) {
+	sc.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (sc *script) send(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&sc.buf, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// run serves the script and returns the results by request id, and the
+// notifications in order.
+func (sc *script) run(t *testing.T, cfg Config) (map[int]message, []message) {
+	var out bytes.Buffer
+	if err := Serve(&sc.buf, &out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	results := map[int]message{}
+	var notes []message
+	tr := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		body, err := readMessage(tr)
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != nil {
+			results[*msg.ID] = msg
+		} else {
+			notes = append(notes, msg)
+		}
+	}
+	return results, notes
+}
+
+func newContext() *goal.Context {
+	ctx := goal.NewContext()
+	ctx.RegisterDyad("import", func(ctx *goal.Context, args []goal.V) goal.V { return goal.NewI(0) })
+	return ctx
+}
+
+func pos(line, char int) map[string]interface{} {
+	return map[string]interface{}{"line": line, "character": char}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.goal")
+	if err := os.WriteFile(lib, []byte("/ library\nsq:{x*x}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathURI(filepath.Join(dir, "main.goal"))
+	src := "import\"lib\"\nn:3\nf:{lib.sq n}\n\"p\" import \"lib\"\n"
+	help := func() map[string]string {
+		return map[string]string{"abs": "abs n    absolute value", "+": "n+n add"}
+	}
+	sc := &script{}
+	early := sc.request("textDocument/hover", map[string]interface{}{})
+	initID := sc.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	sc.notify("initialized", map[string]interface{}{})
+	doc := map[string]interface{}{"uri": uri}
+	sc.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": uri, "languageId": "goal", "version": 1, "text": src}})
+	hoverID := sc.request("textDocument/hover", map[string]interface{}{"textDocument": doc, "position": pos(2, 0)})
+	hoverOpID := sc.request("textDocument/hover", map[string]interface{}{"textDocument": doc, "position": pos(4, 0)})
+	defGlobalID := sc.request("textDocument/definition", map[string]interface{}{"textDocument": doc, "position": pos(2, 10)})
+	defPkgID := sc.request("textDocument/definition", map[string]interface{}{"textDocument": doc, "position": pos(2, 5)})
+	defPkgGlobalID := sc.request("textDocument/definition", map[string]interface{}{"textDocument": doc, "position": pos(2, 8)})
+	sc.notify("textDocument/didChange", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []interface{}{map[string]interface{}{"text": src + "a\nlib.s\n+abs 2\n"}}})
+	complID := sc.request("textDocument/completion", map[string]interface{}{"textDocument": doc, "position": pos(4, 1)})
+	complPkgID := sc.request("textDocument/completion", map[string]interface{}{"textDocument": doc, "position": pos(5, 5)})
+	hoverAbsID := sc.request("textDocument/hover", map[string]interface{}{"textDocument": doc, "position": pos(6, 2)})
+	sc.notify("textDocument/didChange", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "version": 3},
+		"contentChanges": []interface{}{map[string]interface{}{"text": "#!/bin/goal\n\n  x:1)+2\n"}}})
+	unknownID := sc.request("workspace/symbol", map[string]interface{}{})
+	shutdownID := sc.request("shutdown", nil)
+	sc.notify("exit", nil)
+	results, notes := sc.run(t, Config{Help: help, NewContext: newContext})
+
+	if r := results[early]; r.Error == nil || r.Error.Code != codeServerNotStarted {
+		t.Errorf("request before initialize: got %+v", r)
+	}
+	if r := results[initID]; !strings.Contains(string(r.Result), `"hoverProvider":true`) {
+		t.Errorf("initialize: got %s", r.Result)
+	}
+	hover := func(id int) string {
+		var h Hover
+		json.Unmarshal(results[id].Result, &h)
+		return h.Contents.Value
+	}
+	if got := hover(hoverID); got != "f:{lib.sq n}" {
+		t.Errorf("hover global: got %q", got)
+	}
+	if got := hover(hoverOpID); got != "" {
+		t.Errorf("hover past end: got %q", got)
+	}
+	if got := hover(hoverAbsID); got != "abs n    absolute value" {
+		t.Errorf("hover builtin: got %q", got)
+	}
+	definition := func(id int) Location {
+		var loc Location
+		json.Unmarshal(results[id].Result, &loc)
+		return loc
+	}
+	if got, want := definition(defGlobalID), (Location{URI: uri, Range: Range{End: Position{Line: 1, Character: 1}, Start: Position{Line: 1}}}); got != want {
+		t.Errorf("definition global: got %+v, expected %+v", got, want)
+	}
+	if got, want := definition(defPkgID), (Location{URI: pathURI(lib)}); got != want {
+		t.Errorf("definition package: got %+v, expected %+v", got, want)
+	}
+	if got, want := definition(defPkgGlobalID), (Location{URI: pathURI(lib), Range: Range{Start: Position{Line: 1}, End: Position{Line: 1, Character: 2}}}); got != want {
+		t.Errorf("definition package global: got %+v, expected %+v", got, want)
+	}
+	labels := func(id int) string {
+		var items []CompletionItem
+		json.Unmarshal(results[id].Result, &items)
+		var l []string
+		for _, item := range items {
+			l = append(l, item.Label)
+		}
+		return strings.Join(l, " ")
+	}
+	if got, want := labels(complID), "abs and atan"; got != want {
+		t.Errorf("completion: got %q, expected %q", got, want)
+	}
+	if got, want := labels(complPkgID), "lib.sq"; got != want {
+		t.Errorf("package completion: got %q, expected %q", got, want)
+	}
+	if r := results[unknownID]; r.Error == nil || r.Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method: got %+v", r)
+	}
+	if r := results[shutdownID]; string(r.Result) != "null" || r.Error != nil {
+		t.Errorf("shutdown: got %+v", r)
+	}
+
+	var diags []publishDiagnosticsParams
+	for _, n := range notes {
+		if n.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			json.Unmarshal(n.Params, &p)
+			diags = append(diags, p)
+		}
+	}
+	if len(diags) != 3 {
+		t.Fatalf("expected 3 diagnostics notifications, got %d", len(diags))
+	}
+	if len(diags[0].Diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags[0])
+	}
+	if d := diags[1].Diagnostics; len(d) != 1 || d[0].Severity != severityWarning ||
+		d[0].Message != "global a read but never assigned" || d[0].Range.Start != (Position{Line: 4}) {
+		t.Errorf("bad lint diagnostics: %+v", d)
+	}
+	if d := diags[2].Diagnostics; len(d) != 1 || d[0].Range != (Range{Start: Position{Line: 2, Character: 5}, End: Position{Line: 2, Character: 6}}) {
+		t.Errorf("bad diagnostics: %+v", d)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	text := "a:1\nb:\"é𝄞x\"\n"
+	for _, off := range []int{0, 3, 4, 7, 9, 13, 14, len(text)} {
+		if got := offset(text, position(text, off)); got != off {
+			t.Errorf("offset(position(%d)) = %d", off, got)
+		}
+	}
+	if got, want := position(text, 14), (Position{Line: 1, Character: 7}); got != want {
+		t.Errorf("position: got %+v, expected %+v", got, want)
+	}
+}
@@ -14,6 +14,7 @@ const (
 	opInt
 	opVariadic
 	opLambda
+	opClosure
 	opLocal
 	opLocalLast
 	opGlobal
@@ -31,6 +32,11 @@ const (
 	opApplyN
 	opApplyNGlobal
 	opApplyNV
+	opTailApply
+	opTailApplyGlobal
+	opTailApply2
+	opTailApplyN
+	opTailApplyNGlobal
 	opDrop
 	opJump
 	opJumpFalse
@@ -43,9 +49,9 @@ const (
 
 func (opc opcode) argc() int {
 	switch opc {
-	case opNop, opNil, opApply, opApply2, opDrop, opReturn, opTry:
+	case opNop, opNil, opApply, opApply2, opTailApply, opTailApply2, opDrop, opReturn, opTry:
 		return 0
-	case opApplyNV, opApplyNGlobal:
+	case opApplyNV, opApplyNGlobal, opTailApplyNGlobal:
 		return 2
 	default:
 		return 1
@@ -64,9 +70,9 @@ func (ctx *Context) opcodesString(ops []opcode, lc *lambdaCode) string {
 		}
 		fmt.Fprintf(&sb, "%3d %3d %s\t", i, pos, op)
 		switch op {
-		case opConst, opInt, opLambda, opApplyN:
+		case opConst, opInt, opLambda, opClosure, opApplyN, opTailApplyN:
 			fmt.Fprintf(&sb, "%d", ops[i+1])
-		case opGlobal, opGlobalLast, opAssignGlobal, opApplyGlobal:
+		case opGlobal, opGlobalLast, opAssignGlobal, opApplyGlobal, opTailApplyGlobal:
 			fmt.Fprintf(&sb, "%d (%s)", ops[i+1], ctx.gNames[int(ops[i+1])])
 		case opListAssignGlobal:
 			ids := ctx.gAssignLists[ops[i+1]]
@@ -75,7 +81,7 @@ func (ctx *Context) opcodesString(ops []opcode, lc *lambdaCode) string {
 				names[i] = ctx.gNames[id]
 			}
 			fmt.Fprintf(&sb, "%d (%s)", ops[i+1], strings.Join(names, ","))
-		case opApplyNGlobal:
+		case opApplyNGlobal, opTailApplyNGlobal:
 			fmt.Fprintf(&sb, "%d (%s)\t%d", ops[i+1], ctx.gNames[int(ops[i+1])], ops[i+2])
 		case opLocal, opLocalLast, opAssignLocal:
 			fmt.Fprintf(&sb, "%d (%s)", ops[i+1], lc.Names[int(ops[i+1])])
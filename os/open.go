@@ -14,14 +14,16 @@ import (
 )
 
 type file struct {
-	f    *os.File
+	f    *os.File  // nil for handles created with NewHandle
+	c    io.Closer // underlying closer (if any)
 	b    *bufio.ReadWriter
 	mode string
+	name string
 }
 
 func newFile(f *os.File) goal.V {
 	b := bufio.NewReadWriter(bufio.NewReader(f), bufio.NewWriter(f))
-	return goal.NewV(&file{f: f, b: b, mode: "s"})
+	return goal.NewV(&file{f: f, c: f, b: b, mode: "s", name: f.Name()})
 }
 
 // NewStdHandle returns a buffered handle for the given file.
@@ -29,9 +31,29 @@ func NewStdHandle(f *os.File) goal.V {
 	return newFile(f)
 }
 
+// NewHandle returns a buffered handle with the given name, reading from r
+// and writing to w, any of which may be nil. It can be used to define STDIN,
+// STDOUT or STDERR handles from arbitrary readers and writers. Closing the
+// handle closes w, or r if w is nil, if it implements io.Closer.
+func NewHandle(name string, r io.Reader, w io.Writer) goal.V {
+	f := &file{b: &bufio.ReadWriter{}, mode: "s", name: name}
+	if r != nil {
+		f.b.Reader = bufio.NewReader(r)
+		f.c, _ = r.(io.Closer)
+	}
+	if w != nil {
+		f.b.Writer = bufio.NewWriter(w)
+		f.c, _ = w.(io.Closer)
+	}
+	return goal.NewV(f)
+}
+
 func (f *file) Matches(y goal.BV) bool {
 	switch yv := y.(type) {
 	case *file:
+		if f.f == nil || yv.f == nil {
+			return f == yv
+		}
 		return f.f.Fd() == yv.f.Fd()
 	case *command:
 		return false
@@ -44,7 +66,7 @@ func (f *file) Append(ctx *goal.Context, dst []byte) []byte {
 	dst = append(dst, "open["...)
 	dst = strconv.AppendQuote(dst, f.mode)
 	dst = append(dst, ';')
-	dst = strconv.AppendQuote(dst, f.f.Name())
+	dst = strconv.AppendQuote(dst, f.name)
 	dst = append(dst, ']')
 	return dst
 }
@@ -56,6 +78,9 @@ func (f *file) Type() string {
 func (f *file) LessT(y goal.BV) bool {
 	switch yv := y.(type) {
 	case *file:
+		if f.f == nil || yv.f == nil {
+			return f.name < yv.name
+		}
 		return f.f.Fd() < yv.f.Fd()
 	default:
 		return f.Type() < y.Type()
@@ -63,16 +88,27 @@ func (f *file) LessT(y goal.BV) bool {
 }
 
 func (f *file) Read(p []byte) (n int, err error) {
+	if f.b.Reader == nil {
+		return 0, errors.New("write-only")
+	}
 	return f.b.Read(p)
 }
 
 func (f *file) Write(p []byte) (n int, err error) {
+	if f.b.Writer == nil {
+		return 0, errors.New("read-only")
+	}
 	return f.b.Write(p)
 }
 
 func (f *file) Close() error {
-	f.b.Writer.Flush()
-	return f.f.Close()
+	if f.b.Writer != nil {
+		f.b.Writer.Flush()
+	}
+	if f.c == nil {
+		return nil
+	}
+	return f.c.Close()
 }
 
 type command struct {
@@ -183,7 +219,7 @@ func VFOpen(ctx *goal.Context, args []goal.V) goal.V {
 	case "a+":
 		flag = os.O_RDWR | os.O_CREATE | os.O_APPEND
 	case "-|", "|-":
-		return openPipe(m, args[0])
+		return openPipe(ctx, m, args[0])
 	default:
 		return goal.Panicf("mode open path : invalid mode (%s)", m)
 	}
@@ -199,10 +235,10 @@ func VFOpen(ctx *goal.Context, args []goal.V) goal.V {
 		return goal.Errorf("%v", err)
 	}
 	b := bufio.NewReadWriter(bufio.NewReader(f), bufio.NewWriter(f))
-	return goal.NewV(&file{f: f, b: b, mode: m})
+	return goal.NewV(&file{f: f, c: f, b: b, mode: m, name: f.Name()})
 }
 
-func openPipe(m string, c goal.V) goal.V {
+func openPipe(ctx *goal.Context, m string, c goal.V) goal.V {
 	var cmd *exec.Cmd
 	switch cv := c.BV().(type) {
 	case goal.S:
@@ -222,7 +258,7 @@ func openPipe(m string, c goal.V) goal.V {
 		if err != nil {
 			return goal.Errorf("%v", err)
 		}
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = Stdout(ctx)
 		r.stdin = wc
 		r.b = bufio.NewReadWriter(nil, bufio.NewWriter(wc))
 	case "-|":
@@ -230,10 +266,10 @@ func openPipe(m string, c goal.V) goal.V {
 		if err != nil {
 			return goal.Errorf("%v", err)
 		}
-		cmd.Stdin = os.Stdin
+		cmd.Stdin = Stdin(ctx)
 		r.b = bufio.NewReadWriter(bufio.NewReader(rc), nil)
 	}
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = Stderr(ctx)
 	err := cmd.Start()
 	if err != nil {
 		return goal.Errorf("%v", err)
@@ -359,6 +395,9 @@ func readString(h goal.V, delim string) goal.V {
 	}
 	switch hv := h.BV().(type) {
 	case *file:
+		if hv.b.Reader == nil {
+			return goal.NewPanic("write-only handle")
+		}
 		s, err := hv.b.Reader.ReadString(delim[0])
 		if err != nil && (err != io.EOF || s == "") {
 			return goal.Errorf("%v", err)
@@ -397,6 +436,9 @@ func VFFlush(ctx *goal.Context, args []goal.V) goal.V {
 	x := args[0]
 	switch xv := x.BV().(type) {
 	case *file:
+		if xv.b.Writer == nil {
+			return goal.NewError(goal.NewS("read-only handle"))
+		}
 		err := xv.b.Writer.Flush()
 		if err != nil {
 			return goal.Errorf("%v", err)
@@ -5,11 +5,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"codeberg.org/anaseto/goal"
 )
@@ -22,8 +25,124 @@ import (
 // x import s : same as import s but use prefix x.  If x is empty, no prefix is
 // used.
 //
+// X import s : same as import s, but also assign package globals X to globals
+// with the same names in the current namespace. If X is a dictionary, package
+// globals in its values are assigned to globals named by its keys.
+//
 // It returns 0 and does nothing if a file has already been evaluated.
 func VFImport(ctx *goal.Context, args []goal.V) goal.V {
+	return vfImport(ctx, args, nil)
+}
+
+// ImportFS returns an import variadic function that works like VFImport, but
+// also searches modules in the given file systems, in order, after the
+// current directory and GOALLIB. It can be used with embed.FS values to
+// bundle goal modules with a program. Paths within file systems use forward
+// slashes, as in fs.FS. A module loaded from a file system can import other
+// modules relative to its own directory in that file system. Its location, as
+// used in error messages, is its path within the file system prefixed with
+// "fs:", so that it is distinct from the location of a real file.
+func ImportFS(fsys ...fs.FS) goal.VariadicFun {
+	im := &fsImporter{fsys: fsys, locs: map[string]int{}}
+	return func(ctx *goal.Context, args []goal.V) goal.V {
+		return vfImport(ctx, args, im)
+	}
+}
+
+// ImportFSFirst returns an import variadic function like ImportFS, but that
+// searches modules in the given file systems first, before the current
+// directory and GOALLIB, so that bundled modules are found in the same way
+// wherever the program is run.
+func ImportFSFirst(fsys ...fs.FS) goal.VariadicFun {
+	im := &fsImporter{fsys: fsys, locs: map[string]int{}, first: true}
+	return func(ctx *goal.Context, args []goal.V) goal.V {
+		return vfImport(ctx, args, im)
+	}
+}
+
+// fsLocPrefix is the prefix of the locations of modules loaded from file
+// systems.
+const fsLocPrefix = "fs:"
+
+// fsImporter represents a module search path made of file systems.
+type fsImporter struct {
+	fsys  []fs.FS
+	mu    sync.Mutex
+	locs  map[string]int // module location (with fsLocPrefix): index in fsys
+	first bool           // search file systems before other paths
+}
+
+// readRelative reads fname relative to the directory of the module being
+// evaluated by ctx, if it was loaded from one of the file systems. It returns
+// the module's location and source.
+func (im *fsImporter) readRelative(ctx *goal.Context, fname string) (string, string, bool) {
+	if im == nil {
+		return "", "", false
+	}
+	loc := ctx.Location()
+	im.mu.Lock()
+	i, ok := im.locs[loc]
+	im.mu.Unlock()
+	if !ok {
+		return "", "", false
+	}
+	p := path.Join(path.Dir(strings.TrimPrefix(loc, fsLocPrefix)), filepath.ToSlash(fname))
+	source, ok := readFS(im.fsys[i], p)
+	if !ok {
+		return "", "", false
+	}
+	return im.setFS(p, i), source, true
+}
+
+// setFS records that the module with path p was loaded from the i-th file
+// system, unless it was already loaded from another one, and returns its
+// location.
+func (im *fsImporter) setFS(p string, i int) string {
+	loc := fsLocPrefix + p
+	im.mu.Lock()
+	if _, ok := im.locs[loc]; !ok {
+		im.locs[loc] = i
+	}
+	im.mu.Unlock()
+	return loc
+}
+
+// search searches fname in the file systems, in order. It returns the
+// module's location and source.
+func (im *fsImporter) search(fname string) (string, string, bool) {
+	if im == nil {
+		return "", "", false
+	}
+	p := path.Clean(filepath.ToSlash(fname))
+	for i, fsys := range im.fsys {
+		if source, ok := readFS(fsys, p); ok {
+			return im.setFS(p, i), source, true
+		}
+	}
+	return "", "", false
+}
+
+// searchFirst is like search, but only for importers that search their file
+// systems first.
+func (im *fsImporter) searchFirst(fname string) (string, string, bool) {
+	if im == nil || !im.first {
+		return "", "", false
+	}
+	return im.search(fname)
+}
+
+func readFS(fsys fs.FS, p string) (string, bool) {
+	if !fs.ValidPath(p) {
+		return "", false
+	}
+	bs, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return "", false
+	}
+	return string(bs), true
+}
+
+func vfImport(ctx *goal.Context, args []goal.V, im *fsImporter) goal.V {
 	if len(args) > 2 {
 		return goal.Panicf("import : too many arguments (%d)", len(args))
 	}
@@ -31,21 +150,24 @@ func VFImport(ctx *goal.Context, args []goal.V) goal.V {
 	var hasPfx bool
 	if len(args) == 2 {
 		pfx := args[1]
-		p, ok := pfx.BV().(goal.S)
-		if !ok {
+		switch p := pfx.BV().(type) {
+		case goal.S:
+			prefix = string(p)
+			hasPfx = true
+		case *goal.AS, *goal.D:
+			return importAliases(ctx, pfx, args[0], im)
+		default:
 			return panicType("x import s", "x", pfx)
 		}
-		prefix = string(p)
-		hasPfx = true
 	}
 	s := args[0]
 	switch sv := s.BV().(type) {
 	case goal.S:
-		return importWithPrefix(ctx, prefix, string(sv), hasPfx)
+		return importWithPrefix(ctx, prefix, string(sv), hasPfx, im)
 	case *goal.AS:
 		var r goal.V
 		for _, si := range sv.Slice() {
-			r = importWithPrefix(ctx, prefix, si, hasPfx)
+			r = importWithPrefix(ctx, prefix, si, hasPfx, im)
 			if r.IsPanic() {
 				return r
 			}
@@ -59,7 +181,7 @@ func VFImport(ctx *goal.Context, args []goal.V) goal.V {
 	}
 }
 
-func importWithPrefix(ctx *goal.Context, prefix, name string, hasPfx bool) goal.V {
+func importWithPrefix(ctx *goal.Context, prefix, name string, hasPfx bool, im *fsImporter) goal.V {
 	if !hasPfx {
 		prefix = filepath.Base(name)
 		prefix = strings.TrimSuffix(prefix, filepath.Ext(prefix))
@@ -68,12 +190,22 @@ func importWithPrefix(ctx *goal.Context, prefix, name string, hasPfx bool) goal.
 	if filepath.Ext(fname) == "" {
 		fname += ".goal"
 	}
-	source, err := readFile(fname)
+	var source string
+	var err error
+	if p, s, ok := im.readRelative(ctx, fname); ok {
+		fname, source = p, s
+	} else if p, s, ok := im.searchFirst(fname); ok {
+		fname, source = p, s
+	} else {
+		source, err = readFile(fname)
+	}
 	if err != nil {
-		path, ok := searchIncFile(ctx, fname)
+		fpath, ok := searchIncFile(ctx, fname)
 		if ok {
-			fname = path
+			fname = fpath
 			source, err = readFile(fname)
+		} else if p, s, ok := im.search(fname); ok {
+			fname, source, err = p, s, nil
 		}
 		if err != nil {
 			return goal.Panicf("import : %v", err)
@@ -90,6 +222,47 @@ func importWithPrefix(ctx *goal.Context, prefix, name string, hasPfx bool) goal.
 	return r
 }
 
+// importAliases imports package s with its default prefix, and then assigns
+// the package globals given by x to globals in the current namespace. If x is
+// a dictionary, its keys are the aliases and its values the package global
+// names.
+func importAliases(ctx *goal.Context, x, s goal.V, im *fsImporter) goal.V {
+	name, ok := s.BV().(goal.S)
+	if !ok {
+		return panicType("x import s", "s", s)
+	}
+	var aliases, names []string
+	switch xv := x.BV().(type) {
+	case *goal.AS:
+		aliases = xv.Slice()
+		names = aliases
+	case *goal.D:
+		k, ok := xv.Keys().BV().(*goal.AS)
+		if !ok {
+			return panicType("x import s", "key", xv.Keys())
+		}
+		v, ok := xv.Values().BV().(*goal.AS)
+		if !ok {
+			return panicType("x import s", "value", xv.Values())
+		}
+		aliases, names = k.Slice(), v.Slice()
+	}
+	r := importWithPrefix(ctx, "", string(name), false, im)
+	if r.IsPanic() {
+		return r
+	}
+	prefix := filepath.Base(string(name))
+	prefix = strings.TrimSuffix(prefix, filepath.Ext(prefix))
+	for i, alias := range aliases {
+		v, ok := ctx.GetGlobal(prefix + "." + names[i])
+		if !ok || v == (goal.V{}) {
+			return goal.Panicf("x import s : undefined or private global in %s (%s)", name, names[i])
+		}
+		ctx.AssignGlobal(alias, v)
+	}
+	return r
+}
+
 // searchIncFile returns the path to filename relative to the current directory
 // or the GOALLIB environment variable, and boolean true if such a file exists.
 // Otherwise it returns a false boolean.
@@ -185,6 +358,9 @@ func fprintFunc(ctx *goal.Context, w, x goal.V, f func(*goal.Context, io.Writer,
 			return goal.Errorf("%v", err)
 		}
 	case *file:
+		if wv.b.Writer == nil {
+			return goal.NewPanic("read-only handle")
+		}
 		err := f(ctx, wv.b.Writer, x)
 		if err != nil {
 			return goal.Errorf("%v", err)
@@ -210,12 +386,13 @@ func fprintFunc(ctx *goal.Context, w, x goal.V, f func(*goal.Context, io.Writer,
 }
 
 func printV(ctx *goal.Context, x goal.V) error {
+	w := Stdout(ctx)
 	switch xv := x.BV().(type) {
 	case goal.S:
-		_, err := fmt.Print(string(xv))
+		_, err := fmt.Fprint(w, string(xv))
 		return err
 	case *goal.AS:
-		buf := bufio.NewWriter(os.Stdout)
+		buf := bufio.NewWriter(w)
 		imax := xv.Len() - 1
 		for i, s := range xv.Slice() {
 			buf.WriteString(s)
@@ -225,18 +402,19 @@ func printV(ctx *goal.Context, x goal.V) error {
 		}
 		return buf.Flush()
 	default:
-		_, err := fmt.Printf("%s", x.Append(ctx, nil))
+		_, err := w.Write(x.Append(ctx, nil))
 		return err
 	}
 }
 
 func sayV(ctx *goal.Context, x goal.V) error {
+	w := Stdout(ctx)
 	switch xv := x.BV().(type) {
 	case goal.S:
-		_, err := fmt.Println(string(xv))
+		_, err := fmt.Fprintln(w, string(xv))
 		return err
 	case *goal.AS:
-		buf := bufio.NewWriter(os.Stdout)
+		buf := bufio.NewWriter(w)
 		imax := xv.Len() - 1
 		for i, s := range xv.Slice() {
 			buf.WriteString(s)
@@ -247,7 +425,7 @@ func sayV(ctx *goal.Context, x goal.V) error {
 		buf.WriteByte('\n')
 		return buf.Flush()
 	default:
-		_, err := fmt.Printf("%s\n", x.Append(ctx, nil))
+		_, err := w.Write(append(x.Append(ctx, nil), '\n'))
 		return err
 	}
 }
@@ -314,10 +492,10 @@ func VFShell(ctx *goal.Context, args []goal.V) goal.V {
 	cmd := exec.Command("/bin/sh", "-c", shellcmd)
 	var sb strings.Builder
 	cmd.Stdout = &sb
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = Stderr(ctx)
 	switch len(args) {
 	case 1:
-		cmd.Stdin = os.Stdin
+		cmd.Stdin = Stdin(ctx)
 		err := cmd.Run()
 		if err != nil {
 			return cmdError(err, cmd, sb.String())
@@ -375,10 +553,10 @@ func VFRun(ctx *goal.Context, args []goal.V) goal.V {
 	}
 	if len(args) == 1 {
 		cmd := exec.Command(cmds[0], cmds[1:]...)
-		cmd.Stdin = os.Stdin
+		cmd.Stdin = Stdin(ctx)
 		var sb strings.Builder
 		cmd.Stdout = &sb
-		cmd.Stderr = os.Stderr
+		cmd.Stderr = Stderr(ctx)
 		err := cmd.Run()
 		if err != nil {
 			return cmdError(err, cmd, sb.String())
@@ -394,7 +572,7 @@ func VFRun(ctx *goal.Context, args []goal.V) goal.V {
 	cmd.Stdin = strings.NewReader(string(s))
 	var sb strings.Builder
 	cmd.Stdout = &sb
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = Stderr(ctx)
 	err := cmd.Run()
 	if err != nil {
 		return cmdError(err, cmd, sb.String())
@@ -424,6 +602,33 @@ func VFChdir(ctx *goal.Context, args []goal.V) goal.V {
 	}
 }
 
+// Stdout returns the standard output writer of the context, that is its
+// Stdout field, or os.Stdout if nil.
+func Stdout(ctx *goal.Context) io.Writer {
+	if ctx.Stdout != nil {
+		return ctx.Stdout
+	}
+	return os.Stdout
+}
+
+// Stderr returns the standard error writer of the context, that is its Stderr
+// field, or os.Stderr if nil.
+func Stderr(ctx *goal.Context) io.Writer {
+	if ctx.Stderr != nil {
+		return ctx.Stderr
+	}
+	return os.Stderr
+}
+
+// Stdin returns the standard input reader of the context, that is its Stdin
+// field, or os.Stdin if nil.
+func Stdin(ctx *goal.Context) io.Reader {
+	if ctx.Stdin != nil {
+		return ctx.Stdin
+	}
+	return os.Stdin
+}
+
 func panicType(op, sym string, x goal.V) goal.V {
 	return goal.Panicf("%s : bad type \"%s\" in %s", op, x.Type(), sym)
 }
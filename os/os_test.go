@@ -0,0 +1,108 @@
+package os
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"codeberg.org/anaseto/goal"
+)
+
+func newTestContext() *goal.Context {
+	ctx := goal.NewContext()
+	ctx.RegisterMonad("flush", VFFlush)
+	ctx.RegisterDyad("print", VFPrint)
+	ctx.RegisterDyad("read", VFRead)
+	ctx.RegisterDyad("say", VFSay)
+	return ctx
+}
+
+func TestStreams(t *testing.T) {
+	ctx := newTestContext()
+	var stdout, stderr bytes.Buffer
+	ctx.Stdin = strings.NewReader("first\nsecond\n")
+	ctx.Stdout = &stdout
+	ctx.Stderr = &stderr
+	if Stdin(ctx) != ctx.Stdin || Stdout(ctx) != ctx.Stdout || Stderr(ctx) != ctx.Stderr {
+		t.Fatalf("context streams not used")
+	}
+	ctx.AssignGlobal("STDIN", NewHandle("STDIN", Stdin(ctx), nil))
+	ctx.AssignGlobal("STDOUT", NewHandle("STDOUT", nil, Stdout(ctx)))
+	ctx.AssignGlobal("STDERR", NewHandle("STDERR", nil, Stderr(ctx)))
+	tests := []struct {
+		Expr   string
+		Result string
+		Stdout string
+		Stderr string
+	}{
+		{`say 1 2`, `1`, "1 2\n", ""},
+		{`print "a" "b"`, `1`, "a b", ""},
+		{`"\n" read STDIN`, `"first\n"`, "", ""},
+		{`read STDIN`, `"second\n"`, "", ""},
+		{`STDERR say "oops";flush STDERR`, `1`, "", "oops\n"},
+		{`STDOUT print "buffered"`, `1`, "", ""},
+		{`flush STDOUT`, `1`, "buffered", ""},
+		{`STDIN print "x"`, ``, "", ""},
+	}
+	for _, test := range tests {
+		stdout.Reset()
+		stderr.Reset()
+		r, err := ctx.Eval(test.Expr)
+		if test.Result == "" {
+			if err == nil || !strings.Contains(err.Error(), "read-only handle") {
+				t.Errorf("%s: bad error: %v", test.Expr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.Expr, err)
+			continue
+		}
+		if s := r.Sprint(ctx); s != test.Result {
+			t.Errorf("%s: got %s, expected %s", test.Expr, s, test.Result)
+		}
+		if stdout.String() != test.Stdout || stderr.String() != test.Stderr {
+			t.Errorf("%s: bad output: %q and %q, expected %q and %q", test.Expr,
+				stdout.String(), stderr.String(), test.Stdout, test.Stderr)
+		}
+	}
+}
+
+func TestImportFS(t *testing.T) {
+	ctx := goal.NewContext()
+	ctx.RegisterDyad("import", ImportFS(fstest.MapFS{
+		"lib/a.goal":   {Data: []byte("import \"b\"\nf:{b.g x}\n")},
+		"lib/b.goal":   {Data: []byte("g:{2*x}\n")},
+		"lib/bad.goal": {Data: []byte("x:1\ny:1+\"s\"\n")},
+	}))
+	tests := []struct {
+		Expr   string
+		Result string
+		Err    string
+	}{
+		{`import "lib/a"`, ``, ``},
+		{`a.f 3`, `6`, ``},
+		{`b.g 4`, `8`, ``},
+		{`import "lib/a"`, `0`, ``},
+		{`import "lib/b"`, `0`, ``},
+		{`import "lib/bad"`, ``, `fs:lib/bad.goal:2`},
+		{`import "lib/none"`, ``, `lib/none.goal`},
+	}
+	for _, test := range tests {
+		r, err := ctx.Eval(test.Expr)
+		if test.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.Err) {
+				t.Errorf("%s: bad error: %v", test.Expr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.Expr, err)
+			continue
+		}
+		if s := r.Sprint(ctx); test.Result != "" && s != test.Result {
+			t.Errorf("%s: got %s, expected %s", test.Expr, s, test.Result)
+		}
+	}
+}
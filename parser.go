@@ -104,7 +104,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 		default:
 			switch tok.Text {
 			case "'":
-				e, err = p.earlyReturn(tok.Text)
+				e, err = p.earlyReturn(tok)
 				return append(es, e), err
 			case `\`:
 				e, err = p.logStmt(tok.Pos)
@@ -117,7 +117,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 		switch ntok := p.peek(); ntok.Type {
 		case DYAD:
 			if ntok.Text != ":" && ntok.Text != "::" {
-				e = &astToken{Type: astIDENT, Pos: tok.Pos, Text: tok.Text}
+				e = &astToken{Type: astIDENT, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 				break
 			}
 			p.next()
@@ -130,7 +130,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 				strings.HasSuffix(ntok.Text, "::"))
 			return append(es, e), err
 		default:
-			e = &astToken{Type: astIDENT, Pos: tok.Pos, Text: tok.Text}
+			e = &astToken{Type: astIDENT, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 		}
 	case LEFTBRACE:
 		e, err = p.lambda()
@@ -142,7 +142,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 		ntok := p.peek()
 		if ntok.Type == RIGHTPAREN {
 			p.next()
-			e = &astToken{Type: astEMPTYLIST, Pos: tok.Pos, Text: tok.Text}
+			e = &astToken{Type: astEMPTYLIST, Pos: tok.Pos, End: ntok.End, Text: tok.Text}
 		} else {
 			e, err = p.list()
 			if err != nil {
@@ -157,13 +157,13 @@ func (p *parser) expr(es exprs) (exprs, error) {
 					break
 				}
 				p.next()
-				e, err = p.listAssign(ntok.Pos, getAssignList(e), strings.HasSuffix(ntok.Text, "::"))
+				e, err = p.listAssign(ntok.Pos, e.(*astList), strings.HasSuffix(ntok.Text, "::"))
 				return append(es, e), err
 			}
 		}
 	case NUMBER:
 		pos := p.token.Pos
-		e = &astToken{Pos: pos, Text: p.token.Text, Type: astNUMBER}
+		e = &astToken{Pos: pos, End: p.token.End, Text: p.token.Text, Type: astNUMBER}
 		switch p.peek().Type {
 		case NUMBER, STRING, QQSTART:
 			st := &astStrand{Pos: pos, Items: []expr{e}}
@@ -172,7 +172,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 		}
 	case STRING:
 		pos := p.token.Pos
-		e = &astToken{Pos: pos, Text: p.token.Text, Type: astSTRING}
+		e = &astToken{Pos: pos, End: p.token.End, Text: p.token.Text, Type: astSTRING}
 		switch p.peek().Type {
 		case NUMBER, STRING, QQSTART:
 			st := &astStrand{Pos: pos, Items: []expr{e}}
@@ -195,7 +195,7 @@ func (p *parser) expr(es exprs) (exprs, error) {
 			e, err = p.strand(st)
 		}
 	case REGEXP:
-		e = &astToken{Type: astREGEXP, Pos: tok.Pos, Text: tok.Text}
+		e = &astToken{Type: astREGEXP, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 	case RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
 		if len(p.depth) == 0 {
 			err = p.errorf("unexpected %s without opening matching pair", tok)
@@ -222,18 +222,18 @@ func (p *parser) expr(es exprs) (exprs, error) {
 				RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN,
 				LEFTBRACKET, ADVERB:
 			default:
-				e, err = p.earlyReturn(tok.Text)
+				e, err = p.earlyReturn(tok)
 				return append(es, e), err
 			}
 		}
-		e = &astToken{Type: astDYAD, Pos: tok.Pos, Text: tok.Text}
+		e = &astToken{Type: astDYAD, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 	case DYADASSIGN:
 		if tok.Text != "::" {
 			return es, p.errorf("assignment operation without identifier left")
 		}
-		e = &astToken{Type: astDYAD, Pos: tok.Pos, Text: tok.Text}
+		e = &astToken{Type: astDYAD, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 	case MONAD:
-		e = &astToken{Type: astMONAD, Pos: tok.Pos, Text: tok.Text}
+		e = &astToken{Type: astMONAD, Pos: tok.Pos, End: tok.End, Text: tok.Text}
 	default:
 		// should not happen
 		panic(fmt.Sprintf("invalid token: %v", tok))
@@ -356,7 +356,7 @@ func (p *parser) lambdaArgs() ([]string, error) {
 
 func (p *parser) sequence() (expr, error) {
 	p.depth = append(p.depth, p.token)
-	b := &astSeq{}
+	b := &astSeq{StartPos: p.token.Pos}
 	b.Body = []expr{}
 	for {
 		es, err := p.expr(exprs{})
@@ -422,7 +422,7 @@ loop:
 		if len(a.Args) > 1 {
 			return p.assignDeepAmendOp(identok, a, ":", global)
 		}
-		return p.assignAmendOp(identok, a.Args, ":", global)
+		return p.assignAmendOp(identok, a, ":", global)
 	case DYADASSIGN:
 		p.next()
 		dyad := strings.TrimRight(ntok.Text, ":")
@@ -430,7 +430,7 @@ loop:
 		if len(a.Args) > 1 {
 			return p.assignDeepAmendOp(identok, a, dyad, global)
 		}
-		return p.assignAmendOp(identok, a.Args, dyad, global)
+		return p.assignAmendOp(identok, a, dyad, global)
 	default:
 		return a, nil
 	}
@@ -449,14 +449,15 @@ func isAmend(e expr) bool {
 	return ok
 }
 
-func (p *parser) assignAmendOp(identok *astToken, args []expr,
+func (p *parser) assignAmendOp(identok *astToken, an *astApplyN,
 	dyad string, global bool) (expr, error) {
 	a := &astAssignAmendOp{
 		Name:    identok.Text,
 		Global:  global,
-		Indices: args[0], // len(args) == 1
+		Indices: an.Args[0], // len(an.Args) == 1
 		Dyad:    dyad,
 		Pos:     identok.Pos,
+		EndPos:  an.EndPos,
 	}
 	es, err := p.subExpr()
 	a.Right = es
@@ -509,8 +510,8 @@ func (p *parser) apply2Adverb(verb, left expr) (expr, error) {
 	return a, err
 }
 
-func (p *parser) earlyReturn(s string) (expr, error) {
-	a := &astReturn{OnError: s == "'"}
+func (p *parser) earlyReturn(tok Token) (expr, error) {
+	a := &astReturn{OnError: tok.Text == "'", Pos: tok.Pos}
 	es, err := p.subExpr()
 	a.Expr = es
 	if err != nil {
@@ -554,11 +555,13 @@ func (p *parser) assign(tok Token, global bool) (expr, error) {
 	return a, nil
 }
 
-func (p *parser) listAssign(pos int, names []string, global bool) (expr, error) {
+func (p *parser) listAssign(pos int, l *astList, global bool) (expr, error) {
 	a := &astListAssign{
-		Names:  names,
-		Global: global,
-		Pos:    pos,
+		Names:   getAssignList(l),
+		Global:  global,
+		Pos:     pos,
+		ListPos: l.StartPos,
+		ListEnd: l.EndPos,
 	}
 	es, err := p.subExpr()
 	a.Right = es
@@ -597,7 +600,7 @@ func (p *parser) subExpr() (exprs, error) {
 
 func (p *parser) list() (expr, error) {
 	p.depth = append(p.depth, p.token)
-	l := &astList{}
+	l := &astList{StartPos: p.token.Pos}
 	l.Args = []expr{}
 	for {
 		es, err := p.expr(exprs{})
@@ -620,8 +623,9 @@ func (p *parser) list() (expr, error) {
 				// not a list, but a parenthesized
 				// expression.
 				return &astParen{
-					Expr:   es,
-					EndPos: err.Pos + 1,
+					Expr:     es,
+					StartPos: l.StartPos,
+					EndPos:   err.Pos + 1,
 				}, nil
 			}
 			l.EndPos = err.Pos + 1
@@ -662,7 +666,7 @@ func getAssignList(e expr) []string {
 
 func (p *parser) derivedVerb(e expr) *astDerivedVerb {
 	// p.token.Type is ADVERB
-	atok := &astToken{Type: astADVERB, Pos: p.token.Pos, Text: p.token.Text}
+	atok := &astToken{Type: astADVERB, Pos: p.token.Pos, End: p.token.End, Text: p.token.Text}
 	dv := &astDerivedVerb{Adverb: atok, Verb: e}
 	return dv
 }
@@ -672,9 +676,9 @@ func (p *parser) strand(st *astStrand) (expr, error) {
 	for {
 		switch p.token.Type {
 		case NUMBER:
-			st.Items = append(st.Items, &astToken{Type: astNUMBER, Pos: p.token.Pos, Text: p.token.Text})
+			st.Items = append(st.Items, &astToken{Type: astNUMBER, Pos: p.token.Pos, End: p.token.End, Text: p.token.Text})
 		case STRING:
-			st.Items = append(st.Items, &astToken{Type: astSTRING, Pos: p.token.Pos, Text: p.token.Text})
+			st.Items = append(st.Items, &astToken{Type: astSTRING, Pos: p.token.Pos, End: p.token.End, Text: p.token.Text})
 		case QQSTART:
 			e, err := p.qq()
 			if err != nil {
@@ -705,16 +709,18 @@ func (p *parser) qq() (expr, error) {
 			if len(qq.Tokens) == 1 && qq.Tokens[0].Type == astSTRING {
 				tok := qq.Tokens[0]
 				tok.Pos = qq.Pos
+				tok.End = p.token.End
 				return &tok, nil
 			}
 			if len(qq.Tokens) == 0 {
-				return &astToken{Type: astSTRING, Pos: qq.Pos, Text: `""`}, nil
+				return &astToken{Type: astSTRING, Pos: qq.Pos, End: p.token.End, Text: `""`}, nil
 			}
+			qq.EndPos = p.token.End
 			return qq, nil
 		case STRING:
-			qq.Tokens = append(qq.Tokens, astToken{Type: astSTRING, Pos: p.token.Pos, Text: p.token.Text})
+			qq.Tokens = append(qq.Tokens, astToken{Type: astSTRING, Pos: p.token.Pos, End: p.token.End, Text: p.token.Text})
 		case IDENT:
-			qq.Tokens = append(qq.Tokens, astToken{Type: astIDENT, Pos: p.token.Pos, Text: p.token.Text})
+			qq.Tokens = append(qq.Tokens, astToken{Type: astIDENT, Pos: p.token.Pos, End: p.token.End, Text: p.token.Text})
 		case ERROR:
 			return qq, p.errorf("%s", p.token.Text)
 		default:
@@ -0,0 +1,132 @@
+package goal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pkgState represents the state of a package with export control during its
+// evaluation with EvalPackage.
+type pkgState struct {
+	exports map[string]bool // exported names
+	private map[string]int  // private name: global id
+}
+
+// scanExports returns the names declared in top-level export statements with
+// constant string arguments, or nil if there are none. Exports are collected
+// before compilation, so that an export statement applies to the whole
+// package.
+func scanExports(keywords map[string]IdentType, source string) map[string]bool {
+	if keywords["export"] != IdentMonad {
+		return nil
+	}
+	var exports map[string]bool
+	s := NewScanner(keywords, source)
+	depth := 0
+	start := true // start of a top-level statement
+	tok := s.Next()
+	for {
+		switch tok.Type {
+		case EOF, ERROR:
+			return exports
+		case LEFTBRACE, LEFTBRACKET, LEFTBRACKETS, LEFTPAREN:
+			depth++
+		case RIGHTBRACE, RIGHTBRACKET, RIGHTPAREN:
+			depth--
+		case MONAD:
+			if start && depth == 0 && tok.Text == "export" {
+				for {
+					name, ok := scanConstString(s)
+					if !ok {
+						break
+					}
+					if exports == nil {
+						exports = map[string]bool{}
+					}
+					exports[name] = true
+				}
+				// handle the token that ended the export statement
+				tok = s.token
+				start = false
+				continue
+			}
+		}
+		start = depth == 0 && (tok.Type == NEWLINE || tok.Type == SEMICOLON)
+		tok = s.Next()
+	}
+}
+
+// privateGlobal returns the id of the given package-private global, creating
+// it if necessary. It returns false if the name is not package-private.
+// Private globals are not registered by name, so they cannot be accessed
+// from outside the package.
+func (ctx *Context) privateGlobal(name string) (int, bool) {
+	pkg := ctx.pkg
+	if pkg == nil || ctx.gPrefix == "" {
+		return 0, false
+	}
+	name = strings.TrimPrefix(name, ctx.gPrefix+".")
+	if strings.ContainsRune(name, '.') || pkg.exports[name] {
+		return 0, false
+	}
+	id, ok := pkg.private[name]
+	if ok {
+		return id, true
+	}
+	id = len(ctx.gNames)
+	ctx.globals = append(ctx.globals, V{})
+	ctx.gNames = append(ctx.gNames, ctx.gPrefix+"."+name)
+	pkg.private[name] = id
+	return id, true
+}
+
+// lookupPrivate returns the id of the given existing package-private global.
+func (ctx *Context) lookupPrivate(name string) (int, bool) {
+	pkg := ctx.pkg
+	if pkg == nil {
+		return 0, false
+	}
+	id, ok := pkg.private[strings.TrimPrefix(name, ctx.gPrefix+".")]
+	return id, ok
+}
+
+// visibleGlobal reports whether the global with the given id can be accessed
+// by name in the current package.
+func (ctx *Context) visibleGlobal(id int) bool {
+	name := ctx.gNames[id]
+	if gid, ok := ctx.gIDs[name]; ok && gid == id {
+		return true
+	}
+	pid, ok := ctx.lookupPrivate(name)
+	return ok && pid == id
+}
+
+// privateGlobals returns the ids of the package-private globals, that is, the
+// globals that are not accessible by name.
+func (ctx *Context) privateGlobals() []int {
+	var ids []int
+	for id, name := range ctx.gNames {
+		if gid, ok := ctx.gIDs[name]; !ok || gid != id {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// scanConstString scans a constant string, possibly delimited by double
+// quotes, and returns its value. It returns false if the next token does not
+// start a constant string.
+func scanConstString(s *Scanner) (string, bool) {
+	tok := s.Next()
+	if tok.Type == QQSTART {
+		tok = s.Next()
+		if tok.Type != STRING || s.Next().Type != QQEND {
+			return "", false
+		}
+	}
+	if tok.Type != STRING {
+		return "", false
+	}
+	name, err := strconv.Unquote(tok.Text)
+	return name, err == nil
+}
@@ -0,0 +1,406 @@
+package goal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime/metrics"
+	"sort"
+	"time"
+)
+
+const (
+	defaultProfilePeriod = time.Millisecond // default sampling period
+	profCheckSteps       = 256              // instructions between clock checks
+)
+
+// profiler represents the profiling state of a context. It is shared with
+// derived contexts.
+type profiler struct {
+	steps  int // instructions since last clock check
+	period time.Duration
+	start  time.Time
+	last   time.Time // time of last sample
+	allocs uint64    // allocated bytes at last sample
+
+	frames  []profFrame            // current goal call stack
+	locs    map[profLoc]int        // location: index in infos
+	infos   []profLocInfo          // location information
+	samples map[string]*profSample // stack key: sample
+	metric  []metrics.Sample
+}
+
+// profFrame represents a goal call stack frame.
+type profFrame struct {
+	lc    *lambdaCode // nil for global code
+	fname string      // filename
+	src   string      // source (for global code)
+	pos   []int       // position table
+	ip    int         // last executed instruction
+}
+
+// profLoc represents a location in goal code.
+type profLoc struct {
+	lc    *lambdaCode
+	fname string
+	pos   int
+}
+
+// profLocInfo represents information about a location.
+type profLocInfo struct {
+	fn    string // function name
+	file  string // file name
+	line  int    // line number
+	start int    // function start line
+}
+
+// profSample represents aggregated samples for a given stack.
+type profSample struct {
+	stack []int // location indices, innermost first
+	count int64
+	ns    int64
+	bytes int64
+}
+
+// Profile represents profiling data collected by a context between calls to
+// StartProfile and StopProfile.
+type Profile struct {
+	period   time.Duration
+	start    time.Time
+	duration time.Duration
+	infos    []profLocInfo
+	samples  []*profSample
+}
+
+// StartProfile starts profiling goal code executed by the context, sampling
+// the goal call stack every period (1ms if period is non-positive). Sampled
+// time and allocated bytes are attributed to the lambdas and source lines
+// being executed. Code profiled with rt.prof in the meantime is attributed as
+// a whole to the line calling rt.prof.
+func (ctx *Context) StartProfile(period time.Duration) {
+	if ctx.prof != nil {
+		ctx.StopProfile()
+	}
+	ctx.prof = newProfiler(period)
+}
+
+// StopProfile stops profiling and returns the collected profile, or nil if
+// profiling was not started.
+func (ctx *Context) StopProfile() *Profile {
+	p := ctx.prof
+	if p == nil {
+		return nil
+	}
+	ctx.prof = nil
+	return p.stopProfile()
+}
+
+// newProfiler returns a new profiler. The clock is checked every few
+// instructions, instead of using a ticker goroutine, so that sampling works
+// even when the VM loop is the only runnable goroutine.
+func newProfiler(period time.Duration) *profiler {
+	if period <= 0 {
+		period = defaultProfilePeriod
+	}
+	p := &profiler{
+		period:  period,
+		start:   time.Now(),
+		locs:    map[profLoc]int{},
+		samples: map[string]*profSample{},
+		metric:  []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}},
+	}
+	p.last = p.start
+	p.allocs = p.readAllocs()
+	return p
+}
+
+// stopProfile returns the collected profile.
+func (p *profiler) stopProfile() *Profile {
+	prof := &Profile{
+		period:   p.period,
+		start:    p.start,
+		duration: time.Since(p.start),
+		infos:    p.infos,
+	}
+	for _, s := range p.samples {
+		prof.samples = append(prof.samples, s)
+	}
+	sort.Slice(prof.samples, func(i, j int) bool {
+		return prof.samples[i].ns > prof.samples[j].ns
+	})
+	return prof
+}
+
+func (p *profiler) readAllocs() uint64 {
+	metrics.Read(p.metric)
+	if p.metric[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return p.metric[0].Value.Uint64()
+}
+
+// pushProfFrame records the start of the execution of global code (lc == nil)
+// or a lambda.
+func (ctx *Context) pushProfFrame(lc *lambdaCode) {
+	p := ctx.prof
+	if lc != nil {
+		p.frames = append(p.frames, profFrame{lc: lc, fname: lc.Filename, pos: lc.Pos})
+		return
+	}
+	p.frames = append(p.frames, profFrame{fname: ctx.fname, src: ctx.sources[ctx.fname], pos: ctx.gCode.Pos})
+}
+
+// popProfFrame records the end of the execution of the last pushed frame.
+// Remaining time is attributed to the outermost frame when it ends, so that
+// short runs get at least one sample.
+func (ctx *Context) popProfFrame(p *profiler) {
+	switch len(p.frames) {
+	case 0:
+		return
+	case 1:
+		ctx.profSample(p)
+	}
+	p.frames = p.frames[:len(p.frames)-1]
+}
+
+// profStep is called before executing instruction ip of the current frame.
+func (ctx *Context) profStep(ip int) {
+	p := ctx.prof
+	if len(p.frames) == 0 {
+		return
+	}
+	p.steps++
+	if p.steps >= profCheckSteps {
+		p.steps = 0
+		if time.Since(p.last) >= p.period {
+			ctx.profSample(p)
+		}
+	}
+	p.frames[len(p.frames)-1].ip = ip
+}
+
+// profSample records a sample for the current call stack, attributing to it
+// the time and allocations since the last sample.
+func (ctx *Context) profSample(p *profiler) {
+	now := time.Now()
+	allocs := p.readAllocs()
+	var key []byte
+	stack := make([]int, 0, len(p.frames))
+	for i := len(p.frames) - 1; i >= 0; i-- {
+		fr := &p.frames[i]
+		if fr.ip >= len(fr.pos) {
+			continue
+		}
+		loc := profLoc{lc: fr.lc, fname: fr.fname, pos: fr.pos[fr.ip]}
+		id, ok := p.locs[loc]
+		if !ok {
+			id = len(p.infos)
+			p.locs[loc] = id
+			p.infos = append(p.infos, ctx.profLocInfo(fr, loc.pos))
+		}
+		stack = append(stack, id)
+		key = append(key, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+	}
+	s, ok := p.samples[string(key)]
+	if !ok {
+		s = &profSample{stack: stack}
+		p.samples[string(key)] = s
+	}
+	s.count++
+	s.ns += int64(now.Sub(p.last))
+	s.bytes += int64(allocs - p.allocs)
+	p.last = now
+	p.allocs = allocs
+}
+
+func (ctx *Context) profLocInfo(fr *profFrame, pos int) profLocInfo {
+	info := profLocInfo{file: fr.fname}
+	if fr.lc == nil {
+		info.fn = "main"
+		_, info.line, _ = getPosLine(fr.src, pos)
+		info.start = 1
+		return info
+	}
+	lc := fr.lc
+	src := ctx.sources[lc.Filename]
+	if lc.Filename == "" {
+		src = lc.Source
+		pos -= lc.StartPos
+		_, info.line, _ = getPosLine(src, pos)
+		info.start = 1
+	} else {
+		_, info.line, _ = getPosLine(src, pos)
+		_, info.start, _ = getPosLine(src, lc.StartPos)
+	}
+	for id, x := range ctx.globals {
+		if x.lambdaCode(ctx) == lc {
+			info.fn = ctx.gNames[id]
+			break
+		}
+	}
+	if info.fn == "" {
+		info.fn = fmt.Sprintf("{lambda}:%d", info.start)
+	}
+	return info
+}
+
+// WritePprof writes the profile in the gzip-compressed protocol buffer format
+// used by pprof. Sample values are sample counts, time in nanoseconds, and
+// allocated bytes.
+func (prof *Profile) WritePprof(w io.Writer) error {
+	b := &protoBuf{}
+	strs := map[string]int{"": 0}
+	strTable := []string{""}
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = len(strTable)
+			strs[s] = i
+			strTable = append(strTable, s)
+		}
+		return int64(i)
+	}
+	valueType := func(typ, unit string) []byte {
+		vt := &protoBuf{}
+		vt.int(1, str(typ))
+		vt.int(2, str(unit))
+		return vt.buf.Bytes()
+	}
+	// sample types
+	b.bytes(1, valueType("samples", "count"))
+	b.bytes(1, valueType("time", "nanoseconds"))
+	b.bytes(1, valueType("alloc_space", "bytes"))
+	for _, s := range prof.samples {
+		sb := &protoBuf{}
+		ids := make([]uint64, len(s.stack))
+		for i, id := range s.stack {
+			ids[i] = uint64(id + 1)
+		}
+		sb.packed(1, ids)
+		sb.packed(2, []uint64{uint64(s.count), uint64(s.ns), uint64(s.bytes)})
+		b.bytes(2, sb.buf.Bytes())
+	}
+	// locations and functions
+	funcs := map[[2]string]int{}
+	for i, info := range prof.infos {
+		k := [2]string{info.fn, info.file}
+		fid, ok := funcs[k]
+		if !ok {
+			fid = len(funcs) + 1
+			funcs[k] = fid
+			fb := &protoBuf{}
+			fb.int(1, int64(fid))
+			fb.int(2, str(info.fn))
+			fb.int(3, str(info.fn))
+			fb.int(4, str(info.file))
+			fb.int(5, int64(info.start))
+			b.bytes(5, fb.buf.Bytes())
+		}
+		lb := &protoBuf{}
+		lb.int(1, int64(fid))
+		lb.int(2, int64(info.line))
+		locb := &protoBuf{}
+		locb.int(1, int64(i+1))
+		locb.bytes(4, lb.buf.Bytes())
+		b.bytes(4, locb.buf.Bytes())
+	}
+	b.int(9, prof.start.UnixNano())
+	b.int(10, int64(prof.duration))
+	b.bytes(11, valueType("time", "nanoseconds"))
+	b.int(12, int64(prof.period))
+	b.int(14, str("time"))
+	for _, s := range strTable {
+		b.bytes(6, []byte(s))
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.buf.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuf is a minimal protocol buffer encoder.
+type protoBuf struct {
+	buf bytes.Buffer
+}
+
+func (b *protoBuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.buf.WriteByte(byte(x))
+}
+
+func (b *protoBuf) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(uint64(x))
+}
+
+func (b *protoBuf) bytes(field int, x []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(x)))
+	b.buf.Write(x)
+}
+
+func (b *protoBuf) packed(field int, x []uint64) {
+	pb := &protoBuf{}
+	for _, xi := range x {
+		pb.varint(xi)
+	}
+	b.bytes(field, pb.buf.Bytes())
+}
+
+// value returns the profile as a goal dict with keys "fn", "file", "line",
+// "ns" and "bytes", giving for each source line the time and allocations
+// attributed to it (self values), sorted by decreasing time.
+func (prof *Profile) value() V {
+	type line struct {
+		fn, file string
+		line     int
+	}
+	lines := map[line]int{} // line: index in rows
+	var rows []line
+	var ns, bs []int64
+	for _, s := range prof.samples {
+		if len(s.stack) == 0 {
+			continue
+		}
+		info := prof.infos[s.stack[0]]
+		l := line{fn: info.fn, file: info.file, line: info.line}
+		i, ok := lines[l]
+		if !ok {
+			i = len(rows)
+			lines[l] = i
+			rows = append(rows, l)
+			ns = append(ns, 0)
+			bs = append(bs, 0)
+		}
+		ns[i] += s.ns
+		bs[i] += s.bytes
+	}
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return ns[idx[i]] > ns[idx[j]] })
+	fns := make([]string, len(idx))
+	files := make([]string, len(idx))
+	rlines := make([]int64, len(idx))
+	rns := make([]int64, len(idx))
+	rbs := make([]int64, len(idx))
+	for i, k := range idx {
+		fns[i] = rows[k].fn
+		files[i] = rows[k].file
+		rlines[i] = int64(rows[k].line)
+		rns[i] = ns[k]
+		rbs[i] = bs[k]
+	}
+	keys := NewAS([]string{"fn", "file", "line", "ns", "bytes"})
+	values := NewAV([]V{NewAS(fns), NewAS(files), NewAI(rlines), NewAI(rns), NewAI(rbs)})
+	return NewD(keys, values)
+}
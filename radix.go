@@ -27,7 +27,6 @@ package goal
 
 import (
 	"math"
-	"sort"
 )
 
 const radix uint = 8
@@ -45,7 +44,7 @@ func radixSortAI(ctx *Context, x *AI, min, max int64) *AI {
 		} else {
 			buf = make([]int16, xlen*2)
 		}
-		r := radixSortAIWithSize(x, buf, 16, math.MinInt16)
+		r := radixSortAIWithSize(ctx, x, buf, 16, math.MinInt16)
 		return r
 	}
 	if min >= math.MinInt32 && max <= math.MaxInt32 {
@@ -58,19 +57,19 @@ func radixSortAI(ctx *Context, x *AI, min, max int64) *AI {
 		} else {
 			buf = make([]int32, xlen*2)
 		}
-		r := radixSortAIWithSize(x, buf, 32, math.MinInt32)
+		r := radixSortAIWithSize(ctx, x, buf, 32, math.MinInt32)
 		return r
 	}
 	// NOTE: given that Go's stdlib interface-based sort isn't the fastest
 	// on integers, it would sometimes be better to use radix sort for
 	// 64bits too, but not always.
 	x = scloneAI(x)
-	sort.Sort(x)
+	ctx.sort(x)
 	return x
 }
 
-func radixSortAIWithSize[I signed](x *AI, buf []I, size uint, min I) *AI {
-	from := radixSortInt64sWithSize[I](x.elts, buf, size, min)
+func radixSortAIWithSize[I signed](ctx *Context, x *AI, buf []I, size uint, min I) *AI {
+	from := radixSortInt64sWithSize[I](ctx, x.elts, buf, size, min)
 	var dst []int64
 	reuse := x.reusable()
 	if reuse {
@@ -79,6 +78,7 @@ func radixSortAIWithSize[I signed](x *AI, buf []I, size uint, min I) *AI {
 		dst = make([]int64, x.Len())
 	}
 	for i, n := range from {
+		ctx.pollInterrupt(i)
 		dst[i] = int64(n)
 	}
 	if reuse {
@@ -87,14 +87,15 @@ func radixSortAIWithSize[I signed](x *AI, buf []I, size uint, min I) *AI {
 	return &AI{elts: dst}
 }
 
-func radixSortInt64sWithSize[I signed](x []int64, buf []I, size uint, min I) []I {
+func radixSortInt64sWithSize[I signed](ctx *Context, x []int64, buf []I, size uint, min I) []I {
 	xlen := len(x)
 	from := buf[:xlen]
 	to := buf[xlen : xlen*2]
 	for i, xi := range x {
+		ctx.pollInterrupt(i)
 		from[i] = I(xi)
 	}
-	radixSortWithBuffer[I](from, to, size, min)
+	radixSortWithBuffer[I](ctx, from, to, size, min)
 	return from
 }
 
@@ -109,7 +110,7 @@ type unsigned interface {
 // radixSortWithBuffer sorts from using a radix sort. The to buffer slice
 // should have same length as from, size should be the bitsize of T, and min
 // should be the minimum possible value of type T.
-func radixSortWithBuffer[I signed](from, to []I, size uint, min I) {
+func radixSortWithBuffer[I signed](ctx *Context, from, to []I, size uint, min I) {
 	var keyOffset uint
 	for keyOffset = 0; keyOffset < size; keyOffset += radix {
 		var (
@@ -120,7 +121,8 @@ func radixSortWithBuffer[I signed](from, to []I, size uint, min I) {
 		)
 
 		// Compute counts by byte type at current radix
-		for _, elem := range from {
+		for i, elem := range from {
+			ctx.pollInterrupt(i)
 			key = uint8(elem >> keyOffset)
 			offset[key]++
 			if sorted {
@@ -156,7 +158,8 @@ func radixSortWithBuffer[I signed](from, to []I, size uint, min I) {
 		}
 
 		// Swap values between the buffers by radix
-		for _, elem := range from {
+		for i, elem := range from {
+			ctx.pollInterrupt(i)
 			key = uint8(elem >> keyOffset)
 			to[offset[key]] = elem
 			offset[key]++
@@ -194,7 +197,7 @@ func radixGradeSmallRange(ctx *Context, x *AI, min, max int64) V {
 	}
 	if xlen < 256 {
 		p := make([]byte, xlen)
-		radixGradeInt8(from, p)
+		radixGradeInt8(ctx, from, p)
 		return NewAB(p)
 	}
 	var p []int64
@@ -203,7 +206,7 @@ func radixGradeSmallRange(ctx *Context, x *AI, min, max int64) V {
 	} else {
 		p = make([]int64, xlen)
 	}
-	radixGradeInt8(from, p)
+	radixGradeInt8(ctx, from, p)
 	return NewAI(p)
 }
 
@@ -220,10 +223,10 @@ func radixGradeAI(ctx *Context, x *AI, min, max int64) V {
 			buf = make([]int16, xlen*2)
 		}
 		if xlen < 256 {
-			r := radixGradeAIBytes[int16](x, buf, 16, math.MinInt16)
+			r := radixGradeAIBytes[int16](ctx, x, buf, 16, math.MinInt16)
 			return NewAB(r)
 		}
-		r := radixGradeAIIs[int16](x, buf, 16, math.MinInt16)
+		r := radixGradeAIIs[int16](ctx, x, buf, 16, math.MinInt16)
 		return NewAI(r)
 	}
 	if min >= math.MinInt32 && max <= math.MaxInt32 {
@@ -237,27 +240,28 @@ func radixGradeAI(ctx *Context, x *AI, min, max int64) V {
 			buf = make([]int32, xlen*2)
 		}
 		if xlen < 256 {
-			r := radixGradeAIBytes[int32](x, buf, 32, math.MinInt32)
+			r := radixGradeAIBytes[int32](ctx, x, buf, 32, math.MinInt32)
 			return NewAB(r)
 		}
-		r := radixGradeAIIs[int32](x, buf, 32, math.MinInt32)
+		r := radixGradeAIIs[int32](ctx, x, buf, 32, math.MinInt32)
 		return NewAI(r)
 	}
 	if xlen < 256 {
 		p := &permutation[byte]{Perm: permRange[byte](xlen), X: x}
-		sort.Stable(p)
+		ctx.sortStable(p)
 		return NewAB(p.Perm)
 	}
 	p := &permutation[int64]{Perm: permRange[int64](xlen), X: x}
-	sort.Stable(p)
+	ctx.sortStable(p)
 	return NewAI(p.Perm)
 }
 
-func radixGradeAIIs[I signed](x *AI, buf []I, size uint, min I) []int64 {
+func radixGradeAIIs[I signed](ctx *Context, x *AI, buf []I, size uint, min I) []int64 {
 	xlen := x.Len()
 	from := buf[:xlen]
 	to := buf[xlen : xlen*2]
 	for i, xi := range x.elts {
+		ctx.pollInterrupt(i)
 		from[i] = I(xi)
 	}
 	var fromp, top []int64
@@ -272,15 +276,16 @@ func radixGradeAIIs[I signed](x *AI, buf []I, size uint, min I) []int64 {
 	for i := range fromp {
 		fromp[i] = int64(i)
 	}
-	radixGradeWithBuffer[I, int64](from, to, fromp, top, size, min)
+	radixGradeWithBuffer[I, int64](ctx, from, to, fromp, top, size, min)
 	return fromp
 }
 
-func radixGradeAIBytes[I signed](x *AI, buf []I, size uint, min I) []byte {
+func radixGradeAIBytes[I signed](ctx *Context, x *AI, buf []I, size uint, min I) []byte {
 	xlen := x.Len()
 	from := buf[:xlen]
 	to := buf[xlen : xlen*2]
 	for i, xi := range x.elts {
+		ctx.pollInterrupt(i)
 		from[i] = I(xi)
 	}
 	bufp := make([]byte, xlen*2)
@@ -289,14 +294,14 @@ func radixGradeAIBytes[I signed](x *AI, buf []I, size uint, min I) []byte {
 	for i := range fromp {
 		fromp[i] = byte(i)
 	}
-	radixGradeWithBuffer[I, byte](from, to, fromp, top, size, min)
+	radixGradeWithBuffer[I, byte](ctx, from, to, fromp, top, size, min)
 	return fromp
 }
 
 // radixGradeWithBuffer sorts from using a radix sort. The to buffer, fromp,
 // top slices should have same length as from, size should be the bitsize of T,
 // and min should be the minimum possible value of type T.
-func radixGradeWithBuffer[J signed, I integer](from, to []J, fromp, top []I, size uint, min J) {
+func radixGradeWithBuffer[J signed, I integer](ctx *Context, from, to []J, fromp, top []I, size uint, min J) {
 	var keyOffset uint
 	for keyOffset = 0; keyOffset < size; keyOffset += radix {
 		var (
@@ -307,7 +312,8 @@ func radixGradeWithBuffer[J signed, I integer](from, to []J, fromp, top []I, siz
 		)
 
 		// Compute counts by byte type at current radix
-		for _, elem := range from {
+		for i, elem := range from {
+			ctx.pollInterrupt(i)
 			key = uint8(elem >> keyOffset)
 			offset[key]++
 			if sorted {
@@ -344,6 +350,7 @@ func radixGradeWithBuffer[J signed, I integer](from, to []J, fromp, top []I, siz
 
 		// Swap values between the buffers by radix
 		for i, elem := range from {
+			ctx.pollInterrupt(i)
 			key = uint8(elem >> keyOffset)
 			j := offset[key]
 			offset[key]++
@@ -363,14 +370,15 @@ func radixGradeWithBuffer[J signed, I integer](from, to []J, fromp, top []I, siz
 }
 
 // radixGradeInt8 sorts p by from, and puts sorted from into to.
-func radixGradeInt8[I integer](from []int8, p []I) {
+func radixGradeInt8[I integer](ctx *Context, from []int8, p []I) {
 	var (
 		offset [256]I // Keep track of where room is made for byte groups in the buffer
 		key    uint8
 	)
 
 	// Compute counts by byte type at current radix
-	for _, elem := range from {
+	for i, elem := range from {
+		ctx.pollInterrupt(i)
 		key = uint8(elem)
 		offset[key]++
 	}
@@ -392,6 +400,7 @@ func radixGradeInt8[I integer](from []int8, p []I) {
 
 	// Swap values between the buffers by radix
 	for i, elem := range from {
+		ctx.pollInterrupt(i)
 		key = uint8(elem)
 		j := offset[key]
 		offset[key]++
@@ -15,6 +15,9 @@ func uniform(ctx *Context, x V) V {
 		}
 		n = int64(x.F())
 	}
+	if err := ctx.allocN(n); err != nil {
+		return Panicf("?i : %v", err)
+	}
 	if ctx.rand == nil {
 		ctx.rand = rand.New(rand.NewSource(1))
 	}
@@ -42,6 +45,9 @@ func rolldeal(ctx *Context, x, y V) V {
 		}
 		n = int64(x.F())
 	}
+	if err := ctx.allocN(n); err != nil {
+		return Panicf("i?y : %v", err)
+	}
 	if ctx.rand == nil {
 		ctx.rand = rand.New(rand.NewSource(1))
 	}
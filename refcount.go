@@ -161,25 +161,50 @@ func (x *AV) reuse() *AV {
 	return (*AV)((*A[V])(x).reuse())
 }
 
-// IncrRC increments the reference count by one.
-func (x *AB) IncrRC() { x.rc++ }
+// IncrRC increments the reference count by one. It does nothing for
+// immutable values, as they may be shared by forked contexts.
+func (x *AB) IncrRC() {
+	if x.flags&flagImmutable == 0 {
+		x.rc++
+	}
+}
 
-// IncrRC increments the reference count by one.
-func (x *AI) IncrRC() { x.rc++ }
+// IncrRC increments the reference count by one. It does nothing for
+// immutable values, as they may be shared by forked contexts.
+func (x *AI) IncrRC() {
+	if x.flags&flagImmutable == 0 {
+		x.rc++
+	}
+}
 
-// IncrRC increments the reference count by one.
-func (x *AF) IncrRC() { x.rc++ }
+// IncrRC increments the reference count by one. It does nothing for
+// immutable values, as they may be shared by forked contexts.
+func (x *AF) IncrRC() {
+	if x.flags&flagImmutable == 0 {
+		x.rc++
+	}
+}
 
-// IncrRC increments the reference count by one.
-func (x *AS) IncrRC() { x.rc++ }
+// IncrRC increments the reference count by one. It does nothing for
+// immutable values, as they may be shared by forked contexts.
+func (x *AS) IncrRC() {
+	if x.flags&flagImmutable == 0 {
+		x.rc++
+	}
+}
 
-// IncrRC increments the reference count by one.
-func (x *AV) IncrRC() { x.rc++ }
+// IncrRC increments the reference count by one. It does nothing for
+// immutable values, as they may be shared by forked contexts.
+func (x *AV) IncrRC() {
+	if x.flags&flagImmutable == 0 {
+		x.rc++
+	}
+}
 
 // DecrRC decrements the reference count by one, or zero if it is already non
 // positive.
 func (x *AB) DecrRC() {
-	if x.rc > 0 {
+	if x.rc > 0 && x.flags&flagImmutable == 0 {
 		x.rc--
 	}
 }
@@ -187,7 +212,7 @@ func (x *AB) DecrRC() {
 // DecrRC decrements the reference count by one, or zero if it is already non
 // positive.
 func (x *AI) DecrRC() {
-	if x.rc > 0 {
+	if x.rc > 0 && x.flags&flagImmutable == 0 {
 		x.rc--
 	}
 }
@@ -195,7 +220,7 @@ func (x *AI) DecrRC() {
 // DecrRC decrements the reference count by one, or zero if it is already non
 // positive.
 func (x *AF) DecrRC() {
-	if x.rc > 0 {
+	if x.rc > 0 && x.flags&flagImmutable == 0 {
 		x.rc--
 	}
 }
@@ -203,7 +228,7 @@ func (x *AF) DecrRC() {
 // DecrRC decrements the reference count by one, or zero if it is already non
 // positive.
 func (x *AS) DecrRC() {
-	if x.rc > 0 {
+	if x.rc > 0 && x.flags&flagImmutable == 0 {
 		x.rc--
 	}
 }
@@ -211,7 +236,7 @@ func (x *AS) DecrRC() {
 // DecrRC decrements the reference count by one, or zero if it is already non
 // positive.
 func (x *AV) DecrRC() {
-	if x.rc > 0 {
+	if x.rc > 0 && x.flags&flagImmutable == 0 {
 		x.rc--
 	}
 }
@@ -265,6 +290,18 @@ func (p *projectionMonad) DecrRC() {
 	p.Fun.DecrRC()
 }
 
+func (cl *closure) IncrRC() {
+	for _, x := range cl.Env {
+		x.IncrRC()
+	}
+}
+
+func (cl *closure) DecrRC() {
+	for _, x := range cl.Env {
+		x.DecrRC()
+	}
+}
+
 func (e *errV) IncrRC()       { e.V.IncrRC() }
 func (e *errV) DecrRC()       { e.V.DecrRC() }
 func (r *replacer) IncrRC()   { r.oldnew.IncrRC() }
@@ -290,27 +327,37 @@ func (e *errV) MarkImmutable() {
 
 // MarkImmutable marks the value as definitively non-reusable.
 func (x *AB) MarkImmutable() {
-	x.flags |= flagImmutable
+	if x.flags&flagImmutable == 0 {
+		x.flags |= flagImmutable
+	}
 }
 
 // MarkImmutable marks the value as definitively non-reusable.
 func (x *AI) MarkImmutable() {
-	x.flags |= flagImmutable
+	if x.flags&flagImmutable == 0 {
+		x.flags |= flagImmutable
+	}
 }
 
 // MarkImmutable marks the value as definitively non-reusable.
 func (x *AF) MarkImmutable() {
-	x.flags |= flagImmutable
+	if x.flags&flagImmutable == 0 {
+		x.flags |= flagImmutable
+	}
 }
 
 // MarkImmutable marks the value as definitively non-reusable.
 func (x *AS) MarkImmutable() {
-	x.flags |= flagImmutable
+	if x.flags&flagImmutable == 0 {
+		x.flags |= flagImmutable
+	}
 }
 
 // MarkImmutable marks the value as definitively non-reusable.
 func (x *AV) MarkImmutable() {
-	x.flags |= flagImmutable
+	if x.flags&flagImmutable == 0 {
+		x.flags |= flagImmutable
+	}
 }
 
 // MarkImmutable marks the value as definitively non-reusable.
@@ -335,6 +382,12 @@ func (p *projectionMonad) MarkImmutable() {
 	p.Fun.MarkImmutable()
 }
 
+func (cl *closure) MarkImmutable() {
+	for _, x := range cl.Env {
+		x.MarkImmutable()
+	}
+}
+
 func (r *derivedVerb) MarkImmutable() {
 	r.Arg.MarkImmutable()
 }
@@ -347,6 +400,40 @@ func (r *rxReplacer) MarkImmutable() {
 	r.repl.MarkImmutable()
 }
 
+// markImmutableRec marks the value as definitively non-reusable, as well as
+// any values it contains. Array MarkImmutable methods do not write flags of
+// already immutable values, so this can be called on values shared with
+// running forked contexts.
+func markImmutableRec(x V) {
+	if x.kind != valBoxed {
+		return
+	}
+	x.MarkImmutable()
+	switch xv := x.bv.(type) {
+	case *errV:
+		markImmutableRec(xv.V)
+	case *AV:
+		for _, xi := range xv.elts {
+			markImmutableRec(xi)
+		}
+	case *D:
+		markImmutableRec(NewV(xv.keys))
+		markImmutableRec(NewV(xv.values))
+	case *projection:
+		for _, arg := range xv.Args {
+			markImmutableRec(arg)
+		}
+	case *projectionFirst:
+		markImmutableRec(xv.Arg)
+	case *derivedVerb:
+		markImmutableRec(xv.Arg)
+	case *closure:
+		for _, xi := range xv.Env {
+			markImmutableRec(xi)
+		}
+	}
+}
+
 func refcounts(x V) V {
 	if x.kind != valBoxed {
 		return NewI(-1)
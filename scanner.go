@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
 // Token represents a token information.
 type Token struct {
 	Type TokenType // token type
 	Pos  int       // token's offset in the source
+	End  int       // offset just after the token in the source
 	Text string    // content text (identifier, string, number)
 }
 
@@ -100,6 +102,9 @@ type Scanner struct {
 	source  string               // source string
 	state   stateFn              // starting state for Next
 	qr      rune                 // quote closing rune
+
+	keepComments bool      // whether to record comments
+	comments     []Comment // recorded comments
 }
 
 type stateFn func(*Scanner) stateFn
@@ -168,7 +173,7 @@ func (s *Scanner) next() {
 }
 
 func (s *Scanner) emit(t TokenType) stateFn {
-	s.token = Token{Type: t, Pos: s.tpos}
+	s.token = Token{Type: t, Pos: s.tpos, End: s.epos}
 	s.start = t == NEWLINE
 	s.delimOp = t == LEFTPAREN || t == LEFTBRACKET || t == LEFTBRACE || t == LEFTBRACKETS
 	switch t {
@@ -183,12 +188,12 @@ func (s *Scanner) emit(t TokenType) stateFn {
 }
 
 func (s *Scanner) emitError(err string) stateFn {
-	s.token = Token{Type: ERROR, Pos: s.tpos, Text: err}
+	s.token = Token{Type: ERROR, Pos: s.tpos, End: s.epos, Text: err}
 	return nil
 }
 
 func (s *Scanner) emitString(t TokenType) stateFn {
-	s.token = Token{Type: t, Pos: s.tpos, Text: s.source[s.tpos:s.epos]}
+	s.token = Token{Type: t, Pos: s.tpos, End: s.epos, Text: s.source[s.tpos:s.epos]}
 	s.start = false
 	s.delimOp = false
 	s.exprEnd = true
@@ -196,7 +201,7 @@ func (s *Scanner) emitString(t TokenType) stateFn {
 }
 
 func (s *Scanner) emitRegexp(text string) stateFn {
-	s.token = Token{Type: REGEXP, Pos: s.tpos, Text: text}
+	s.token = Token{Type: REGEXP, Pos: s.tpos, End: s.epos, Text: text}
 	s.start = false
 	s.delimOp = false
 	s.exprEnd = true
@@ -204,7 +209,7 @@ func (s *Scanner) emitRegexp(text string) stateFn {
 }
 
 func (s *Scanner) emitNewString(t TokenType, text string) stateFn {
-	s.token = Token{Type: t, Pos: s.tpos, Text: text}
+	s.token = Token{Type: t, Pos: s.tpos, End: s.epos, Text: text}
 	s.start = false
 	s.delimOp = false
 	s.exprEnd = true
@@ -212,7 +217,7 @@ func (s *Scanner) emitNewString(t TokenType, text string) stateFn {
 }
 
 func (s *Scanner) emitSpecial(r rune) stateFn {
-	s.token = Token{Type: SADVERB, Pos: s.tpos, Text: string(r)}
+	s.token = Token{Type: SADVERB, Pos: s.tpos, End: s.epos + utf8.RuneLen(r), Text: string(r)}
 	s.start = false
 	s.delimOp = true
 	s.exprEnd = false
@@ -234,7 +239,7 @@ func (s *Scanner) emitIDENT() stateFn {
 }
 
 func (s *Scanner) emitOp(t TokenType) stateFn {
-	s.token = Token{Type: t, Pos: s.tpos, Text: s.source[s.tpos:s.epos]}
+	s.token = Token{Type: t, Pos: s.tpos, End: s.epos, Text: s.source[s.tpos:s.epos]}
 	s.start = false
 	s.delimOp = false
 	s.exprEnd = false
@@ -355,6 +360,7 @@ func scanSpace(s *Scanner) stateFn {
 		s.next()
 		switch s.r {
 		case '/':
+			s.tpos = s.epos
 			return scanComment
 		case ' ', '\t', '\r':
 		case '-':
@@ -380,8 +386,10 @@ func scanComment(s *Scanner) stateFn {
 		s.next()
 		switch s.r {
 		case eof:
+			s.addComment()
 			return s.emitEOF()
 		case '\n':
+			s.addComment()
 			s.next()
 			if !s.start {
 				if !s.delimOp {
@@ -407,10 +415,12 @@ func scanMultiLineComment(s *Scanner) stateFn {
 		s.next()
 		switch {
 		case s.r == eof:
+			s.addComment()
 			return s.emitEOF()
 		case s.r == '\\' && s.start:
 			s.next()
 			if s.r == '\n' {
+				s.addComment()
 				s.next()
 				return scanAny
 			}
@@ -418,6 +428,14 @@ func scanMultiLineComment(s *Scanner) stateFn {
 	}
 }
 
+// addComment records the comment starting at the token start position and
+// ending just before the current rune, if comments are kept.
+func (s *Scanner) addComment() {
+	if s.keepComments {
+		s.comments = append(s.comments, Comment{Slash: s.tpos, Text: s.source[s.tpos:s.epos]})
+	}
+}
+
 func scanBackQuotedString(s *Scanner) stateFn {
 	for {
 		s.next()
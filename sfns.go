@@ -406,7 +406,7 @@ func cutWhere(x, y V) V {
 }
 
 // take returns i#y.
-func take(x, y V) V {
+func take(ctx *Context, x, y V) V {
 	n := int64(0)
 	if x.IsI() {
 		n = x.I()
@@ -427,18 +427,36 @@ func take(x, y V) V {
 	}
 	switch yv := y.bv.(type) {
 	case *D:
+		if err := ctx.allocTakeN(n, yv.keys.Len()); err != nil {
+			return Panicf("i#y : %v", err)
+		}
 		rk := takeN(n, yv.keys)
 		rv := takeN(n, yv.values)
 		return NewV(&D{
 			keys:   rk.bv.(Array),
 			values: rv.bv.(Array)})
 	case Array:
+		if err := ctx.allocTakeN(n, yv.Len()); err != nil {
+			return Panicf("i#y : %v", err)
+		}
 		return takeN(n, yv)
 	default:
+		if err := ctx.allocN(n); err != nil {
+			return Panicf("i#y : %v", err)
+		}
 		return takeNAtom(n, y)
 	}
 }
 
+// allocTakeN records the allocation for i#y, where y has length l. Nothing is
+// allocated when taking a slice of y.
+func (ctx *Context) allocTakeN(n int64, l int) error {
+	if n > int64(l) || n < int64(-l) {
+		return ctx.allocN(n)
+	}
+	return nil
+}
+
 func takeNAtom(n int64, y V) V {
 	if y.IsI() {
 		yv := y.I()
@@ -1268,24 +1286,32 @@ func nudgeBack(x V) V {
 }
 
 // windows returns i^y.
-func windows(i int64, y V) V {
+func windows(ctx *Context, i int64, y V) V {
 	switch yv := y.bv.(type) {
 	case S:
 		if i < 0 && -i < int64(len(yv))+1 {
-			return windowsString(-i, string(yv))
+			i = -i
+		} else if i > 0 && i < int64(len(yv))+1 {
+			i = int64(len(yv)) - i + 1
+		} else {
+			return Panicf("i^y : out of range i (%d)", i)
 		}
-		if i > 0 && i < int64(len(yv))+1 {
-			return windowsString(int64(len(yv))-i+1, string(yv))
+		if err := ctx.allocN(int64(len(yv)) - i + 1); err != nil {
+			return Panicf("i^y : %v", err)
 		}
-		return Panicf("i^y : out of range i (%d)", i)
+		return windowsString(i, string(yv))
 	case Array:
 		if i < 0 && -i < int64(yv.Len())+1 {
-			return windowsArray(-i, yv)
+			i = -i
+		} else if i > 0 && i < int64(yv.Len())+1 {
+			i = int64(yv.Len()) - i + 1
+		} else {
+			return Panicf("i^y : out of range i (%d)", i)
 		}
-		if i > 0 && i < int64(yv.Len())+1 {
-			return windowsArray(int64(yv.Len())-i+1, yv)
+		if err := ctx.allocN(int64(yv.Len()) - i + 1); err != nil {
+			return Panicf("i^y : %v", err)
 		}
-		return Panicf("i^y : out of range i (%d)", i)
+		return windowsArray(i, yv)
 	default:
 		return panicType("i^y", "y", y)
 	}
@@ -65,8 +65,43 @@ func (d *D) Swap(i, j int) {
 	d.values.Swap(i, j)
 }
 
+// interruptibleSort wraps a sort.Interface, checking for interruption every
+// interruptChunk comparisons.
+type interruptibleSort struct {
+	sort.Interface
+	ctx *Context
+	n   int // number of comparisons
+}
+
+// Less satisfies the specification of sort.Interface.
+func (s *interruptibleSort) Less(i, j int) bool {
+	s.n++
+	s.ctx.pollInterrupt(s.n)
+	return s.Interface.Less(i, j)
+}
+
+// sort is like sort.Sort, but it can be interrupted, like pollInterrupt.
+func (ctx *Context) sort(data sort.Interface) {
+	if ctx.intr == nil {
+		sort.Sort(data)
+		return
+	}
+	sort.Sort(&interruptibleSort{Interface: data, ctx: ctx})
+}
+
+// sortStable is like sort.Stable, but it can be interrupted, like
+// pollInterrupt.
+func (ctx *Context) sortStable(data sort.Interface) {
+	if ctx.intr == nil {
+		sort.Stable(data)
+		return
+	}
+	sort.Stable(&interruptibleSort{Interface: data, ctx: ctx})
+}
+
 // sortUp returns ^x.
-func sortUp(ctx *Context, x V) V {
+func sortUp(ctx *Context, x V) (r V) {
+	defer catchInterrupt(&r)
 	xa, ok := x.bv.(Array)
 	if !ok {
 		switch xv := x.bv.(type) {
@@ -96,12 +131,12 @@ func sortUp(ctx *Context, x V) V {
 		return NewV(xv)
 	case *AV:
 		xa = xv.sclone()
-		sort.Stable(xa)
+		ctx.sortStable(xa)
 		xa.setFlags(flags | flagAscending)
 		return NewV(xa)
 	default:
 		xa = xa.sclone()
-		sort.Sort(xa)
+		ctx.sort(xa)
 		xa.setFlags(flags | flagAscending)
 		return NewV(xa)
 	}
@@ -150,7 +185,7 @@ func sortAI(ctx *Context, xv *AI) *AI {
 		return radixSortAI(ctx, xv, min, max)
 	}
 	xv = scloneAI(xv)
-	sort.Sort(xv)
+	ctx.sort(xv)
 	return xv
 }
 
@@ -206,7 +241,8 @@ func permRange[I integer](n int) []I {
 }
 
 // ascend returns <x.
-func ascend(ctx *Context, x V) V {
+func ascend(ctx *Context, x V) (r V) {
+	defer catchInterrupt(&r)
 	switch xv := x.bv.(type) {
 	case Array:
 		return ascendArray(ctx, xv)
@@ -273,7 +309,7 @@ func ascendAI(ctx *Context, xv *AI) V {
 		return radixGradeAI(ctx, xv, min, max)
 	}
 	p := &permutation[byte]{Perm: permRange[byte](xlen), X: xv}
-	sort.Stable(p)
+	ctx.sortStable(p)
 	return NewAB(p.Perm)
 }
 
@@ -287,13 +323,13 @@ func ascendArray(ctx *Context, x Array) V {
 		if x.Len() < 256 {
 			p := &permutation[byte]{Perm: permRange[byte](xv.Len()), X: xv}
 			if !ascending(xv) {
-				sort.Stable(p)
+				ctx.sortStable(p)
 			}
 			return NewAB(p.Perm)
 		}
 		p := &permutation[int64]{Perm: permRange[int64](xv.Len()), X: xv}
 		if !ascending(xv) {
-			sort.Stable(p)
+			ctx.sortStable(p)
 		}
 		return NewAI(p.Perm)
 	default:
@@ -328,7 +364,8 @@ func sortBy(ctx *Context, keys, values Array) *D {
 }
 
 // descend returns >x.
-func descend(ctx *Context, x V) V {
+func descend(ctx *Context, x V) (r V) {
+	defer catchInterrupt(&r)
 	switch xv := x.bv.(type) {
 	case Array:
 		return descendArray(ctx, xv)
@@ -77,34 +77,40 @@ func _() {
 	_ = x[opInt-3]
 	_ = x[opVariadic-4]
 	_ = x[opLambda-5]
-	_ = x[opLocal-6]
-	_ = x[opLocalLast-7]
-	_ = x[opGlobal-8]
-	_ = x[opGlobalLast-9]
-	_ = x[opAssignLocal-10]
-	_ = x[opAssignGlobal-11]
-	_ = x[opListAssignLocal-12]
-	_ = x[opListAssignGlobal-13]
-	_ = x[opApply-14]
-	_ = x[opApplyV-15]
-	_ = x[opApplyGlobal-16]
-	_ = x[opDerive-17]
-	_ = x[opApply2-18]
-	_ = x[opApply2V-19]
-	_ = x[opApplyN-20]
-	_ = x[opApplyNGlobal-21]
-	_ = x[opApplyNV-22]
-	_ = x[opDrop-23]
-	_ = x[opJump-24]
-	_ = x[opJumpFalse-25]
-	_ = x[opJumpTrue-26]
-	_ = x[opReturn-27]
-	_ = x[opTry-28]
+	_ = x[opClosure-6]
+	_ = x[opLocal-7]
+	_ = x[opLocalLast-8]
+	_ = x[opGlobal-9]
+	_ = x[opGlobalLast-10]
+	_ = x[opAssignLocal-11]
+	_ = x[opAssignGlobal-12]
+	_ = x[opListAssignLocal-13]
+	_ = x[opListAssignGlobal-14]
+	_ = x[opApply-15]
+	_ = x[opApplyV-16]
+	_ = x[opApplyGlobal-17]
+	_ = x[opDerive-18]
+	_ = x[opApply2-19]
+	_ = x[opApply2V-20]
+	_ = x[opApplyN-21]
+	_ = x[opApplyNGlobal-22]
+	_ = x[opApplyNV-23]
+	_ = x[opTailApply-24]
+	_ = x[opTailApplyGlobal-25]
+	_ = x[opTailApply2-26]
+	_ = x[opTailApplyN-27]
+	_ = x[opTailApplyNGlobal-28]
+	_ = x[opDrop-29]
+	_ = x[opJump-30]
+	_ = x[opJumpFalse-31]
+	_ = x[opJumpTrue-32]
+	_ = x[opReturn-33]
+	_ = x[opTry-34]
 }
 
-const _opcode_name = "opNopopNilopConstopIntopVariadicopLambdaopLocalopLocalLastopGlobalopGlobalLastopAssignLocalopAssignGlobalopListAssignLocalopListAssignGlobalopApplyopApplyVopApplyGlobalopDeriveopApply2opApply2VopApplyNopApplyNGlobalopApplyNVopDropopJumpopJumpFalseopJumpTrueopReturnopTry"
+const _opcode_name = "opNopopNilopConstopIntopVariadicopLambdaopClosureopLocalopLocalLastopGlobalopGlobalLastopAssignLocalopAssignGlobalopListAssignLocalopListAssignGlobalopApplyopApplyVopApplyGlobalopDeriveopApply2opApply2VopApplyNopApplyNGlobalopApplyNVopTailApplyopTailApplyGlobalopTailApply2opTailApplyNopTailApplyNGlobalopDropopJumpopJumpFalseopJumpTrueopReturnopTry"
 
-var _opcode_index = [...]uint16{0, 5, 10, 17, 22, 32, 40, 47, 58, 66, 78, 91, 105, 122, 140, 147, 155, 168, 176, 184, 193, 201, 215, 224, 230, 236, 247, 257, 265, 270}
+var _opcode_index = [...]uint16{0, 5, 10, 17, 22, 32, 40, 49, 56, 67, 75, 87, 100, 114, 131, 149, 156, 164, 177, 185, 193, 202, 210, 224, 233, 244, 261, 273, 285, 303, 309, 315, 326, 336, 344, 349}
 
 func (i opcode) String() string {
 	if i < 0 || i >= opcode(len(_opcode_index)-1) {
@@ -0,0 +1,436 @@
+package goal
+
+import (
+	"io"
+	"strings"
+)
+
+// This file provides an exported syntax tree, intended for external tools
+// like formatters or linters. It is built from the same scanner and parser
+// used by Compile, so that both always agree on the syntax.
+
+// NoPos is the position of nodes without position information, like an empty
+// argument in f[;y].
+const NoPos = -1
+
+// Node represents a node of the syntax tree built by Parse. Positions are
+// byte offsets in the parsed source.
+type Node interface {
+	Pos() int // position of the first character of the node
+	End() int // position just after the last character of the node
+}
+
+// Expr represents an expression node.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// File represents a parsed goal source.
+type File struct {
+	Loc      string     // location, as given to Parse
+	Source   string     // parsed source
+	Body     []*Exprs   // top-level expressions
+	Comments []*Comment // comments, in source order
+}
+
+// Comment represents a line comment, a multi-line comment block delimited by
+// lines with a lone / and a lone \, or a #! line at the start of a file.
+type Comment struct {
+	Slash int    // position of the starting / (or #)
+	Text  string // comment text, including delimiters
+}
+
+// Exprs represents a sequence of juxtaposed expressions, as in f g x, where
+// each expression applies monadically to the result of the following ones.
+// The sequence may be empty, as with an empty argument in f[;y].
+type Exprs struct {
+	List []Expr // expressions, in source order
+}
+
+// Ident represents a variable identifier.
+type Ident struct {
+	NamePos int
+	Name    string // name, possibly with a package prefix, like pkg.x
+}
+
+// Lit represents a number, string or regular expression literal. String
+// literals with interpolation are represented by Interp.
+type Lit struct {
+	ValuePos int
+	ValueEnd int
+	Kind     TokenType // NUMBER, STRING or REGEXP
+	Value    string    // value text, as produced by the scanner
+}
+
+// Verb represents a builtin verb, a named builtin (like abs or in), or an
+// adverb.
+type Verb struct {
+	VerbPos int
+	Kind    TokenType // MONAD, DYAD or ADVERB
+	Name    string
+}
+
+// DerivedVerb represents a verb derived with an adverb, as in +/ or f'.
+type DerivedVerb struct {
+	Verb   Expr  // modified expression (nil for an adverb in first position)
+	Adverb *Verb // adverb
+}
+
+// Strand represents a stranding of literals, like 1 23 "a" "b".
+type Strand struct {
+	Items []Expr // *Lit or *Interp items
+}
+
+// Interp represents a string literal with interpolation, like "a$x" or
+// qq/a$x/.
+type Interp struct {
+	Quote    int    // position of the starting quote (or of qq)
+	QuoteEnd int    // position after the closing quote
+	Parts    []Expr // *Lit string parts and *Ident interpolated variables
+}
+
+// ParenExpr represents a parenthesized expression (x).
+type ParenExpr struct {
+	Lparen int
+	X      *Exprs
+	Rparen int
+}
+
+// ListExpr represents a list (x;y;...), or the empty list () if Items is empty.
+type ListExpr struct {
+	Lparen int
+	Items  []*Exprs
+	Rparen int
+}
+
+// SeqExpr represents a sequence [x;y;...] of expressions evaluated in order.
+type SeqExpr struct {
+	Lbrack int
+	Body   []*Exprs
+	Rbrack int
+}
+
+// LambdaExpr represents a lambda {[x;y]...}.
+type LambdaExpr struct {
+	Lbrace int
+	Params []string // explicit parameters (if any)
+	Body   []*Exprs // expressions of the body
+	Rbrace int
+}
+
+// CallExpr represents a bracket application or indexing f[x;y;...].
+type CallExpr struct {
+	Fun    Expr
+	Lbrack int
+	Args   []*Exprs
+	Rbrack int
+}
+
+// BinaryExpr represents a dyadic application x v y, where the verb v is a
+// *Verb or a *DerivedVerb.
+type BinaryExpr struct {
+	Left  Expr
+	Verb  Expr
+	Right *Exprs // right argument (may be empty)
+}
+
+// ReturnExpr represents an early return :x, or a return on error 'x.
+type ReturnExpr struct {
+	Colon   int // position of : or '
+	OnError bool
+	X       *Exprs
+}
+
+// LogExpr represents a debug logging statement \x.
+type LogExpr struct {
+	Backslash int
+	X         *Exprs
+}
+
+// AssignExpr represents an assignment x:y or x::y, or an assignment operation
+// x op:y or x op::y.
+type AssignExpr struct {
+	NamePos int
+	Name    string
+	Global  bool   // whether :: or :
+	Op      string // verb of an assignment operation (if any)
+	Right   *Exprs
+}
+
+// ListAssignExpr represents a list assignment (x;y;...):z.
+type ListAssignExpr struct {
+	Lparen int
+	Names  []string
+	Rparen int
+	Global bool // whether :: or :
+	Right  *Exprs
+}
+
+// AmendAssignExpr represents an amending assignment x[y;...]:z, or an
+// amending assignment operation x[y;...]op:z.
+type AmendAssignExpr struct {
+	NamePos int
+	Name    string
+	Indices []*Exprs
+	Rbrack  int
+	Global  bool   // whether :: or :
+	Op      string // verb of an assignment operation (if any)
+	Right   *Exprs
+}
+
+func (f *File) Pos() int    { return 0 }
+func (f *File) End() int    { return len(f.Source) }
+func (c *Comment) Pos() int { return c.Slash }
+func (c *Comment) End() int { return c.Slash + len(c.Text) }
+
+func (es *Exprs) Pos() int {
+	if len(es.List) == 0 {
+		return NoPos
+	}
+	return es.List[0].Pos()
+}
+
+func (es *Exprs) End() int {
+	if len(es.List) == 0 {
+		return NoPos
+	}
+	return es.List[len(es.List)-1].End()
+}
+
+func (x *Ident) Pos() int { return x.NamePos }
+func (x *Ident) End() int { return x.NamePos + len(x.Name) }
+func (x *Lit) Pos() int   { return x.ValuePos }
+func (x *Lit) End() int   { return x.ValueEnd }
+func (x *Verb) Pos() int  { return x.VerbPos }
+func (x *Verb) End() int  { return x.VerbPos + len(x.Name) }
+
+func (x *DerivedVerb) Pos() int {
+	if x.Verb != nil {
+		return x.Verb.Pos()
+	}
+	return x.Adverb.Pos()
+}
+
+func (x *DerivedVerb) End() int     { return x.Adverb.End() }
+func (x *Strand) Pos() int          { return x.Items[0].Pos() }
+func (x *Strand) End() int          { return x.Items[len(x.Items)-1].End() }
+func (x *Interp) Pos() int          { return x.Quote }
+func (x *Interp) End() int          { return x.QuoteEnd }
+func (x *ParenExpr) Pos() int       { return x.Lparen }
+func (x *ParenExpr) End() int       { return x.Rparen + 1 }
+func (x *ListExpr) Pos() int        { return x.Lparen }
+func (x *ListExpr) End() int        { return x.Rparen + 1 }
+func (x *SeqExpr) Pos() int         { return x.Lbrack }
+func (x *SeqExpr) End() int         { return x.Rbrack + 1 }
+func (x *LambdaExpr) Pos() int      { return x.Lbrace }
+func (x *LambdaExpr) End() int      { return x.Rbrace + 1 }
+func (x *CallExpr) Pos() int        { return x.Fun.Pos() }
+func (x *CallExpr) End() int        { return x.Rbrack + 1 }
+func (x *BinaryExpr) Pos() int      { return x.Left.Pos() }
+func (x *ReturnExpr) Pos() int      { return x.Colon }
+func (x *ReturnExpr) End() int      { return x.X.End() }
+func (x *LogExpr) Pos() int         { return x.Backslash }
+func (x *LogExpr) End() int         { return x.X.End() }
+func (x *AssignExpr) Pos() int      { return x.NamePos }
+func (x *AssignExpr) End() int      { return x.Right.End() }
+func (x *ListAssignExpr) Pos() int  { return x.Lparen }
+func (x *ListAssignExpr) End() int  { return x.Right.End() }
+func (x *AmendAssignExpr) Pos() int { return x.NamePos }
+func (x *AmendAssignExpr) End() int { return x.Right.End() }
+
+func (x *BinaryExpr) End() int {
+	if len(x.Right.List) == 0 {
+		return x.Verb.End()
+	}
+	return x.Right.End()
+}
+
+func (es *Exprs) exprNode()          {}
+func (x *Ident) exprNode()           {}
+func (x *Lit) exprNode()             {}
+func (x *Verb) exprNode()            {}
+func (x *DerivedVerb) exprNode()     {}
+func (x *Strand) exprNode()          {}
+func (x *Interp) exprNode()          {}
+func (x *ParenExpr) exprNode()       {}
+func (x *ListExpr) exprNode()        {}
+func (x *SeqExpr) exprNode()         {}
+func (x *LambdaExpr) exprNode()      {}
+func (x *CallExpr) exprNode()        {}
+func (x *BinaryExpr) exprNode()      {}
+func (x *ReturnExpr) exprNode()      {}
+func (x *LogExpr) exprNode()         {}
+func (x *AssignExpr) exprNode()      {}
+func (x *ListAssignExpr) exprNode()  {}
+func (x *AmendAssignExpr) exprNode() {}
+
+// Parse parses the source src with the builtin keywords of a new context,
+// using loc as location in errors. See Context.Parse.
+func Parse(loc, src string) (*File, error) {
+	return NewContext().Parse(loc, src)
+}
+
+// Parse parses the source src with the keywords defined in the context,
+// without compiling it, and returns its syntax tree, using loc as location in
+// errors. Unlike with Compile, positions are offsets in src itself, and a
+// starting #! line is allowed and returned as a comment. The returned error,
+// if any, is a *PanicError. In that case, the file contains the top-level
+// expressions parsed before the error.
+func (ctx *Context) Parse(loc, src string) (*File, error) {
+	f := &File{Loc: loc, Source: src}
+	s := src
+	if strings.HasPrefix(src, "#!") {
+		i := strings.IndexByte(src, '\n')
+		if i < 0 {
+			i = len(src)
+		}
+		f.Comments = append(f.Comments, &Comment{Slash: 0, Text: src[:i]})
+		// blank the line, so that positions are preserved
+		s = strings.Repeat(" ", i) + src[i:]
+	}
+	pctx := &Context{keywords: ctx.keywords, fname: loc, sources: map[string]string{loc: src}}
+	pctx.scanner = NewScanner(ctx.keywords, s)
+	pctx.scanner.keepComments = true
+	p := newParser(pctx)
+	for {
+		e, err := p.Next()
+		if err != nil && err != io.EOF {
+			f.addComments(pctx.scanner.comments)
+			return f, pctx.getError(err, true)
+		}
+		if es := toExprs(e); len(es.List) > 0 {
+			f.Body = append(f.Body, es)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	f.addComments(pctx.scanner.comments)
+	return f, nil
+}
+
+func (f *File) addComments(comments []Comment) {
+	for i := range comments {
+		f.Comments = append(f.Comments, &comments[i])
+	}
+}
+
+// toExprs converts an expression sequence in stack-based order, as produced
+// by the parser, into source order.
+func toExprs(e expr) *Exprs {
+	es, ok := e.(exprs)
+	if !ok {
+		return &Exprs{List: []Expr{toExpr(e)}}
+	}
+	r := &Exprs{List: make([]Expr, len(es))}
+	for i, ei := range es {
+		r.List[len(es)-1-i] = toExpr(ei)
+	}
+	return r
+}
+
+func toExprsList(es []expr) []*Exprs {
+	r := make([]*Exprs, len(es))
+	for i, e := range es {
+		r[i] = toExprs(e)
+	}
+	return r
+}
+
+func toVerb(t *astToken) *Verb {
+	v := &Verb{VerbPos: t.Pos, Name: t.Text}
+	switch t.Type {
+	case astMONAD:
+		v.Kind = MONAD
+	case astDYAD:
+		v.Kind = DYAD
+	default:
+		v.Kind = ADVERB
+	}
+	return v
+}
+
+// toExpr converts a parser expression into an exported syntax node.
+func toExpr(e expr) Expr {
+	switch e := e.(type) {
+	case exprs:
+		return toExprs(e)
+	case *astToken:
+		switch e.Type {
+		case astNUMBER:
+			return &Lit{ValuePos: e.Pos, ValueEnd: e.End, Kind: NUMBER, Value: e.Text}
+		case astSTRING:
+			return &Lit{ValuePos: e.Pos, ValueEnd: e.End, Kind: STRING, Value: e.Text}
+		case astREGEXP:
+			return &Lit{ValuePos: e.Pos, ValueEnd: e.End, Kind: REGEXP, Value: e.Text}
+		case astIDENT:
+			return &Ident{NamePos: e.Pos, Name: e.Text}
+		case astEMPTYLIST:
+			return &ListExpr{Lparen: e.Pos, Rparen: e.End - 1}
+		default:
+			return toVerb(e)
+		}
+	case *astReturn:
+		return &ReturnExpr{Colon: e.Pos, OnError: e.OnError, X: toExprs(e.Expr)}
+	case *astLog:
+		return &LogExpr{Backslash: e.Pos, X: toExprs(e.Expr)}
+	case *astAssign:
+		return &AssignExpr{NamePos: e.Pos, Name: e.Name, Global: e.Global, Right: toExprs(e.Right)}
+	case *astAssignOp:
+		return &AssignExpr{NamePos: e.Pos, Name: e.Name, Global: e.Global, Op: e.Dyad, Right: toExprs(e.Right)}
+	case *astListAssign:
+		return &ListAssignExpr{Lparen: e.ListPos, Names: e.Names, Rparen: e.ListEnd - 1,
+			Global: e.Global, Right: toExprs(e.Right)}
+	case *astAssignAmendOp:
+		a := &AmendAssignExpr{NamePos: e.Pos, Name: e.Name, Indices: []*Exprs{toExprs(e.Indices)},
+			Rbrack: e.EndPos - 1, Global: e.Global, Right: toExprs(e.Right)}
+		if e.Dyad != ":" {
+			a.Op = e.Dyad
+		}
+		return a
+	case *astAssignDeepAmendOp:
+		a := &AmendAssignExpr{NamePos: e.Pos, Name: e.Name, Indices: toExprsList(e.Indices.Args),
+			Rbrack: e.Indices.EndPos - 1, Global: e.Global, Right: toExprs(e.Right)}
+		if e.Dyad != ":" {
+			a.Op = e.Dyad
+		}
+		return a
+	case *astStrand:
+		st := &Strand{Items: make([]Expr, len(e.Items))}
+		for i, item := range e.Items {
+			st.Items[i] = toExpr(item)
+		}
+		return st
+	case *astQq:
+		qq := &Interp{Quote: e.Pos, QuoteEnd: e.EndPos, Parts: make([]Expr, len(e.Tokens))}
+		for i := range e.Tokens {
+			qq.Parts[i] = toExpr(&e.Tokens[i])
+		}
+		return qq
+	case *astDerivedVerb:
+		dv := &DerivedVerb{Adverb: toVerb(e.Adverb)}
+		if e.Verb != nil {
+			dv.Verb = toExpr(e.Verb)
+		}
+		return dv
+	case *astParen:
+		return &ParenExpr{Lparen: e.StartPos, X: toExprs(e.Expr), Rparen: e.EndPos - 1}
+	case *astApply2:
+		return &BinaryExpr{Left: toExpr(e.Left), Verb: toExpr(e.Verb), Right: toExprs(e.Right)}
+	case *astApply2Adverb:
+		return &BinaryExpr{Left: toExpr(e.Left), Verb: toExpr(e.Verb), Right: toExprs(e.Right)}
+	case *astApplyN:
+		fun := toExpr(e.Verb)
+		return &CallExpr{Fun: fun, Lbrack: fun.End(), Args: toExprsList(e.Args), Rbrack: e.EndPos - 1}
+	case *astList:
+		return &ListExpr{Lparen: e.StartPos, Items: toExprsList(e.Args), Rparen: e.EndPos - 1}
+	case *astSeq:
+		return &SeqExpr{Lbrack: e.StartPos, Body: toExprsList(e.Body), Rbrack: e.EndPos - 1}
+	case *astLambda:
+		return &LambdaExpr{Lbrace: e.StartPos, Params: e.Args, Body: toExprsList(e.Body), Rbrace: e.EndPos - 1}
+	default:
+		// *astNop, which is not produced by the parser
+		return &Exprs{}
+	}
+}
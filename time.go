@@ -3,9 +3,56 @@ package goal
 import (
 	//"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Clock is the interface that provides the current time to time builtins.
+type Clock interface {
+	Now() time.Time
+}
+
+// FakeClock is a Clock that returns a given time until changed, useful for
+// reproducible tests. It is safe for concurrent use.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a new fake clock set to time t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set sets the current time of the fake clock.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.t = t
+	c.mu.Unlock()
+}
+
+// Advance moves the current time of the fake clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// now returns the current time using the context's clock.
+func (ctx *Context) now() time.Time {
+	if ctx.Clock != nil {
+		return ctx.Clock.Now()
+	}
+	return time.Now()
+}
+
 // vfTime implements the time variadic verb.
 func vfTime(ctx *Context, args []V) V {
 	x := args[len(args)-1]
@@ -17,7 +64,7 @@ func vfTime(ctx *Context, args []V) V {
 		return panicType("time[cmd;t;format]", "cmd", x)
 	}
 	if len(args) == 1 {
-		r := ftime(cmd, time.Now())
+		r := ftime(cmd, ctx.now())
 		if r.IsPanic() {
 			return Panicf("time x : %v", r)
 		}
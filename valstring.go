@@ -287,6 +287,35 @@ func (p *projectionMonad) Append(ctx *Context, dst []byte) []byte {
 	return dst
 }
 
+// Append appends a representation of the closure as a lambda taking the
+// captured locals as named parameters and returning the closure's lambda,
+// applied to the captured values, like {[a;b]{a+b*x}}[1;2].
+func (cl *closure) Append(ctx *Context, dst []byte) []byte {
+	if int(cl.Fun) >= len(ctx.lambdas) {
+		// Does not happen with main context.
+		return append(dst, fmt.Sprintf("·c[%d]", cl.Fun)...)
+	}
+	lc := ctx.lambdas[cl.Fun]
+	dst = append(dst, "{["...)
+	for i, id := range lc.Captures {
+		if i > 0 {
+			dst = append(dst, ';')
+		}
+		dst = append(dst, lc.Names[id]...)
+	}
+	dst = append(dst, ']')
+	dst = append(dst, lc.Source...)
+	dst = append(dst, "}["...)
+	for i, x := range cl.Env {
+		if i > 0 {
+			dst = append(dst, ';')
+		}
+		dst = x.Append(ctx, dst)
+	}
+	dst = append(dst, ']')
+	return dst
+}
+
 func (r *derivedVerb) Append(ctx *Context, dst []byte) []byte {
 	dst = r.Arg.Append(ctx, dst)
 	dst = append(dst, ctx.variadicsNames[r.Fun]...)
@@ -100,6 +100,22 @@ func (x V) lambda() lambda {
 	return lambda(x.uv)
 }
 
+// lambdaCode returns the code of a lambda or closure value, or nil for other
+// values.
+func (x V) lambdaCode(ctx *Context) *lambdaCode {
+	switch x.kind {
+	case valLambda:
+		if int(x.uv) < len(ctx.lambdas) {
+			return ctx.lambdas[x.uv]
+		}
+	case valBoxed:
+		if cl, ok := x.bv.(*closure); ok && int(cl.Fun) < len(ctx.lambdas) {
+			return ctx.lambdas[cl.Fun]
+		}
+	}
+	return nil
+}
+
 // Error retrieves the error value. It assumes x.IsError().
 func (x V) Error() V {
 	return x.bv.(*errV).V
@@ -143,6 +159,11 @@ func (x V) Type() string {
 	}
 }
 
+// IsNil returns true if the value is nil, like the value of an unset global.
+func (x V) IsNil() bool {
+	return x.kind == valNil
+}
+
 // IsI returns true if the value is an integer.
 func (x V) IsI() bool {
 	return x.kind == valInt
@@ -309,10 +330,18 @@ type projectionMonad struct {
 	Fun V
 }
 
+// closure represents a lambda with the values it captured from locals of
+// enclosing lambdas when it was created.
+type closure struct {
+	Fun lambda
+	Env []V // captured values, in the order of the lambda's Captures
+}
+
 func (p *projection) Type() string      { return "f" }
 func (p *projectionFirst) Type() string { return "f" }
 func (p *projectionMonad) Type() string { return "f" }
 func (r *derivedVerb) Type() string     { return "f" }
+func (cl *closure) Type() string        { return "f" }
 
 // function interface is satisfied by the different kind of functions. A
 // function is a value thas has a default rank. The default rank is used in
@@ -334,6 +363,9 @@ func (p *projectionFirst) rank(ctx *Context) int { return 1 }
 // Rank for a curryfied function is 1.
 func (p *projectionMonad) rank(ctx *Context) int { return 1 }
 
+// Rank for a closure is the rank of its lambda.
+func (cl *closure) rank(ctx *Context) int { return ctx.lambdas[cl.Fun].Rank }
+
 // Rank returns the rank of a derived verb.
 func (r *derivedVerb) rank(ctx *Context) int {
 	switch r.Fun {
@@ -352,6 +384,7 @@ func (p *projection) stype() string      { return "p" }
 func (p *projectionFirst) stype() string { return "pf" }
 func (p *projectionMonad) stype() string { return "pm" }
 func (r *derivedVerb) stype() string     { return "r" }
+func (cl *closure) stype() string        { return "c" }
 
 func (p *projection) Matches(x BV) bool {
 	xp, ok := x.(*projection)
@@ -379,6 +412,19 @@ func (p *projectionMonad) Matches(x BV) bool {
 	return ok && p.Fun.Matches(xp.Fun)
 }
 
+func (cl *closure) Matches(x BV) bool {
+	xcl, ok := x.(*closure)
+	if !ok || cl.Fun != xcl.Fun || len(cl.Env) != len(xcl.Env) {
+		return false
+	}
+	for i, xi := range cl.Env {
+		if !xi.Matches(xcl.Env[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *derivedVerb) Matches(x BV) bool {
 	xr, ok := x.(*derivedVerb)
 	return ok && r.Fun == xr.Fun && r.Arg.Matches(xr.Arg)
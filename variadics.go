@@ -126,6 +126,7 @@ func (ctx *Context) initVariadics() {
 	ctx.RegisterMonad("uc", vfUpperCeil)
 	ctx.RegisterMonad("error", vfError)
 	ctx.RegisterMonad("eval", vfEval)
+	ctx.RegisterMonad("export", vfExport)
 	ctx.RegisterMonad("firsts", vfFirsts)
 	ctx.RegisterMonad("json", vfjson)
 	ctx.RegisterMonad("ocount", vfOCount)
@@ -160,6 +161,7 @@ func (ctx *Context) initVariadics() {
 	// runtime functions
 	ctx.RegisterMonad("rt.ofs", vfRTOFS)
 	ctx.RegisterMonad("rt.prec", vfRTPrec)
+	ctx.RegisterMonad("rt.prof", vfRTProf)
 	ctx.RegisterMonad("rt.seed", vfRTSeed)
 	ctx.RegisterMonad("rt.time", vfRTTime)
 	ctx.RegisterMonad("rt.vars", vfRTVars)
@@ -208,7 +210,11 @@ func vfMultiply(ctx *Context, args []V) V {
 	case 1:
 		return first(args[0])
 	case 2:
-		return multiply(args[1], args[0])
+		x, y := args[1], args[0]
+		if err := ctx.allocRepeat(x, y); err != nil {
+			return Panicf("x*y : %v", err)
+		}
+		return multiply(x, y)
 	default:
 		return panicRank("*")
 	}
@@ -230,9 +236,9 @@ func vfDivide(ctx *Context, args []V) V {
 func vfDict(ctx *Context, args []V) V {
 	switch len(args) {
 	case 1:
-		return enum(args[0])
+		return enum(ctx, args[0])
 	case 2:
-		return dict(args[1], args[0])
+		return dict(ctx, args[1], args[0])
 	default:
 		return panicRank("!")
 	}
@@ -242,7 +248,7 @@ func vfDict(ctx *Context, args []V) V {
 func vfMin(ctx *Context, args []V) V {
 	switch len(args) {
 	case 1:
-		return where(args[0])
+		return where(ctx, args[0])
 	case 2:
 		return minimum(args[1], args[0])
 	default:
@@ -290,7 +296,7 @@ func vfMore(ctx *Context, args []V) V {
 func vfEqual(ctx *Context, args []V) V {
 	switch len(args) {
 	case 1:
-		return icountGroup(args[0])
+		return icountGroup(ctx, args[0])
 	case 2:
 		x, y := args[1], args[0]
 		if x.IsFunction() {
@@ -300,7 +306,7 @@ func vfEqual(ctx *Context, args []V) V {
 				ctx.drop()
 				return r
 			}
-			r = groupBy(r, y)
+			r = groupBy(ctx, r, y)
 			ctx.drop()
 			return r
 		}
@@ -328,7 +334,11 @@ func vfJoin(ctx *Context, args []V) V {
 	case 1:
 		return enlist(args[0])
 	case 2:
-		return join(args[1], args[0])
+		x, y := args[1], args[0]
+		if err := ctx.allocJoin(x, y); err != nil {
+			return Panicf("x,y : %v", err)
+		}
+		return join(x, y)
 	default:
 		return panicRank(",")
 	}
@@ -352,7 +362,7 @@ func vfWithout(ctx *Context, args []V) V {
 			ctx.drop()
 			return r
 		}
-		return without(x, y)
+		return without(ctx, x, y)
 	default:
 		return panicRank("^")
 	}
@@ -372,11 +382,15 @@ func vfTake(ctx *Context, args []V) V {
 				ctx.drop()
 				return r
 			}
+			if err := ctx.allocCounts(r); err != nil {
+				ctx.drop()
+				return Panicf("f#y : %v", err)
+			}
 			r = replicate(r, y)
 			ctx.drop()
 			return r
 		}
-		return take(x, y)
+		return take(ctx, x, y)
 	default:
 		return panicRank("#")
 	}
@@ -615,7 +629,7 @@ func vfCSV(ctx *Context, args []V) V {
 func vfjson(ctx *Context, args []V) V {
 	switch len(args) {
 	case 1:
-		return fJSON(args[0])
+		return fJSON(ctx, args[0])
 	default:
 		return panicRank("json")
 	}
@@ -655,6 +669,23 @@ func vfError(ctx *Context, args []V) V {
 	}
 }
 
+// vfExport implements the "export" variadic verb.
+func vfExport(ctx *Context, args []V) V {
+	if len(args) > 1 {
+		return panicRank("export")
+	}
+	x := args[0]
+	switch x.bv.(type) {
+	case S, *AS:
+	default:
+		return panicType("export s", "s", x)
+	}
+	if ctx.pkg == nil {
+		return panics("export s : not at top-level of a package with constant names")
+	}
+	return x
+}
+
 // vfEval implements the "eval" variadic verb.
 func vfEval(ctx *Context, args []V) V {
 	switch len(args) {
@@ -747,6 +778,9 @@ func vfSet(ctx *Context, args []V) V {
 		if !ok {
 			return panicType(":: x", "x", args[0])
 		}
+		if id, ok := ctx.lookupPrivate(string(name)); ok {
+			return ctx.globals[id]
+		}
 		r, ok := ctx.GetGlobal(string(name))
 		if !ok {
 			return Panicf(":: x : undefined global (%s)", name)
@@ -879,15 +913,20 @@ func vfRTVars(ctx *Context, args []V) V {
 	}
 	switch cmd {
 	case "":
-		v := cloneArgs(ctx.globals)
-		k := make([]string, len(ctx.gNames))
-		copy(k, ctx.gNames)
+		v := []V{}
+		k := []string{}
+		for i, x := range ctx.globals {
+			if ctx.visibleGlobal(i) {
+				v = append(v, x)
+				k = append(k, ctx.gNames[i])
+			}
+		}
 		return NewD(NewAS(k), canonicalVs(v))
 	case "f":
 		v := []V{}
 		k := []string{}
 		for i, x := range ctx.globals {
-			if x.IsFunction() {
+			if x.IsFunction() && ctx.visibleGlobal(i) {
 				v = append(v, x)
 				x.MarkImmutable()
 				k = append(k, ctx.gNames[i])
@@ -898,7 +937,7 @@ func vfRTVars(ctx *Context, args []V) V {
 		v := []V{}
 		k := []string{}
 		for i, x := range ctx.globals {
-			if !x.IsFunction() {
+			if !x.IsFunction() && ctx.visibleGlobal(i) {
 				v = append(v, x)
 				x.MarkImmutable()
 				k = append(k, ctx.gNames[i])
@@ -909,6 +948,9 @@ func vfRTVars(ctx *Context, args []V) V {
 		v := []V{}
 		k := []string{}
 		for i, x := range ctx.globals {
+			if !ctx.visibleGlobal(i) {
+				continue
+			}
 			rcv := refcounts(x)
 			if rcv.IsI() && (rcv.I() == -1 || rcv.I() == math.MinInt64) {
 				continue
@@ -1009,6 +1051,70 @@ func vfRTTime(ctx *Context, args []V) V {
 	}
 }
 
+// vfRTProf implements the rt.prof variadic verb.
+func vfRTProf(ctx *Context, args []V) V {
+	x := args[len(args)-1]
+	var n int64 = 1
+	var f func() V
+	switch xv := x.bv.(type) {
+	case S:
+		if len(args) > 2 {
+			return panicRank(`rt.prof[s;n]`)
+		}
+		if len(args) == 2 {
+			nv := getN(args[0])
+			if nv.IsPanic() {
+				return nv
+			}
+			n = nv.I()
+		}
+		f = func() V { return evalString(ctx, string(xv)) }
+	default:
+		if !x.IsFunction() {
+			return panicType(`rt.prof[x;n]`, "x", x)
+		}
+		if len(args) == 1 {
+			return panics(`rt.prof[f;x;n] : not enough arguments`)
+		}
+		if len(args) > 3 {
+			return panicRank(`rt.prof[f;x;n]`)
+		}
+		if len(args) == 3 {
+			nv := getN(args[0])
+			if nv.IsPanic() {
+				return nv
+			}
+			n = nv.I()
+		}
+		av := toArray(args[len(args)-2]).bv.(Array)
+		f = func() V {
+			for i := av.Len() - 1; i >= 0; i-- {
+				ctx.push(av.VAt(i))
+			}
+			r := x.applyN(ctx, av.Len())
+			ctx.drop()
+			return r
+		}
+		x.IncrRC()
+		av.IncrRC()
+		defer x.DecrRC()
+		defer av.DecrRC()
+	}
+	oprof := ctx.prof
+	p := newProfiler(0)
+	ctx.prof = p
+	for i := int64(0); i < n; i++ {
+		r := f()
+		if r.IsPanic() {
+			ctx.prof = oprof
+			p.stopProfile()
+			return r
+		}
+	}
+	ctx.prof = oprof
+	return p.stopProfile().value()
+}
+
 // vfRTLog implements the rt.log variadic verb.
 func vfRTLog(ctx *Context, args []V) V {
 	if len(args) > 1 {
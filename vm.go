@@ -1,9 +1,27 @@
 package goal
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 func (ctx *Context) execute(ops []opcode) (int, error) {
+	stmt := true // start of a statement
 	for ip := 0; ip < len(ops); {
+		if ctx.usage != nil {
+			if err := ctx.usage.step(); err != nil {
+				return ip, err
+			}
+		}
+		if stmt && ctx.dbg != nil {
+			if err := ctx.statement(ops, ip); err != nil {
+				return ip, err
+			}
+		}
+		stmt = false
+		if ctx.prof != nil {
+			ctx.profStep(ip)
+		}
 		op := ops[ip]
 		//fmt.Printf("op: %s\n", op)
 		ip++
@@ -80,6 +98,19 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 		case opLambda:
 			ctx.pushNoRC(newLambda(lambda(ops[ip])))
 			ip++
+		case opClosure:
+			id := lambda(ops[ip])
+			n := len(ctx.lambdas[id].Captures)
+			env := make([]V, n)
+			copy(env, ctx.stack[len(ctx.stack)-n:])
+			ctx.dropN(n)
+			ctx.push(NewV(&closure{Fun: id, Env: env}))
+			ip++
+		case opTailApply:
+			if ctx.tailCall(ctx.top(), 1, true) {
+				return ip - 1, nil
+			}
+			fallthrough
 		case opApply:
 			x := ctx.pop()
 			r := x.applyN(ctx, 1)
@@ -96,6 +127,11 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 			}
 			ctx.replaceTop(r)
 			ip++
+		case opTailApplyGlobal:
+			if ctx.tailCall(ctx.globals[ops[ip]], 1, false) {
+				return ip - 1, nil
+			}
+			fallthrough
 		case opApplyGlobal:
 			x := ctx.globals[ops[ip]]
 			if x.kind == valNil {
@@ -113,6 +149,11 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 			v := variadic(ops[ip])
 			ctx.stack[len(ctx.stack)-1] = NewV(&derivedVerb{Fun: v, Arg: ctx.top()})
 			ip++
+		case opTailApply2:
+			if ctx.tailCall(ctx.top(), 2, true) {
+				return ip - 1, nil
+			}
+			fallthrough
 		case opApply2:
 			x := ctx.pop()
 			r := x.applyN(ctx, 2)
@@ -130,6 +171,11 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 			}
 			ctx.replaceTop(r)
 			ip++
+		case opTailApplyN:
+			if ctx.tailCall(ctx.top(), int(ops[ip]), true) {
+				return ip - 1, nil
+			}
+			fallthrough
 		case opApplyN:
 			x := ctx.pop()
 			r := x.applyN(ctx, int(ops[ip]))
@@ -149,6 +195,11 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 			}
 			ctx.replaceTop(r)
 			ip++
+		case opTailApplyNGlobal:
+			if ctx.tailCall(ctx.globals[ops[ip]], int(ops[ip+1]), false) {
+				return ip - 1, nil
+			}
+			fallthrough
 		case opApplyNGlobal:
 			x := ctx.globals[ops[ip]]
 			if x.kind == valNil {
@@ -165,6 +216,7 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 			ip++
 		case opDrop:
 			ctx.drop()
+			stmt = true
 		case opJump:
 			ip += int(ops[ip])
 		case opJumpFalse:
@@ -193,6 +245,58 @@ func (ctx *Context) execute(ops []opcode) (int, error) {
 
 const maxCallDepth = 100000
 
+// interrupt represents the cancellation state of a context running with
+// RunContext. It is shared with derived contexts.
+type interrupt struct {
+	flag int32 // non-zero if execution should stop
+}
+
+func (intr *interrupt) set() {
+	atomic.StoreInt32(&intr.flag, 1)
+}
+
+func (intr *interrupt) isSet() bool {
+	return atomic.LoadInt32(&intr.flag) != 0
+}
+
+// interrupted returns true if the context's execution has been cancelled.
+func (ctx *Context) interrupted() bool {
+	return ctx.intr != nil && ctx.intr.isSet()
+}
+
+func panicInterrupted() V {
+	return panics("interrupted")
+}
+
+// interruptChunk is the number of iterations, or comparisons, performed by
+// long-running primitives between checks for interruption.
+const interruptChunk = 1 << 16
+
+// interruptSignal is the value used to unwind a long-running primitive when
+// the context's execution has been cancelled.
+type interruptSignal struct{}
+
+// pollInterrupt unwinds the current primitive, for catchInterrupt to
+// recover, if the context's execution has been cancelled. It only checks
+// every interruptChunk iterations: i is the current iteration number.
+func (ctx *Context) pollInterrupt(i int) {
+	if i&(interruptChunk-1) == 0 && ctx.interrupted() {
+		panic(interruptSignal{})
+	}
+}
+
+// catchInterrupt recovers the unwinding done by pollInterrupt, replacing *r
+// with an interruption panic value. It should be deferred by primitives
+// calling pollInterrupt.
+func catchInterrupt(r *V) {
+	if e := recover(); e != nil {
+		if _, ok := e.(interruptSignal); !ok {
+			panic(e)
+		}
+		*r = panicInterrupted()
+	}
+}
+
 func (ctx *Context) push(x V) {
 	x.IncrRC()
 	ctx.stack = append(ctx.stack, x)
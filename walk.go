@@ -0,0 +1,94 @@
+package goal
+
+// Visitor represents a syntax tree visitor for Walk. Its Visit method is
+// called for each node encountered by Walk. If the result visitor w is not
+// nil, Walk visits each of the children of node with w, followed by a call of
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order, and in source order for
+// children. It starts by calling v.Visit(node), and then walks the children
+// of node with the visitor returned by it, if not nil. Comments are not
+// visited, except when walking a *File.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *File:
+		for _, es := range n.Body {
+			Walk(v, es)
+		}
+		for _, c := range n.Comments {
+			Walk(v, c)
+		}
+	case *Exprs:
+		for _, e := range n.List {
+			Walk(v, e)
+		}
+	case *DerivedVerb:
+		if n.Verb != nil {
+			Walk(v, n.Verb)
+		}
+		Walk(v, n.Adverb)
+	case *Strand:
+		for _, e := range n.Items {
+			Walk(v, e)
+		}
+	case *Interp:
+		for _, e := range n.Parts {
+			Walk(v, e)
+		}
+	case *ParenExpr:
+		Walk(v, n.X)
+	case *ListExpr:
+		walkExprsList(v, n.Items)
+	case *SeqExpr:
+		walkExprsList(v, n.Body)
+	case *LambdaExpr:
+		walkExprsList(v, n.Body)
+	case *CallExpr:
+		Walk(v, n.Fun)
+		walkExprsList(v, n.Args)
+	case *BinaryExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Verb)
+		Walk(v, n.Right)
+	case *ReturnExpr:
+		Walk(v, n.X)
+	case *LogExpr:
+		Walk(v, n.X)
+	case *AssignExpr:
+		Walk(v, n.Right)
+	case *ListAssignExpr:
+		Walk(v, n.Right)
+	case *AmendAssignExpr:
+		walkExprsList(v, n.Indices)
+		Walk(v, n.Right)
+	}
+	v.Visit(nil)
+}
+
+func walkExprsList(v Visitor, l []*Exprs) {
+	for _, es := range l {
+		Walk(v, es)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree in depth-first order, like Walk. It starts
+// by calling f(node), and then inspects the children of node if f returned
+// true, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}